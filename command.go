@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+const usage = `Usage: mstudio-ext-proxy [command] [arguments]
+
+Commands:
+  serve     run the proxy server (default, if no command is given)
+  apikey    create, list and revoke API keys for extension instances
+  webhook   inspect and replay webhooks that could not be processed
+  instances reconcile the local extension instances with the mStudio
+
+Run "mstudio-ext-proxy [command] -h" for more information about a command.
+`
+
+func runCommand(name string, args []string) int {
+	var err error
+
+	switch name {
+	case "serve":
+		serve()
+	case "apikey":
+		err = runAPIKeyCommand(args)
+	case "webhook":
+		err = runWebhookCommand(args)
+	case "instances":
+		err = runInstancesCommand(args)
+	case "help", "-h", "--help":
+		fmt.Print(usage)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command '%s'\n\n%s", name, usage)
+		return 2
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s\n", err)
+		return 1
+	}
+
+	return 0
+}
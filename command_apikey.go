@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/mittwald/mstudio-ext-proxy/pkg/bootstrap"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/domain/service"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/persistence"
+)
+
+const apiKeyUsage = `Usage: mstudio-ext-proxy apikey [create|list|revoke] [arguments]
+
+  create -instance <id> -name <name> [-expires <duration>]
+        create a new API key for an extension instance; the key is only
+        printed once
+  list -instance <id>
+        list all API keys of an extension instance
+  revoke <key-id>
+        revoke an API key
+`
+
+func runAPIKeyCommand(args []string) error {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, apiKeyUsage)
+		return fmt.Errorf("missing subcommand")
+	}
+
+	ctx := context.Background()
+	config := bootstrap.ConfigFromEnv()
+	mongoDatabase := bootstrap.ConnectToMongodb(config.MongoDBURI).Database(bootstrap.MongoDatabaseName)
+
+	apiKeyService := service.NewAPIKeyService(
+		persistence.NewMongoAPIKeyRepository(mongoDatabase.Collection("api_keys")),
+		persistence.NewMongoExtensionInstanceRepository(mongoDatabase.Collection("instances")),
+	)
+
+	switch args[0] {
+	case "create":
+		flags := flag.NewFlagSet("apikey create", flag.ExitOnError)
+		instanceID := flags.String("instance", "", "extension instance ID")
+		name := flags.String("name", "", "descriptive name of the key")
+		expiresIn := flags.Duration("expires", 0, "duration after which the key expires (default: never)")
+		_ = flags.Parse(args[1:])
+
+		if *instanceID == "" || *name == "" {
+			return fmt.Errorf("-instance and -name are required")
+		}
+
+		expires := time.Time{}
+		if *expiresIn > 0 {
+			expires = time.Now().Add(*expiresIn)
+		}
+
+		key, token, err := apiKeyService.CreateAPIKey(ctx, *name, *instanceID, expires)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(os.Stderr, "created API key %s; store the following token, it will not be shown again:\n", key.ID)
+		fmt.Println(token)
+	case "list":
+		flags := flag.NewFlagSet("apikey list", flag.ExitOnError)
+		instanceID := flags.String("instance", "", "extension instance ID")
+		_ = flags.Parse(args[1:])
+
+		if *instanceID == "" {
+			return fmt.Errorf("-instance is required")
+		}
+
+		keys, err := apiKeyService.ListAPIKeysForInstance(ctx, *instanceID)
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tNAME\tCREATED\tEXPIRES")
+		for _, key := range keys {
+			expires := "never"
+			if !key.Expires.IsZero() {
+				expires = key.Expires.Format(time.RFC3339)
+			}
+
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", key.ID, key.Name, key.Created.Format(time.RFC3339), expires)
+		}
+
+		return w.Flush()
+	case "revoke":
+		if len(args) != 2 {
+			return fmt.Errorf("expected exactly one key ID")
+		}
+
+		return apiKeyService.RevokeAPIKey(ctx, args[1])
+	default:
+		fmt.Fprint(os.Stderr, apiKeyUsage)
+		return fmt.Errorf("unknown subcommand '%s'", args[0])
+	}
+
+	return nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/mittwald/mstudio-ext-proxy/pkg/bootstrap"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/persistence"
+)
+
+const instancesUsage = `Usage: mstudio-ext-proxy instances [reconcile] [arguments]
+
+  reconcile [-dry-run]
+        add, update and remove local extension instances to match the
+        instances listed by the marketplace API; requires
+        MITTWALD_EXT_PROXY_RECONCILE_API_TOKEN
+`
+
+func runInstancesCommand(args []string) error {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, instancesUsage)
+		return fmt.Errorf("missing subcommand")
+	}
+
+	switch args[0] {
+	case "reconcile":
+		flags := flag.NewFlagSet("instances reconcile", flag.ExitOnError)
+		dryRun := flags.Bool("dry-run", false, "only report differences")
+		_ = flags.Parse(args[1:])
+
+		config := bootstrap.ConfigFromEnv()
+		logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+		mongoDatabase := bootstrap.ConnectToMongodb(config.MongoDBURI).Database(bootstrap.MongoDatabaseName)
+		instanceRepository := persistence.NewMongoExtensionInstanceRepository(mongoDatabase.Collection("instances"))
+
+		reconciler, err := bootstrap.BuildInstanceReconciler(config, instanceRepository, logger)
+		if err != nil {
+			return err
+		}
+
+		if reconciler == nil {
+			return fmt.Errorf("reconciliation requires an API token and at least one extension ID")
+		}
+
+		report, err := reconciler.Reconcile(context.Background(), *dryRun)
+		if err != nil {
+			return err
+		}
+
+		for _, id := range report.Added {
+			fmt.Printf("+ %s\n", id)
+		}
+		for _, id := range report.Updated {
+			fmt.Printf("~ %s\n", id)
+		}
+		for _, id := range report.Removed {
+			fmt.Printf("- %s\n", id)
+		}
+	default:
+		fmt.Fprint(os.Stderr, instancesUsage)
+		return fmt.Errorf("unknown subcommand '%s'", args[0])
+	}
+
+	return nil
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/mittwald/mstudio-ext-proxy/pkg/bootstrap"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/domain/service"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/persistence"
+)
+
+const webhookUsage = `Usage: mstudio-ext-proxy webhook [deadletters|keygen|send] [arguments]
+
+  deadletters list
+        list all webhooks that could not be processed
+  deadletters show <id>
+        print the payload and last error of a dead-lettered webhook
+  deadletters replay [-all] [<id>...]
+        move dead-lettered webhooks back into the processing queue
+  keygen -serial <serial> -out <file>
+        generate an Ed25519 key pair for signing simulated webhooks; the
+        private key is written to the given file, the public key is printed
+        in a format suitable for MITTWALD_EXT_PROXY_WEBHOOKS_PUBLIC_KEYS_FILE
+  send -url <url> -key <file> -kind <kind> [event flags]
+  send -url <url> -key <file> -file <event.json>
+        sign a webhook with a key generated by "keygen" and send it; the kind
+        is one of "added", "updated", "secret-rotated" and "removed". Run
+        "webhook send -h" for all event flags.
+`
+
+func runWebhookCommand(args []string) error {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, webhookUsage)
+		return fmt.Errorf("missing subcommand")
+	}
+
+	switch args[0] {
+	case "deadletters":
+		return runWebhookDeadLettersCommand(args[1:])
+	case "keygen":
+		return runWebhookKeygenCommand(args[1:])
+	case "send":
+		return runWebhookSendCommand(args[1:])
+	default:
+		fmt.Fprint(os.Stderr, webhookUsage)
+		return fmt.Errorf("unknown subcommand '%s'", args[0])
+	}
+}
+
+func runWebhookDeadLettersCommand(args []string) error {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, webhookUsage)
+		return fmt.Errorf("missing subcommand")
+	}
+
+	ctx := context.Background()
+	config := bootstrap.ConfigFromEnv()
+	mongoDatabase := bootstrap.ConnectToMongodb(config.MongoDBURI).Database(bootstrap.MongoDatabaseName)
+
+	queueService := service.NewWebhookQueueService(
+		persistence.MustNewMongoWebhookQueueRepository(mongoDatabase.Collection("webhook_queue"), mongoDatabase.Collection("webhook_dead_letters")),
+		persistence.MustNewMongoWebhookDeliveryRepository(mongoDatabase.Collection("webhook_deliveries")),
+		config.Webhooks.RedeliveryWindow,
+	)
+
+	switch args[0] {
+	case "list":
+		deadLetters, err := queueService.ListDeadLetters(ctx)
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tKIND\tINSTANCE\tATTEMPTS\tDEAD-LETTERED\tLAST ERROR")
+		for _, wh := range deadLetters {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\t%s\n", wh.ID, wh.Kind, wh.InstanceID, wh.Attempts, wh.DeadLettered.Format(time.RFC3339), wh.LastError)
+		}
+
+		return w.Flush()
+	case "show":
+		if len(args) != 2 {
+			return fmt.Errorf("expected exactly one webhook ID")
+		}
+
+		wh, err := queueService.GetDeadLetter(ctx, args[1])
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(os.Stderr, "kind:       %s (%s)\ninstance:   %s\nenqueued:   %s\nattempts:   %d\nlast error: %s\n\n",
+			wh.Kind, wh.APIVersion, wh.InstanceID, wh.Enqueued.Format(time.RFC3339), wh.Attempts, wh.LastError)
+		fmt.Println(string(wh.Payload))
+	case "replay":
+		flags := flag.NewFlagSet("webhook deadletters replay", flag.ExitOnError)
+		all := flags.Bool("all", false, "replay all dead-lettered webhooks")
+		_ = flags.Parse(args[1:])
+
+		ids := flags.Args()
+		if *all {
+			deadLetters, err := queueService.ListDeadLetters(ctx)
+			if err != nil {
+				return err
+			}
+
+			ids = nil
+			for _, wh := range deadLetters {
+				ids = append(ids, wh.ID)
+			}
+		}
+
+		if len(ids) == 0 {
+			return fmt.Errorf("expected at least one webhook ID, or -all")
+		}
+
+		for _, id := range ids {
+			if err := queueService.ReplayDeadLetter(ctx, id); err != nil {
+				return err
+			}
+
+			fmt.Fprintf(os.Stderr, "re-enqueued webhook %s\n", id)
+		}
+	default:
+		fmt.Fprint(os.Stderr, webhookUsage)
+		return fmt.Errorf("unknown subcommand '%s'", args[0])
+	}
+
+	return nil
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/webhooks/webhookscommon"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/webhooks/webhooksv1"
+)
+
+func runWebhookKeygenCommand(args []string) error {
+	flags := flag.NewFlagSet("webhook keygen", flag.ExitOnError)
+	serial := flags.String("serial", "local", "key serial")
+	out := flags.String("out", "", "file to write the private key to")
+	_ = flags.Parse(args)
+
+	if *out == "" {
+		return fmt.Errorf("-out is required")
+	}
+
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return err
+	}
+
+	privateDER, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		return err
+	}
+
+	publicDER, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return err
+	}
+
+	headers := map[string]string{"Serial": *serial}
+	privatePEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Headers: headers, Bytes: privateDER})
+
+	if err := os.WriteFile(*out, privatePEM, 0o600); err != nil {
+		return fmt.Errorf("error writing private key: %w", err)
+	}
+
+	fmt.Fprintf(os.Stderr, "wrote private key to %s\n", *out)
+	return pem.Encode(os.Stdout, &pem.Block{Type: "PUBLIC KEY", Headers: headers, Bytes: publicDER})
+}
+
+func runWebhookSendCommand(args []string) error {
+	flags := flag.NewFlagSet("webhook send", flag.ExitOnError)
+	targetURL := flags.String("url", "http://localhost:8000/mstudio/webhooks", "webhook endpoint")
+	keyFile := flags.String("key", "", "private key file generated by 'webhook keygen'")
+	file := flags.String("file", "", "JSON file containing the complete event (instead of the event flags)")
+	kind := flags.String("kind", "", "event kind: added, updated, secret-rotated or removed")
+	instanceID := flags.String("instance", "", "extension instance ID (default: random)")
+	contextKind := flags.String("context-kind", string(webhooksv1.ContextKindProject), "context kind: project or customer")
+	contextID := flags.String("context", "", "context ID (default: random)")
+	extensionID := flags.String("extension", "", "extension ID")
+	contributorID := flags.String("contributor", "", "contributor ID")
+	scopes := flags.String("scopes", "", "comma-separated list of consented scopes")
+	disabled := flags.Bool("disabled", false, "mark the instance as disabled")
+	secret := flags.String("secret", "", "instance secret (default: random; added and secret-rotated only)")
+	_ = flags.Parse(args)
+
+	if *keyFile == "" {
+		return fmt.Errorf("-key is required")
+	}
+
+	signer, err := loadWebhookSigner(*keyFile)
+	if err != nil {
+		return err
+	}
+
+	var body []byte
+
+	if *file != "" {
+		if body, err = os.ReadFile(*file); err != nil {
+			return fmt.Errorf("error reading event file: %w", err)
+		}
+	} else {
+		ctx := webhooksv1.Context{ID: orRandom(*contextID), Kind: webhooksv1.ContextKind(*contextKind)}
+		meta := webhooksv1.Meta{ExtensionID: *extensionID, ContributorID: *contributorID}
+		state := webhooksv1.State{Enabled: !*disabled}
+		consentedScopes := make([]string, 0)
+		if *scopes != "" {
+			consentedScopes = strings.Split(*scopes, ",")
+		}
+
+		id := orRandom(*instanceID)
+		fmt.Fprintf(os.Stderr, "instance ID: %s\n", id)
+
+		event, err := buildWebhookEvent(*kind, id, ctx, meta, state, consentedScopes, orRandom(*secret))
+		if err != nil {
+			return err
+		}
+
+		if body, err = json.Marshal(event); err != nil {
+			return err
+		}
+	}
+
+	req, err := http.NewRequest(http.MethodPost, *targetURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	signer.SignRequest(req, body)
+
+	res, err := (&http.Client{Timeout: 30 * time.Second}).Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer res.Body.Close()
+
+	resBody, _ := io.ReadAll(res.Body)
+	fmt.Fprintf(os.Stderr, "%s\n", res.Status)
+	fmt.Println(string(resBody))
+
+	if res.StatusCode >= 300 {
+		return fmt.Errorf("webhook was not accepted")
+	}
+
+	return nil
+}
+
+func buildWebhookEvent(kind, id string, ctx webhooksv1.Context, meta webhooksv1.Meta, state webhooksv1.State, scopes []string, secret string) (any, error) {
+	envelope := func(kind string) webhookscommon.Envelope {
+		return webhookscommon.Envelope{APIVersion: "v1", Kind: kind}
+	}
+
+	switch kind {
+	case "added":
+		return &webhooksv1.ExtensionAddedToContext{
+			Envelope:        envelope("ExtensionAddedToContext"),
+			ID:              id,
+			Context:         ctx,
+			ConsentedScopes: scopes,
+			State:           state,
+			Meta:            meta,
+			Secret:          secret,
+		}, nil
+	case "updated":
+		return &webhooksv1.ExtensionInstanceUpdated{
+			Envelope:        envelope("ExtensionInstanceUpdated"),
+			ID:              id,
+			Context:         ctx,
+			ConsentedScopes: scopes,
+			State:           state,
+			Meta:            meta,
+		}, nil
+	case "secret-rotated":
+		return &webhooksv1.ExtensionInstanceSecretRotated{
+			Envelope: envelope("ExtensionInstanceSecretRotated"),
+			ID:       id,
+			Context:  ctx,
+			Meta:     meta,
+			Secret:   secret,
+		}, nil
+	case "removed":
+		return &webhooksv1.ExtensionInstanceRemovedFromContext{
+			Envelope:        envelope("ExtensionInstanceRemovedFromContext"),
+			ID:              id,
+			Context:         ctx,
+			ConsentedScopes: scopes,
+			State:           state,
+			Meta:            meta,
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown event kind '%s'; expected added, updated, secret-rotated or removed", kind)
+	}
+}
+
+func loadWebhookSigner(path string) (*webhookscommon.Signer, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading private key: %w", err)
+	}
+
+	block, _ := pem.Decode(contents)
+	if block == nil || block.Type != "PRIVATE KEY" {
+		return nil, fmt.Errorf("%s does not contain a PEM-encoded private key", path)
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing private key: %w", err)
+	}
+
+	privateKey, ok := parsed.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("private key is a %T; expected an Ed25519 key", parsed)
+	}
+
+	serial := block.Headers["Serial"]
+	if serial == "" {
+		serial = "local"
+	}
+
+	return &webhookscommon.Signer{Serial: serial, PrivateKey: privateKey}, nil
+}
+
+func orRandom(value string) string {
+	if value == "" {
+		return uuid.NewString()
+	}
+
+	return value
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+
+	"github.com/mittwald/mstudio-ext-proxy/pkg/webhooks/webhookscommon"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/webhooks/webhooksv1"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// captureStdout runs fn and returns everything it wrote to os.Stdout.
+func captureStdout(fn func() error) ([]byte, error) {
+	out, err := os.CreateTemp(GinkgoT().TempDir(), "stdout")
+	Expect(err).NotTo(HaveOccurred())
+	defer out.Close()
+
+	stdout := os.Stdout
+	os.Stdout = out
+	defer func() { os.Stdout = stdout }()
+
+	if err := fn(); err != nil {
+		return nil, err
+	}
+
+	return os.ReadFile(out.Name())
+}
+
+var _ = Describe("webhook keygen", func() {
+	var keyFile string
+
+	BeforeEach(func() {
+		keyFile = filepath.Join(GinkgoT().TempDir(), "webhook-key.pem")
+	})
+
+	It("should require an output file", func() {
+		Expect(runWebhookKeygenCommand(nil)).To(MatchError(ContainSubstring("-out")))
+	})
+
+	It("should write a private key and print the matching public key", func() {
+		out, err := captureStdout(func() error {
+			return runWebhookKeygenCommand([]string{"-serial", "test-serial", "-out", keyFile})
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		info, err := os.Stat(keyFile)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.Mode().Perm()).To(Equal(os.FileMode(0o600)))
+
+		block, _ := pem.Decode(out)
+		Expect(block).NotTo(BeNil())
+		Expect(block.Type).To(Equal("PUBLIC KEY"))
+		Expect(block.Headers).To(HaveKeyWithValue("Serial", "test-serial"))
+
+		publicKey, err := x509.ParsePKIXPublicKey(block.Bytes)
+		Expect(err).NotTo(HaveOccurred())
+
+		signer, err := loadWebhookSigner(keyFile)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(signer.Serial).To(Equal("test-serial"))
+		Expect(signer.PrivateKey.Public()).To(Equal(publicKey))
+	})
+})
+
+var _ = Describe("webhook send", func() {
+	var keyFile string
+	var verifier *webhookscommon.Verifier
+	var status int
+	var received []any
+
+	BeforeEach(func() {
+		keyFile = filepath.Join(GinkgoT().TempDir(), "webhook-key.pem")
+
+		out, err := captureStdout(func() error {
+			return runWebhookKeygenCommand([]string{"-serial", "test-serial", "-out", keyFile})
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		block, _ := pem.Decode(out)
+		publicKey, err := x509.ParsePKIXPublicKey(block.Bytes)
+		Expect(err).NotTo(HaveOccurred())
+
+		verifier = &webhookscommon.Verifier{
+			KeyProvider: &webhookscommon.KeyProviderStatic{Keys: map[string]ed25519.PublicKey{"test-serial": publicKey.(ed25519.PublicKey)}},
+		}
+		status = http.StatusAccepted
+		received = nil
+	})
+
+	// send runs the command against a webhook endpoint that verifies the
+	// signature of the request.
+	send := func(args ...string) error {
+		endpoint := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer GinkgoRecover()
+
+			body, err := io.ReadAll(r.Body)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(verifier.VerifyWebhookRequest(context.Background(), r, body)).To(Succeed())
+			Expect(r.Header).NotTo(HaveKey("X-Marketplace-Signature-Timestamp"))
+
+			wh := map[string]any{}
+			Expect(json.Unmarshal(body, &wh)).To(Succeed())
+			received = append(received, wh)
+
+			w.WriteHeader(status)
+		}))
+		defer endpoint.Close()
+
+		_, err := captureStdout(func() error {
+			return runWebhookSendCommand(append([]string{"-url", endpoint.URL, "-key", keyFile}, args...))
+		})
+		return err
+	}
+
+	It("should require a key", func() {
+		Expect(runWebhookSendCommand(nil)).To(MatchError(ContainSubstring("-key")))
+	})
+
+	It("should send a signed event", func() {
+		Expect(send("-kind", "added", "-instance", "instance", "-extension", "extension", "-scopes", "project:read,project:write", "-secret", "secret")).To(Succeed())
+
+		Expect(received).To(ConsistOf(SatisfyAll(
+			HaveKeyWithValue("apiVersion", "v1"),
+			HaveKeyWithValue("kind", "ExtensionAddedToContext"),
+			HaveKeyWithValue("id", "instance"),
+			HaveKeyWithValue("consentedScopes", ConsistOf("project:read", "project:write")),
+			HaveKeyWithValue("meta", HaveKeyWithValue("extensionId", "extension")),
+			HaveKeyWithValue("secret", "secret"),
+			HaveKeyWithValue("context", HaveKeyWithValue("kind", string(webhooksv1.ContextKindProject))),
+		)))
+	})
+
+	It("should send an event from a file", func() {
+		file := filepath.Join(GinkgoT().TempDir(), "event.json")
+		Expect(os.WriteFile(file, []byte(`{"apiVersion":"v1","kind":"ExtensionInstanceRemovedFromContext","id":"instance"}`), 0o600)).To(Succeed())
+
+		Expect(send("-file", file)).To(Succeed())
+		Expect(received).To(ConsistOf(HaveKeyWithValue("kind", "ExtensionInstanceRemovedFromContext")))
+	})
+
+	It("should reject unknown event kinds", func() {
+		Expect(send("-kind", "unknown")).To(MatchError(ContainSubstring("unknown event kind")))
+		Expect(received).To(BeEmpty())
+	})
+
+	It("should fail if the webhook is not accepted", func() {
+		status = http.StatusForbidden
+
+		Expect(send("-kind", "removed")).To(MatchError(ContainSubstring("not accepted")))
+		Expect(received).To(HaveLen(1))
+	})
+})
@@ -1,93 +1,69 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
-	"net/http"
 	"os"
+	"os/signal"
 	"strconv"
-	"strings"
+	"syscall"
 
-	"github.com/gin-gonic/gin"
 	"github.com/mittwald/mstudio-ext-proxy/pkg/bootstrap"
-	"github.com/mittwald/mstudio-ext-proxy/pkg/controller"
-	"github.com/mittwald/mstudio-ext-proxy/pkg/domain/service"
-	"github.com/mittwald/mstudio-ext-proxy/pkg/persistence"
-	"github.com/mittwald/mstudio-ext-proxy/pkg/proxy"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/server"
 )
 
 func main() {
-	config := bootstrap.ConfigFromEnv()
-	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelDebug}))
-
-	mongoClient := bootstrap.ConnectToMongodb(config.MongoDBURI)
-	mongoDatabase := mongoClient.Database("mstudio_ext")
-	mittwaldClient := bootstrap.BuildMittwaldAPIClientFromConfig(config, logger)
-	authOptions := bootstrap.BuildAuthenticationOptions(config)
-
-	instanceRepository := persistence.NewMongoExtensionInstanceRepository(mongoDatabase.Collection("instances"))
-	sessionRepository := persistence.MustNewMongoSessionRepository(mongoDatabase.Collection("sessions"))
-
-	sessionService := service.NewSessionService(mittwaldClient, sessionRepository, instanceRepository)
-
-	webhookCtrl := controller.WebhookController{
-		ExtensionInstanceRepository: instanceRepository,
-		WebhookVerifier:             bootstrap.BuildWebhookVerifier(mittwaldClient),
-		Logger:                      logger,
-	}
-	authCtrl := controller.UserAuthenticationController{
-		Client:                mittwaldClient,
-		SessionRepository:     sessionRepository,
-		SessionService:        sessionService,
-		InstanceRepository:    instanceRepository,
-		Development:           config.Context == "dev",
-		AuthenticationOptions: authOptions,
-		Logger:                logger,
+	if len(os.Args) > 1 {
+		os.Exit(runCommand(os.Args[1], os.Args[2:]))
 	}
 
-	r := gin.New()
-	r.LoadHTMLGlob("templates/*")
+	serve()
+}
 
-	rm := r.Group("/mstudio")
-	rm.POST("/webhooks", webhookCtrl.HandleWebhookRequest)
-	rm.GET("/auth/oneclick", authCtrl.HandleAuthenticationRequest)
-	rm.GET("/auth/fake", authCtrl.HandleFakeAuthentication)
-	rm.GET("/auth/current", authCtrl.HandleUserInfo)
+func serve() {
+	config := bootstrap.ConfigFromEnv()
 
-	if authOptions.StaticPassword != "" {
-		rm.Any("/auth/password", authCtrl.HandlePasswordAuthentication)
+	logger, err := bootstrap.BuildLogger(config, os.Stderr)
+	if err != nil {
+		slog.Error("error initializing logger", "err", err)
+		os.Exit(1)
 	}
 
-	mux := http.NewServeMux()
-	mux.Handle("/mstudio/", r)
-
-	for prefix, proxyConfig := range config.Upstreams {
-		if !strings.HasSuffix(prefix, "/") {
-			prefix += "/"
-		}
-
-		proxyHandler := proxy.Handler{
-			HTTPClient:            http.DefaultClient,
-			SessionRepository:     sessionRepository,
-			SessionService:        sessionService,
-			Configuration:         proxyConfig,
-			Logger:                logger,
-			AuthenticationOptions: authOptions,
-		}
-
-		mux.Handle(prefix, &proxyHandler)
+	shutdownTracing, err := bootstrap.InitTracing(context.Background(), config)
+	if err != nil {
+		logger.Error("error initializing tracing", "err", err)
+		os.Exit(1)
 	}
 
-	s := http.Server{
-		Handler: mux,
-		Addr:    getListenAddr(),
+	mongoClient := bootstrap.ConnectToMongodb(config.MongoDBURI)
+	repos := bootstrap.BuildMongoRepositories(mongoClient.Database(bootstrap.MongoDatabaseName))
+
+	srv, err := server.New(
+		server.WithConfig(config),
+		server.WithRepositories(repos),
+		server.WithLogger(logger),
+		server.WithOnStop(shutdownTracing),
+		server.WithOnStop(mongoClient.Disconnect),
+	)
+	if err != nil {
+		logger.Error("error initializing server", "err", err)
+		os.Exit(1)
 	}
 
-	logger.Info("listening", "server.addr", s.Addr)
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
 
-	if err := s.ListenAndServe(); err != nil {
-		panic(err)
+	// Restore the default signal handling after the first signal, so that a
+	// second one terminates the process immediately.
+	context.AfterFunc(ctx, stop)
+
+	if err := srv.ListenAndServe(ctx, getListenAddr()); err != nil {
+		logger.Error("error running server", "err", err)
+		os.Exit(1)
 	}
+
+	logger.Info("server stopped")
 }
 
 func getListenPort() int64 {
@@ -0,0 +1,13 @@
+package authentication_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestAuthentication(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Authentication Suite")
+}
@@ -0,0 +1,63 @@
+package oidc
+
+import (
+	"fmt"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ClaimMapping configures which ID token claims are used to build a user
+// identity. Empty fields fall back to the standard OpenID Connect claims.
+type ClaimMapping struct {
+	UserID    string
+	Email     string
+	FirstName string
+	LastName  string
+}
+
+// Identity is the identity of a user that logged in via OpenID Connect. The
+// UserID is namespaced by the issuer (see NamespacedUserID), so that it cannot
+// collide with the ID of an mStudio user, or of a user of another issuer.
+type Identity struct {
+	UserID    string
+	Email     string
+	FirstName string
+	LastName  string
+}
+
+func (m ClaimMapping) Identity(claims jwt.MapClaims) (Identity, error) {
+	issuer := stringClaim(claims, "", "iss")
+	if issuer == "" {
+		return Identity{}, fmt.Errorf("ID token does not contain an issuer claim")
+	}
+
+	identity := Identity{
+		UserID:    stringClaim(claims, m.UserID, "sub"),
+		Email:     stringClaim(claims, m.Email, "email"),
+		FirstName: stringClaim(claims, m.FirstName, "given_name"),
+		LastName:  stringClaim(claims, m.LastName, "family_name"),
+	}
+
+	if identity.UserID == "" {
+		return identity, fmt.Errorf("ID token does not contain a user ID claim")
+	}
+
+	identity.UserID = NamespacedUserID(issuer, identity.UserID)
+
+	return identity, nil
+}
+
+// NamespacedUserID returns the user ID for a user with the given ID at the
+// given issuer, in the form "oidc:{issuer}:{userID}".
+func NamespacedUserID(issuer, userID string) string {
+	return "oidc:" + issuer + ":" + userID
+}
+
+func stringClaim(claims jwt.MapClaims, name, fallback string) string {
+	if name == "" {
+		name = fallback
+	}
+
+	value, _ := claims[name].(string)
+	return value
+}
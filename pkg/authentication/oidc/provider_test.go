@@ -0,0 +1,180 @@
+package oidc_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/authentication/oidc"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// mockIssuer is a minimal OpenID provider that issues ID tokens for a single
+// authorization code.
+type mockIssuer struct {
+	server        *httptest.Server
+	key           *rsa.PrivateKey
+	codeChallenge string
+	claims        jwt.MapClaims
+}
+
+func newMockIssuer() *mockIssuer {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	Expect(err).NotTo(HaveOccurred())
+
+	m := &mockIssuer{key: key}
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 m.server.URL,
+			"authorization_endpoint": m.server.URL + "/authorize",
+			"token_endpoint":         m.server.URL + "/token",
+			"jwks_uri":               m.server.URL + "/jwks",
+		})
+	})
+
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"keys": []map[string]string{{
+				"kid": "test",
+				"kty": "RSA",
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		Expect(r.ParseForm()).To(Succeed())
+
+		verifierHash := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+		if r.PostForm.Get("code") != "valid-code" || base64.RawURLEncoding.EncodeToString(verifierHash[:]) != m.codeChallenge {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"access_token": "access-token",
+			"token_type":   "Bearer",
+			"id_token":     m.sign(m.claims),
+		})
+	})
+
+	m.server = httptest.NewServer(mux)
+	return m
+}
+
+func (m *mockIssuer) sign(claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = "test"
+
+	signed, err := token.SignedString(m.key)
+	Expect(err).NotTo(HaveOccurred())
+
+	return signed
+}
+
+var _ = Describe("Provider", func() {
+	var issuer *mockIssuer
+	var provider *oidc.Provider
+	var authReq oidc.AuthorizationRequest
+
+	BeforeEach(func() {
+		var err error
+
+		issuer = newMockIssuer()
+		DeferCleanup(issuer.server.Close)
+
+		provider, err = oidc.NewProvider(context.Background(), oidc.Config{
+			IssuerURL:    issuer.server.URL,
+			ClientID:     "proxy",
+			ClientSecret: "secret",
+			RedirectURL:  "https://extension.example/mstudio/auth/oidc/callback",
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		authReq, err = oidc.NewAuthorizationRequest()
+		Expect(err).NotTo(HaveOccurred())
+
+		authURL, err := url.Parse(provider.AuthCodeURL(authReq))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(authURL.Query().Get("state")).To(Equal(authReq.State))
+		issuer.codeChallenge = authURL.Query().Get("code_challenge")
+
+		issuer.claims = jwt.MapClaims{
+			"iss":         issuer.server.URL,
+			"aud":         "proxy",
+			"sub":         "support-user",
+			"email":       "support@example.com",
+			"given_name":  "Support",
+			"family_name": "Staff",
+			"nonce":       authReq.Nonce,
+			"iat":         time.Now().Unix(),
+			"exp":         time.Now().Add(5 * time.Minute).Unix(),
+		}
+	})
+
+	It("should exchange a code and verify the ID token", func() {
+		token, err := provider.Exchange(context.Background(), "valid-code", authReq.CodeVerifier)
+		Expect(err).NotTo(HaveOccurred())
+
+		claims, err := provider.VerifyIDToken(context.Background(), token.IDToken, authReq.Nonce)
+		Expect(err).NotTo(HaveOccurred())
+
+		identity, err := oidc.ClaimMapping{}.Identity(claims)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(identity).To(Equal(oidc.Identity{
+			UserID:    "oidc:" + issuer.server.URL + ":support-user",
+			Email:     "support@example.com",
+			FirstName: "Support",
+			LastName:  "Staff",
+		}))
+	})
+
+	It("should reject an invalid code verifier", func() {
+		_, err := provider.Exchange(context.Background(), "valid-code", "wrong-verifier")
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should reject a nonce mismatch", func() {
+		_, err := provider.VerifyIDToken(context.Background(), issuer.sign(issuer.claims), "other-nonce")
+		Expect(err).To(MatchError(ContainSubstring("nonce mismatch")))
+	})
+
+	It("should reject tokens for other audiences", func() {
+		issuer.claims["aud"] = "other-client"
+		_, err := provider.VerifyIDToken(context.Background(), issuer.sign(issuer.claims), authReq.Nonce)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should reject expired tokens", func() {
+		issuer.claims["exp"] = time.Now().Add(-5 * time.Minute).Unix()
+		_, err := provider.VerifyIDToken(context.Background(), issuer.sign(issuer.claims), authReq.Nonce)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should map custom claims", func() {
+		issuer.claims["preferred_username"] = "jdoe"
+		identity, err := oidc.ClaimMapping{UserID: "preferred_username"}.Identity(issuer.claims)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(identity.UserID).To(Equal(oidc.NamespacedUserID(issuer.server.URL, "jdoe")))
+	})
+
+	It("should reject tokens without an issuer", func() {
+		delete(issuer.claims, "iss")
+		_, err := oidc.ClaimMapping{}.Identity(issuer.claims)
+		Expect(err).To(MatchError(ContainSubstring("issuer")))
+	})
+})
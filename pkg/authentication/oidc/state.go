@@ -0,0 +1,76 @@
+package oidc
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+// ErrInvalidLoginState is returned when a login state was tampered with, was
+// signed with another key, or has expired.
+var ErrInvalidLoginState = errors.New("invalid login state")
+
+// stateSignaturePrefix separates login state signatures from other HMACs that
+// are computed with the same secret.
+const stateSignaturePrefix = "mstudio-ext-proxy/oidc-state:"
+
+// LoginState is the state that needs to be remembered between redirecting the
+// user to the provider and handling the callback. It is stored in a cookie, so
+// it is signed to prevent users from changing it (like the instance that the
+// session is bound to).
+type LoginState struct {
+	AuthorizationRequest
+	InstanceID string    `json:"instanceId"`
+	Expires    time.Time `json:"expires"`
+}
+
+// Encode serializes and signs the login state.
+func (s LoginState) Encode(secret []byte) (string, error) {
+	payload, err := json.Marshal(s)
+	if err != nil {
+		return "", err
+	}
+
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(signState(secret, encoded)), nil
+}
+
+// DecodeLoginState verifies the signature and expiry of an encoded login state.
+func DecodeLoginState(secret []byte, value string) (LoginState, error) {
+	encoded, signature, ok := strings.Cut(value, ".")
+	if !ok {
+		return LoginState{}, ErrInvalidLoginState
+	}
+
+	decodedSignature, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(decodedSignature, signState(secret, encoded)) {
+		return LoginState{}, ErrInvalidLoginState
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return LoginState{}, ErrInvalidLoginState
+	}
+
+	var state LoginState
+	if err := json.Unmarshal(payload, &state); err != nil {
+		return LoginState{}, ErrInvalidLoginState
+	}
+
+	if time.Now().After(state.Expires) {
+		return LoginState{}, ErrInvalidLoginState
+	}
+
+	return state, nil
+}
+
+func signState(secret []byte, encoded string) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(stateSignaturePrefix))
+	mac.Write([]byte(encoded))
+	return mac.Sum(nil)
+}
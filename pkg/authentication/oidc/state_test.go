@@ -0,0 +1,78 @@
+package oidc_test
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/mittwald/mstudio-ext-proxy/pkg/authentication/oidc"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("LoginState", func() {
+	secret := []byte("secret")
+
+	var state oidc.LoginState
+
+	BeforeEach(func() {
+		authReq, err := oidc.NewAuthorizationRequest()
+		Expect(err).NotTo(HaveOccurred())
+
+		state = oidc.LoginState{
+			AuthorizationRequest: authReq,
+			InstanceID:           "instance",
+			Expires:              time.Now().Add(time.Minute),
+		}
+	})
+
+	It("should decode an encoded state", func() {
+		encoded, err := state.Encode(secret)
+		Expect(err).NotTo(HaveOccurred())
+
+		decoded, err := oidc.DecodeLoginState(secret, encoded)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(decoded.AuthorizationRequest).To(Equal(state.AuthorizationRequest))
+		Expect(decoded.InstanceID).To(Equal("instance"))
+	})
+
+	It("should reject a state with a modified instance", func() {
+		encoded, err := state.Encode(secret)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, signature, _ := strings.Cut(encoded, ".")
+
+		state.InstanceID = "other-instance"
+		payload, err := json.Marshal(state)
+		Expect(err).NotTo(HaveOccurred())
+
+		forged := base64.RawURLEncoding.EncodeToString(payload) + "." + signature
+
+		_, err = oidc.DecodeLoginState(secret, forged)
+		Expect(err).To(MatchError(oidc.ErrInvalidLoginState))
+	})
+
+	It("should reject a state signed with another secret", func() {
+		encoded, err := state.Encode([]byte("other-secret"))
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = oidc.DecodeLoginState(secret, encoded)
+		Expect(err).To(MatchError(oidc.ErrInvalidLoginState))
+	})
+
+	It("should reject an expired state", func() {
+		state.Expires = time.Now().Add(-time.Second)
+
+		encoded, err := state.Encode(secret)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = oidc.DecodeLoginState(secret, encoded)
+		Expect(err).To(MatchError(oidc.ErrInvalidLoginState))
+	})
+
+	It("should reject an unsigned state", func() {
+		_, err := oidc.DecodeLoginState(secret, "state:nonce:verifier:instance")
+		Expect(err).To(MatchError(oidc.ErrInvalidLoginState))
+	})
+})
@@ -3,8 +3,48 @@ package authentication
 import "time"
 
 type Options struct {
-	CookieName     string
+	CookieName string
+
+	// CookiePaths are the paths for which the session cookie is set; if
+	// empty, it is set for "/". When multiple extensions are served, the
+	// cookie is restricted to the paths of one extension, so that it is not
+	// sent along with requests to the other extensions.
+	CookiePaths []string
+
 	CookieTTL      time.Duration
 	JWTSecret      []byte
 	StaticPassword string
+	StaticUsers    StaticUserList
+
+	// BasePath is the path under which the authentication endpoints are
+	// mounted (for example, "/mstudio" or "/mstudio/{extension}").
+	BasePath string
+
+	// HomeURL is the URL that users are redirected to after logging in.
+	HomeURL string
+
+	// ExtensionID restricts sessions to instances of a specific extension.
+	// This is set when multiple extensions are served from one deployment.
+	ExtensionID string
+}
+
+// PasswordAuthenticationEnabled returns true if either a static password or a
+// static user list is configured.
+func (o Options) PasswordAuthenticationEnabled() bool {
+	return o.StaticPassword != "" || len(o.StaticUsers) > 0
+}
+
+// AllowsExtension returns true if sessions for instances of the given extension
+// may be used with these options.
+func (o Options) AllowsExtension(extensionID string) bool {
+	return o.ExtensionID == "" || o.ExtensionID == extensionID
+}
+
+// SessionCookiePaths returns the paths for which the session cookie is set.
+func (o Options) SessionCookiePaths() []string {
+	if len(o.CookiePaths) == 0 {
+		return []string{"/"}
+	}
+
+	return o.CookiePaths
 }
@@ -0,0 +1,78 @@
+package authentication
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var ErrPasswordMismatch = errors.New("password does not match")
+
+// ComparePasswordHash compares a plaintext password against a password hash.
+// Supported are bcrypt hashes (as generated by "htpasswd -B") and argon2i or
+// argon2id hashes in the PHC string format (as generated by the "argon2" CLI).
+func ComparePasswordHash(hash, password string) error {
+	switch {
+	case strings.HasPrefix(hash, "$2a$"), strings.HasPrefix(hash, "$2b$"), strings.HasPrefix(hash, "$2y$"):
+		if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)); err != nil {
+			return ErrPasswordMismatch
+		}
+		return nil
+	case strings.HasPrefix(hash, "$argon2id$"), strings.HasPrefix(hash, "$argon2i$"):
+		return compareArgon2Hash(hash, password)
+	default:
+		return fmt.Errorf("unsupported password hash format")
+	}
+}
+
+// compareArgon2Hash verifies a hash in the format
+// "$argon2id$v=19$m=65536,t=3,p=4$<salt>$<key>".
+func compareArgon2Hash(hash, password string) error {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 {
+		return fmt.Errorf("invalid argon2 hash")
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return fmt.Errorf("invalid argon2 hash version: %w", err)
+	}
+
+	if version != argon2.Version {
+		return fmt.Errorf("unsupported argon2 version %d", version)
+	}
+
+	var memory, iterations uint32
+	var threads uint8
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &iterations, &threads); err != nil {
+		return fmt.Errorf("invalid argon2 hash parameters: %w", err)
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return fmt.Errorf("invalid argon2 salt: %w", err)
+	}
+
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return fmt.Errorf("invalid argon2 key: %w", err)
+	}
+
+	var computed []byte
+	if parts[1] == "argon2id" {
+		computed = argon2.IDKey([]byte(password), salt, iterations, memory, threads, uint32(len(key)))
+	} else {
+		computed = argon2.Key([]byte(password), salt, iterations, memory, threads, uint32(len(key)))
+	}
+
+	if subtle.ConstantTimeCompare(computed, key) != 1 {
+		return ErrPasswordMismatch
+	}
+
+	return nil
+}
@@ -0,0 +1,124 @@
+package authentication
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+var ErrInvalidCredentials = errors.New("invalid username or password")
+
+// dummyPasswordHash is compared against when an unknown user name is given,
+// so that the response time does not reveal which user names exist.
+const dummyPasswordHash = "$2a$10$FgHr42q7wogGEJFdFq2BX.NxfySchETXoBbNzcE6wVnuNsE5yCYby"
+
+// StaticUser is a single entry of the static user file. Each entry maps a
+// login name and password hash to a fixed identity that is bound to exactly one
+// extension instance.
+type StaticUser struct {
+	Username     string
+	PasswordHash string
+	UserID       string
+	InstanceID   string
+	Email        string
+	FirstName    string
+	LastName     string
+}
+
+type StaticUserList []StaticUser
+
+// LoadStaticUsersFromFile reads a static user file from the given path. See
+// ParseStaticUsers for the file format.
+func LoadStaticUsersFromFile(path string) (StaticUserList, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening static user file: %w", err)
+	}
+
+	defer f.Close()
+
+	return ParseStaticUsers(f)
+}
+
+// ParseStaticUsers parses an htpasswd-style user file. Each non-empty line that
+// does not start with a "#" describes one user, with the fields separated by
+// colons:
+//
+//	username:password-hash:user-id:instance-id:email:first-name:last-name
+//
+// The password hash may be a bcrypt hash or an argon2 hash in PHC string format.
+func ParseStaticUsers(r io.Reader) (StaticUserList, error) {
+	users := make(StaticUserList, 0)
+	seen := make(map[string]struct{})
+	scanner := bufio.NewScanner(r)
+	lineNo := 0
+
+	for scanner.Scan() {
+		lineNo++
+
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Split(line, ":")
+		if len(fields) != 7 {
+			return nil, fmt.Errorf("line %d: expected 7 colon-separated fields, got %d", lineNo, len(fields))
+		}
+
+		user := StaticUser{
+			Username:     fields[0],
+			PasswordHash: fields[1],
+			UserID:       fields[2],
+			InstanceID:   fields[3],
+			Email:        fields[4],
+			FirstName:    fields[5],
+			LastName:     fields[6],
+		}
+
+		if user.Username == "" || user.PasswordHash == "" || user.UserID == "" || user.InstanceID == "" {
+			return nil, fmt.Errorf("line %d: username, password hash, user ID and instance ID must not be empty", lineNo)
+		}
+
+		if _, ok := seen[user.Username]; ok {
+			return nil, fmt.Errorf("line %d: duplicate user '%s'", lineNo, user.Username)
+		}
+
+		seen[user.Username] = struct{}{}
+		users = append(users, user)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading static user file: %w", err)
+	}
+
+	return users, nil
+}
+
+// Authenticate looks up a user by name and verifies the given password. The
+// lookup always iterates over all entries and performs a hash comparison even
+// for unknown users, in order to not leak any information via timing.
+func (l StaticUserList) Authenticate(username, password string) (*StaticUser, error) {
+	var match *StaticUser
+
+	for i := range l {
+		if subtle.ConstantTimeCompare([]byte(l[i].Username), []byte(username)) == 1 {
+			match = &l[i]
+		}
+	}
+
+	if match == nil {
+		_ = ComparePasswordHash(dummyPasswordHash, password)
+		return nil, ErrInvalidCredentials
+	}
+
+	if err := ComparePasswordHash(match.PasswordHash, password); err != nil {
+		return nil, ErrInvalidCredentials
+	}
+
+	return match, nil
+}
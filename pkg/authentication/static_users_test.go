@@ -0,0 +1,59 @@
+package authentication_test
+
+import (
+	"strings"
+
+	"github.com/mittwald/mstudio-ext-proxy/pkg/authentication"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+const userFile = `
+# username:hash:user-id:instance-id:email:first-name:last-name
+support:$2a$04$Raki9Beb4WBLgtT5Psc9Ne9DRQTIP0KgI54pauylxnWnKTApUIe/G:b4c2a2b4-bb0a-4a43-8d15-93f83e1a33f6:848821a6-7bbb-4b15-a267-7b67e14e5a27:support@example.com:Support:Team
+qa:$argon2id$v=19$m=8192,t=1,p=1$c29tZXNhbHRzb21lc2FsdA$kd8QtX9YfpJ3Ypvdo6eRh/rKy4u3NldwjX8scATqzOc:6d2b1e8e-8f4e-4d0b-9a43-0b0d6ee3f3c1:848821a6-7bbb-4b15-a267-7b67e14e5a27:qa@example.com:Quality:Assurance
+`
+
+var _ = Describe("StaticUserList", func() {
+	var users authentication.StaticUserList
+
+	BeforeEach(func() {
+		var err error
+		users, err = authentication.ParseStaticUsers(strings.NewReader(userFile))
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("should parse all entries", func() {
+		Expect(users).To(HaveLen(2))
+		Expect(users[0].Username).To(Equal("support"))
+		Expect(users[0].Email).To(Equal("support@example.com"))
+		Expect(users[1].LastName).To(Equal("Assurance"))
+	})
+
+	It("should authenticate users with bcrypt hashes", func() {
+		user, err := users.Authenticate("support", "secret1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(user.UserID).To(Equal("b4c2a2b4-bb0a-4a43-8d15-93f83e1a33f6"))
+	})
+
+	It("should authenticate users with argon2 hashes", func() {
+		user, err := users.Authenticate("qa", "secret2")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(user.UserID).To(Equal("6d2b1e8e-8f4e-4d0b-9a43-0b0d6ee3f3c1"))
+	})
+
+	It("should reject invalid passwords", func() {
+		_, err := users.Authenticate("qa", "secret1")
+		Expect(err).To(MatchError(authentication.ErrInvalidCredentials))
+	})
+
+	It("should reject unknown users", func() {
+		_, err := users.Authenticate("nobody", "secret1")
+		Expect(err).To(MatchError(authentication.ErrInvalidCredentials))
+	})
+
+	It("should reject malformed lines", func() {
+		_, err := authentication.ParseStaticUsers(strings.NewReader("foo:bar"))
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,18 @@
+package bootstrap
+
+import (
+	"github.com/mittwald/mstudio-ext-proxy/pkg/webhooks"
+)
+
+// BuildWebhookAllowlist builds the allowlist for the global webhook endpoint,
+// when multiple extensions are configured. Webhooks for any of the extensions
+// are accepted, but only with the contributor ID configured for the same
+// extension.
+func BuildWebhookAllowlist(extensions []Extension) webhooks.OriginVerifier {
+	set := make(webhooks.AllowlistSet, 0, len(extensions))
+	for _, extension := range extensions {
+		set = append(set, extension.Allowlist)
+	}
+
+	return set
+}
@@ -1,19 +1,34 @@
 package bootstrap
 
 import (
+	"errors"
+	"fmt"
 	"github.com/mittwald/mstudio-ext-proxy/pkg/authentication"
 	"time"
 )
 
-func BuildAuthenticationOptions(c *Config) authentication.Options {
+func BuildAuthenticationOptions(c *Config) (authentication.Options, error) {
 	if c.Secret == "" {
-		panic("MITTWALD_EXT_PROXY_SECRET must be set")
+		return authentication.Options{}, errors.New("MITTWALD_EXT_PROXY_SECRET must be set")
 	}
 
-	return authentication.Options{
+	opts := authentication.Options{
 		CookieName:     "mstudio_ext_session",
 		CookieTTL:      60 * time.Minute,
 		JWTSecret:      []byte(c.Secret),
 		StaticPassword: c.StaticPassword,
+		BasePath:       "/mstudio",
+		HomeURL:        "/",
 	}
+
+	if c.StaticUsersFile != "" {
+		users, err := authentication.LoadStaticUsersFromFile(c.StaticUsersFile)
+		if err != nil {
+			return authentication.Options{}, fmt.Errorf("error loading static users: %w", err)
+		}
+
+		opts.StaticUsers = users
+	}
+
+	return opts, nil
 }
@@ -1,6 +1,10 @@
 package bootstrap
 
 import (
+	"log/slog"
+	"slices"
+	"time"
+
 	"github.com/kelseyhightower/envconfig"
 	"github.com/mittwald/mstudio-ext-proxy/pkg/proxy"
 )
@@ -9,11 +13,153 @@ type Config struct {
 	MongoDBURI                string `envconfig:"mongodb_uri"`
 	Secret                    string `required:"true"`
 	StaticPassword            string `envconfig:"static_password"`
+	StaticUsersFile           string `envconfig:"static_users_file"`
 	MittwaldBaseURL           string `envconfig:"api_base_url"`
 	Context                   string
+	ExtensionIDs              []string `envconfig:"extension_ids"`
+	ContributorIDs            []string `envconfig:"contributor_ids"`
 	Upstreams                 proxy.ConfigurationCollection
-	RedirectOnUnauthenticated string `envconfig:"redirect_on_unauthenticated"`
-	LogHttpBodies             bool   `envconfig:"log_http_bodies"`
+	Extensions                ExtensionConfigCollection
+	RedirectOnUnauthenticated string               `envconfig:"redirect_on_unauthenticated"`
+	LogHttpBodies             bool                 `envconfig:"log_http_bodies"`
+	LoginThrottle             LoginThrottleConfig  `envconfig:"login"`
+	OIDC                      OIDCConfig           `envconfig:"oidc"`
+	Events                    EventsConfig         `envconfig:"events"`
+	WebhookQueue              WebhookQueueConfig   `envconfig:"webhook_queue"`
+	Webhooks                  WebhooksConfig       `envconfig:"webhooks"`
+	Reconciliation            ReconciliationConfig `envconfig:"reconcile"`
+	Server                    ServerConfig         `envconfig:"server"`
+	Admin                     AdminConfig          `envconfig:"admin"`
+	Tracing                   TracingConfig        `envconfig:"tracing"`
+	Log                       LogConfig            `envconfig:"log"`
+	AccessLog                 AccessLogConfig      `envconfig:"access_log"`
+}
+
+type LogConfig struct {
+	Level  slog.Level `envconfig:"level" default:"info"`
+	Format string     `envconfig:"format" default:"text"`
+}
+
+type AccessLogConfig struct {
+	// Format is "json", "logfmt", "combined" or "off" (or empty).
+	Format string `envconfig:"format" default:"logfmt"`
+
+	// Level is the level of the access log records; they are only written if
+	// this is not below the global log level.
+	Level slog.Level `envconfig:"level" default:"info"`
+
+	// RedactPaths contains regular expressions; matching parts of the request
+	// path are redacted.
+	RedactPaths []string `envconfig:"redact_paths"`
+
+	Headers       []string `envconfig:"headers"`
+	RedactHeaders []string `envconfig:"redact_headers"`
+}
+
+type TracingConfig struct {
+	// Exporter is either "otlp" (configured using the standard
+	// OTEL_EXPORTER_OTLP_* environment variables) or "stdout"; if empty,
+	// tracing is disabled.
+	Exporter    string  `envconfig:"exporter"`
+	ServiceName string  `envconfig:"service_name" default:"mstudio-ext-proxy"`
+	SampleRatio float64 `envconfig:"sample_ratio" default:"1"`
+}
+
+type AdminConfig struct {
+	// Addr is the address of the admin listener, which serves the metrics and
+	// the health endpoints (without the "/mstudio" prefix). If empty, no admin
+	// listener is started.
+	Addr string `envconfig:"addr"`
+}
+
+type ServerConfig struct {
+	ReadHeaderTimeout time.Duration `envconfig:"read_header_timeout" default:"10s"`
+	ReadTimeout       time.Duration `envconfig:"read_timeout" default:"1m"`
+	WriteTimeout      time.Duration `envconfig:"write_timeout" default:"1m"`
+	IdleTimeout       time.Duration `envconfig:"idle_timeout" default:"2m"`
+
+	// ProxyTimeout limits the time for proxying a request to an upstream. The
+	// read and write timeouts only apply to the proxy's own endpoints.
+	ProxyTimeout time.Duration `envconfig:"proxy_timeout"`
+
+	// TrustedProxies contains the IP addresses or CIDR ranges of reverse proxies
+	// whose X-Forwarded-For headers are used to determine the client IP. If
+	// empty, the remote address of the connection is used.
+	TrustedProxies []string `envconfig:"trusted_proxies"`
+
+	// ShutdownDelay is the time between reporting the server as unready and
+	// closing the listener, so that load balancers can stop routing traffic.
+	ShutdownDelay time.Duration `envconfig:"shutdown_delay" default:"5s"`
+
+	// ShutdownTimeout is the time that in-flight requests (including streaming
+	// responses) are given to complete before their connections are closed.
+	ShutdownTimeout time.Duration `envconfig:"shutdown_timeout" default:"30s"`
+}
+
+type LoginThrottleConfig struct {
+	FreeAttempts       int           `envconfig:"free_attempts" default:"3"`
+	BaseDelay          time.Duration `envconfig:"base_delay" default:"1s"`
+	MaxDelay           time.Duration `envconfig:"max_delay" default:"5m"`
+	LockoutThreshold   int           `envconfig:"lockout_threshold" default:"10"`
+	LockoutDuration    time.Duration `envconfig:"lockout_duration" default:"15m"`
+	GlobalFreeAttempts int           `envconfig:"global_free_attempts" default:"100"`
+	Window             time.Duration `envconfig:"window" default:"1h"`
+}
+
+type OIDCConfig struct {
+	IssuerURL              string   `envconfig:"issuer_url"`
+	ClientID               string   `envconfig:"client_id"`
+	ClientSecret           string   `envconfig:"client_secret"`
+	RedirectURL            string   `envconfig:"redirect_url"`
+	Scopes                 []string `envconfig:"scopes" default:"openid,email,profile"`
+	InstanceID             string   `envconfig:"instance_id"`
+	AllowInstanceSelection bool     `envconfig:"allow_instance_selection"`
+	ClaimUserID            string   `envconfig:"claim_user_id"`
+	ClaimEmail             string   `envconfig:"claim_email"`
+	ClaimFirstName         string   `envconfig:"claim_first_name"`
+	ClaimLastName          string   `envconfig:"claim_last_name"`
+}
+
+type EventsConfig struct {
+	Targets     []string      `envconfig:"targets"`
+	Secret      string        `envconfig:"secret"`
+	MaxAttempts int           `envconfig:"max_attempts" default:"20"`
+	BaseDelay   time.Duration `envconfig:"base_delay" default:"10s"`
+	MaxDelay    time.Duration `envconfig:"max_delay" default:"1h"`
+}
+
+type WebhookQueueConfig struct {
+	Workers     int           `envconfig:"workers" default:"2"`
+	MaxAttempts int           `envconfig:"max_attempts" default:"10"`
+	BaseDelay   time.Duration `envconfig:"base_delay" default:"5s"`
+	MaxDelay    time.Duration `envconfig:"max_delay" default:"30m"`
+}
+
+type WebhooksConfig struct {
+	RedeliveryWindow    time.Duration `envconfig:"redelivery_window" default:"24h"`
+	KeyCacheTTL         time.Duration `envconfig:"key_cache_ttl" default:"24h"`
+	KeyCacheNegativeTTL time.Duration `envconfig:"key_cache_negative_ttl" default:"1m"`
+	KeyLookupRate       float64       `envconfig:"key_lookup_rate" default:"1"`
+	KeyLookupBurst      int           `envconfig:"key_lookup_burst" default:"10"`
+	PreloadKeySerials   []string      `envconfig:"preload_key_serials"`
+	PublicKeys          string        `envconfig:"public_keys"`
+	PublicKeysFile      string        `envconfig:"public_keys_file"`
+	Offline             bool          `envconfig:"offline"`
+}
+
+type ReconciliationConfig struct {
+	APIToken string        `envconfig:"api_token"`
+	Interval time.Duration `envconfig:"interval" default:"1h"`
+}
+
+// AllExtensionIDs returns the IDs of all extensions served by this proxy.
+func (c *Config) AllExtensionIDs() []string {
+	ids := slices.Clone(c.ExtensionIDs)
+	for _, ec := range c.Extensions {
+		ids = append(ids, ec.ExtensionID)
+	}
+
+	return ids
 }
 
 func ConfigFromEnv() *Config {
@@ -0,0 +1,34 @@
+package bootstrap
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/mittwald/mstudio-ext-proxy/pkg/domain/repository"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/domain/service"
+)
+
+// BuildEventDispatcher builds the dispatcher for lifecycle events. The events
+// are signed with a dedicated secret, since upstream applications need to know
+// it, and must not be able to forge session tokens with it.
+func BuildEventDispatcher(c *Config, r repository.OutboxRepository, l *slog.Logger) (*service.EventDispatcher, error) {
+	if c.Events.Secret == "" {
+		return nil, errors.New("MITTWALD_EXT_PROXY_EVENTS_SECRET is required when MITTWALD_EXT_PROXY_EVENTS_TARGETS is set")
+	}
+
+	if c.Events.Secret == c.Secret {
+		return nil, errors.New("MITTWALD_EXT_PROXY_EVENTS_SECRET must differ from MITTWALD_EXT_PROXY_SECRET")
+	}
+
+	opts := service.EventDispatcherOptions{
+		Secret:       []byte(c.Events.Secret),
+		PollInterval: 1 * time.Second,
+		BaseDelay:    c.Events.BaseDelay,
+		MaxDelay:     c.Events.MaxDelay,
+		MaxAttempts:  c.Events.MaxAttempts,
+	}
+
+	return service.NewEventDispatcher(r, &http.Client{Timeout: 30 * time.Second}, opts, l), nil
+}
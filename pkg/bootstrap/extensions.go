@@ -0,0 +1,176 @@
+package bootstrap
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/mittwald/mstudio-ext-proxy/pkg/authentication"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/proxy"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/webhooks"
+)
+
+var extensionNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+
+// reservedExtensionNames are names that would collide with the global
+// endpoints below "/mstudio".
+var reservedExtensionNames = []string{"auth", "webhooks"}
+
+// ExtensionConfig configures one of multiple extensions that are served from
+// the same deployment.
+type ExtensionConfig struct {
+	ExtensionID   string                        `json:"extensionId"`
+	ContributorID string                        `json:"contributorId"`
+	HomeURL       string                        `json:"homeUrl"`
+	Upstreams     proxy.ConfigurationCollection `json:"upstreams"`
+}
+
+// ExtensionConfigCollection maps URL-safe extension names to their
+// configuration.
+type ExtensionConfigCollection map[string]ExtensionConfig
+
+func (ec *ExtensionConfigCollection) Decode(value string) error {
+	if err := json.Unmarshal([]byte(value), &ec); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Extension contains everything that is specific to one extension served by
+// this proxy.
+type Extension struct {
+	// Name is the URL-safe name of the extension; it is empty if the proxy
+	// serves a single extension.
+	Name                  string
+	AuthenticationOptions authentication.Options
+	Allowlist             *webhooks.Allowlist
+	Upstreams             proxy.ConfigurationCollection
+}
+
+// BuildExtensions returns the extensions that are served by this proxy. If no
+// extensions are configured explicitly, a single extension is built from the
+// top-level configuration; the endpoints of this extension are mounted
+// directly below "/mstudio".
+func BuildExtensions(c *Config, authOptions authentication.Options) ([]Extension, error) {
+	if len(c.Extensions) == 0 {
+		return []Extension{{
+			AuthenticationOptions: authOptions,
+			Allowlist:             &webhooks.Allowlist{ExtensionIDs: c.ExtensionIDs, ContributorIDs: c.ContributorIDs},
+			Upstreams:             c.Upstreams,
+		}}, nil
+	}
+
+	if len(c.Upstreams) > 0 {
+		return nil, errors.New("MITTWALD_EXT_PROXY_UPSTREAMS must not be set when MITTWALD_EXT_PROXY_EXTENSIONS is used")
+	}
+
+	// The OIDC redirect URL is configured globally, so additional
+	// authentication providers cannot be bound to one of several extensions.
+	if c.OIDC.IssuerURL != "" {
+		return nil, errors.New("MITTWALD_EXT_PROXY_OIDC_* must not be set when MITTWALD_EXT_PROXY_EXTENSIONS is used")
+	}
+
+	names := make([]string, 0, len(c.Extensions))
+	for name := range c.Extensions {
+		names = append(names, name)
+	}
+
+	slices.Sort(names)
+
+	if err := checkUpstreamPrefixes(names, c.Extensions); err != nil {
+		return nil, err
+	}
+
+	extensions := make([]Extension, 0, len(names))
+	for _, name := range names {
+		ec := c.Extensions[name]
+
+		if !extensionNamePattern.MatchString(name) || slices.Contains(reservedExtensionNames, name) {
+			return nil, fmt.Errorf("invalid extension name '%s'", name)
+		}
+
+		if ec.ExtensionID == "" {
+			return nil, fmt.Errorf("extension '%s' has no extension ID", name)
+		}
+
+		opts := authOptions
+		opts.CookieName = authOptions.CookieName + "_" + name
+		opts.BasePath = authOptions.BasePath + "/" + name
+		opts.ExtensionID = ec.ExtensionID
+		opts.CookiePaths = extensionCookiePaths(opts.BasePath, ec.Upstreams)
+
+		if ec.HomeURL != "" {
+			opts.HomeURL = ec.HomeURL
+		}
+
+		allowlist := webhooks.Allowlist{ExtensionIDs: []string{ec.ExtensionID}}
+		if ec.ContributorID != "" {
+			allowlist.ContributorIDs = []string{ec.ContributorID}
+		}
+
+		extensions = append(extensions, Extension{
+			Name:                  name,
+			AuthenticationOptions: opts,
+			Allowlist:             &allowlist,
+			Upstreams:             ec.Upstreams,
+		})
+	}
+
+	return extensions, nil
+}
+
+// checkUpstreamPrefixes makes sure that the upstream prefixes of different
+// extensions are disjoint. Each request below a prefix carries the session
+// cookie of the extension that the prefix belongs to, so no prefix may be
+// (or contain) the prefix of another extension.
+func checkUpstreamPrefixes(names []string, extensions ExtensionConfigCollection) error {
+	owners := make(map[string]string)
+
+	for _, name := range names {
+		for prefix := range extensions[name].Upstreams {
+			normalized := prefix
+			if !strings.HasSuffix(normalized, "/") {
+				normalized += "/"
+			}
+
+			if owner, ok := owners[normalized]; ok {
+				return fmt.Errorf("upstream prefix '%s' of extension '%s' is already used by extension '%s'", prefix, name, owner)
+			}
+
+			for other, owner := range owners {
+				if owner != name && (strings.HasPrefix(normalized, other) || strings.HasPrefix(other, normalized)) {
+					return fmt.Errorf("upstream prefix '%s' of extension '%s' overlaps with prefix '%s' of extension '%s'", prefix, name, other, owner)
+				}
+			}
+
+			owners[normalized] = name
+		}
+	}
+
+	return nil
+}
+
+// extensionCookiePaths returns the paths that the session cookie of an
+// extension needs to be sent to: its own endpoints below "/mstudio/{name}" and
+// its upstreams.
+func extensionCookiePaths(basePath string, upstreams proxy.ConfigurationCollection) []string {
+	paths := []string{basePath}
+
+	for prefix := range upstreams {
+		path := strings.TrimSuffix(prefix, "/")
+		if path == "" {
+			path = "/"
+		}
+
+		if !slices.Contains(paths, path) {
+			paths = append(paths, path)
+		}
+	}
+
+	slices.Sort(paths[1:])
+	return paths
+}
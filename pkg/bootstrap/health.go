@@ -0,0 +1,101 @@
+package bootstrap
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/mittwald/mstudio-ext-proxy/pkg/domain/model"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/domain/repository"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/health"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/webhooks/webhookscommon"
+)
+
+// BuildHealthChecks builds the dependency checks reported by the readiness
+// endpoint: the storage connectivity, the upstreams that have a health check
+// path configured (including the upstreams selected by their routes), and the
+// availability of the webhook public keys listed in
+// MITTWALD_EXT_PROXY_WEBHOOKS_PRELOAD_KEY_SERIALS. Upstream checks are only
+// critical if this is configured for the upstream, since a single failing
+// upstream should not take the whole proxy out of service.
+func BuildHealthChecks(c *Config, repos Repositories, extensions []Extension, keyProvider webhookscommon.KeyProvider, httpClient *http.Client) []health.Check {
+	var checks []health.Check
+
+	if repos.Ping != nil {
+		checks = append(checks, health.Check{Name: "storage", Critical: true, Func: repos.Ping})
+	}
+
+	for _, extension := range extensions {
+		for prefix, upstream := range extension.Upstreams {
+			if upstream.HealthCheckPath == "" {
+				continue
+			}
+
+			checks = append(checks, health.Check{
+				Name:     "upstream:" + prefix,
+				Critical: upstream.HealthCheckCritical,
+				Func: func(ctx context.Context) error {
+					return upstream.CheckHealth(ctx, httpClient)
+				},
+			})
+
+			// The upstreams selected by routes depend on the instance, so they
+			// can only be checked for the instances of known extensions.
+			if len(upstream.Routes) == 0 || len(extension.Allowlist.ExtensionIDs) == 0 {
+				continue
+			}
+
+			checks = append(checks, health.Check{
+				Name:     "upstream:" + prefix + ":routes",
+				Critical: upstream.HealthCheckCritical,
+				Func: func(ctx context.Context) error {
+					instances, err := enabledInstances(ctx, repos.Instances, extension.Allowlist.ExtensionIDs)
+					if err != nil {
+						return err
+					}
+
+					return upstream.CheckRouteHealth(ctx, httpClient, instances)
+				},
+			})
+		}
+	}
+
+	// Unavailable webhook keys only affect webhook processing (which mStudio
+	// retries), so they should not take the proxy out of service.
+	if len(c.Webhooks.PreloadKeySerials) > 0 {
+		checks = append(checks, health.Check{
+			Name:     "webhook-keys",
+			Critical: false,
+			Func: func(ctx context.Context) error {
+				for _, serial := range c.Webhooks.PreloadKeySerials {
+					if _, err := keyProvider.PublicKeyForSerial(ctx, serial); err != nil {
+						return fmt.Errorf("error retrieving key '%s': %w", serial, err)
+					}
+				}
+
+				return nil
+			},
+		})
+	}
+
+	return checks
+}
+
+func enabledInstances(ctx context.Context, r repository.ExtensionInstanceRepository, extensionIDs []string) ([]model.ExtensionInstance, error) {
+	var out []model.ExtensionInstance
+
+	for _, extensionID := range extensionIDs {
+		instances, err := r.FindExtensionInstancesByExtensionID(ctx, extensionID)
+		if err != nil {
+			return nil, fmt.Errorf("error listing instances: %w", err)
+		}
+
+		for _, instance := range instances {
+			if instance.Enabled {
+				out = append(out, instance)
+			}
+		}
+	}
+
+	return out, nil
+}
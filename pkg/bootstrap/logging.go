@@ -0,0 +1,52 @@
+package bootstrap
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"regexp"
+
+	"github.com/mittwald/mstudio-ext-proxy/pkg/middleware"
+)
+
+// BuildLogger builds the application logger, which writes to w.
+func BuildLogger(c *Config, w io.Writer) (*slog.Logger, error) {
+	opts := slog.HandlerOptions{Level: c.Log.Level}
+
+	switch c.Log.Format {
+	case "", "text":
+		return slog.New(slog.NewTextHandler(w, &opts)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(w, &opts)), nil
+	default:
+		return nil, fmt.Errorf("unsupported MITTWALD_EXT_PROXY_LOG_FORMAT '%s'; expected 'text' or 'json'", c.Log.Format)
+	}
+}
+
+// BuildAccessLogger builds the access logger, which writes to w. If the access
+// log is disabled, this returns nil.
+func BuildAccessLogger(c *Config, w io.Writer) (*middleware.AccessLogger, error) {
+	if c.AccessLog.Format == "" || c.AccessLog.Format == "off" {
+		return nil, nil
+	}
+
+	redactPaths := make([]*regexp.Regexp, 0, len(c.AccessLog.RedactPaths))
+	for _, expr := range c.AccessLog.RedactPaths {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid MITTWALD_EXT_PROXY_ACCESS_LOG_REDACT_PATHS expression '%s': %w", expr, err)
+		}
+
+		redactPaths = append(redactPaths, re)
+	}
+
+	return middleware.NewAccessLogger(middleware.AccessLogOptions{
+		Format:        middleware.AccessLogFormat(c.AccessLog.Format),
+		Output:        w,
+		Level:         c.AccessLog.Level,
+		MinLevel:      c.Log.Level,
+		RedactPaths:   redactPaths,
+		Headers:       c.AccessLog.Headers,
+		RedactHeaders: c.AccessLog.RedactHeaders,
+	})
+}
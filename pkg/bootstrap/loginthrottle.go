@@ -0,0 +1,28 @@
+package bootstrap
+
+import (
+	"github.com/mittwald/mstudio-ext-proxy/pkg/domain/repository"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/domain/service"
+)
+
+func BuildLoginThrottleService(c *Config, r repository.LoginAttemptRepository) service.LoginThrottleService {
+	opts := service.LoginThrottleOptions{
+		PerIP: service.LoginThrottleLimits{
+			FreeAttempts:     c.LoginThrottle.FreeAttempts,
+			BaseDelay:        c.LoginThrottle.BaseDelay,
+			MaxDelay:         c.LoginThrottle.MaxDelay,
+			LockoutThreshold: c.LoginThrottle.LockoutThreshold,
+			LockoutDuration:  c.LoginThrottle.LockoutDuration,
+		},
+		// The global counter is never locked out completely (as that would lock
+		// out all users), but only slowed down.
+		Global: service.LoginThrottleLimits{
+			FreeAttempts: c.LoginThrottle.GlobalFreeAttempts,
+			BaseDelay:    c.LoginThrottle.BaseDelay,
+			MaxDelay:     c.LoginThrottle.MaxDelay,
+		},
+		Window: c.LoginThrottle.Window,
+	}
+
+	return service.NewLoginThrottleService(r, opts)
+}
@@ -2,24 +2,51 @@ package bootstrap
 
 import (
 	"context"
+	"log/slog"
+	"net/http"
+
 	"github.com/mittwald/api-client-go/mittwaldv2"
 	generatedv2 "github.com/mittwald/api-client-go/mittwaldv2/generated/clients"
-	"log/slog"
+	"github.com/mittwald/api-client-go/pkg/httpclient"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/middleware"
 )
 
-func BuildMittwaldAPIClientFromConfig(c *Config, l *slog.Logger) generatedv2.Client {
+func BuildMittwaldAPIClientFromConfig(c *Config, l *slog.Logger) (generatedv2.Client, error) {
+	return mittwaldv2.New(context.Background(), BuildMittwaldAPIClientOptions(c, l)...)
+}
+
+// BuildMittwaldAPIClientOptions returns the options shared by all mittwald API
+// clients, including those that are built for a specific user.
+func BuildMittwaldAPIClientOptions(c *Config, l *slog.Logger) []mittwaldv2.ClientOption {
 	opts := make([]mittwaldv2.ClientOption, 0)
 
 	if c.MittwaldBaseURL != "" {
 		opts = append(opts, mittwaldv2.WithBaseURL(c.MittwaldBaseURL))
 	}
 
+	opts = append(opts, withRequestID())
 	opts = append(opts, mittwaldv2.WithRequestLogging(l, c.LogHttpBodies, c.LogHttpBodies))
 
-	client, err := mittwaldv2.New(context.Background(), opts...)
-	if err != nil {
-		panic(err)
+	return opts
+}
+
+// withRequestID passes the ID of the request that caused an API call on to the
+// mittwald API, so that both can be correlated.
+func withRequestID() mittwaldv2.ClientOption {
+	return func(_ context.Context, inner httpclient.RequestRunner) (httpclient.RequestRunner, error) {
+		return &requestIDRunner{inner: inner}, nil
+	}
+}
+
+type requestIDRunner struct {
+	inner httpclient.RequestRunner
+}
+
+func (r *requestIDRunner) Do(req *http.Request) (*http.Response, error) {
+	if id := middleware.RequestIDFromContext(req.Context()); id != "" && req.Header.Get(middleware.RequestIDHeader) == "" {
+		req = req.Clone(req.Context())
+		req.Header.Set(middleware.RequestIDHeader, id)
 	}
 
-	return client
+	return r.inner.Do(req)
 }
@@ -1,10 +1,16 @@
 package bootstrap
 
 import (
+	"context"
+
+	"github.com/mittwald/mstudio-ext-proxy/pkg/persistence"
 	"go.mongodb.org/mongo-driver/v2/mongo"
 	"go.mongodb.org/mongo-driver/v2/mongo/options"
+	"go.mongodb.org/mongo-driver/v2/mongo/readpref"
 )
 
+const MongoDatabaseName = "mstudio_ext"
+
 func ConnectToMongodb(uri string) *mongo.Client {
 	opts := options.Client().
 		ApplyURI(uri).
@@ -16,3 +22,20 @@ func ConnectToMongodb(uri string) *mongo.Client {
 
 	return client
 }
+
+// BuildMongoRepositories builds MongoDB-backed repositories in the given
+// database.
+func BuildMongoRepositories(db *mongo.Database) Repositories {
+	return Repositories{
+		Instances:         persistence.NewMongoExtensionInstanceRepository(db.Collection("instances")),
+		Sessions:          persistence.MustNewMongoSessionRepository(db.Collection("sessions")),
+		LoginAttempts:     persistence.MustNewMongoLoginAttemptRepository(db.Collection("login_attempts")),
+		APIKeys:           persistence.NewMongoAPIKeyRepository(db.Collection("api_keys")),
+		WebhookDeliveries: persistence.MustNewMongoWebhookDeliveryRepository(db.Collection("webhook_deliveries")),
+		Outbox:            persistence.MustNewMongoOutboxRepository(db.Collection("event_outbox")),
+		WebhookQueue:      persistence.MustNewMongoWebhookQueueRepository(db.Collection("webhook_queue"), db.Collection("webhook_dead_letters")),
+		Ping: func(ctx context.Context) error {
+			return db.Client().Ping(ctx, readpref.Primary())
+		},
+	}
+}
@@ -0,0 +1,56 @@
+package bootstrap
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/mittwald/mstudio-ext-proxy/pkg/authentication"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/authentication/oidc"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/controller"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/domain/repository"
+)
+
+// BuildAuthenticationProviders builds all additional authentication providers
+// that are enabled in the configuration.
+func BuildAuthenticationProviders(
+	c *Config,
+	sessionRepository repository.SessionRepository,
+	instanceRepository repository.ExtensionInstanceRepository,
+	authOptions authentication.Options,
+	l *slog.Logger,
+) ([]controller.AuthenticationProvider, error) {
+	providers := make([]controller.AuthenticationProvider, 0)
+
+	if c.OIDC.IssuerURL != "" {
+		provider, err := oidc.NewProvider(context.Background(), oidc.Config{
+			IssuerURL:    c.OIDC.IssuerURL,
+			ClientID:     c.OIDC.ClientID,
+			ClientSecret: c.OIDC.ClientSecret,
+			RedirectURL:  c.OIDC.RedirectURL,
+			Scopes:       c.OIDC.Scopes,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error initializing OIDC provider: %w", err)
+		}
+
+		providers = append(providers, &controller.OIDCAuthenticationProvider{
+			Provider: provider,
+			ClaimMapping: oidc.ClaimMapping{
+				UserID:    c.OIDC.ClaimUserID,
+				Email:     c.OIDC.ClaimEmail,
+				FirstName: c.OIDC.ClaimFirstName,
+				LastName:  c.OIDC.ClaimLastName,
+			},
+			InstanceID:             c.OIDC.InstanceID,
+			AllowInstanceSelection: c.OIDC.AllowInstanceSelection,
+			SessionRepository:      sessionRepository,
+			InstanceRepository:     instanceRepository,
+			Development:            c.Context == "dev",
+			AuthenticationOptions:  authOptions,
+			Logger:                 l,
+		})
+	}
+
+	return providers, nil
+}
@@ -0,0 +1,33 @@
+package bootstrap
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/mittwald/api-client-go/mittwaldv2"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/domain/repository"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/domain/service"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/marketplace"
+)
+
+// BuildInstanceReconciler builds the instance reconciler, or returns nil if
+// reconciliation is not configured.
+func BuildInstanceReconciler(c *Config, r repository.ExtensionInstanceRepository, l *slog.Logger) (*service.InstanceReconciler, error) {
+	extensionIDs := c.AllExtensionIDs()
+
+	if c.Reconciliation.APIToken == "" || len(extensionIDs) == 0 {
+		return nil, nil
+	}
+
+	opts := append(BuildMittwaldAPIClientOptions(c, l), mittwaldv2.WithAccessToken(c.Reconciliation.APIToken))
+
+	client, err := mittwaldv2.New(context.Background(), opts...)
+	if err != nil {
+		return nil, fmt.Errorf("error building marketplace API client: %w", err)
+	}
+
+	lister := &marketplace.InstanceLister{Client: client}
+
+	return service.NewInstanceReconciler(lister, r, extensionIDs, l), nil
+}
@@ -0,0 +1,37 @@
+package bootstrap
+
+import (
+	"context"
+
+	"github.com/mittwald/mstudio-ext-proxy/pkg/domain/repository"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/persistence"
+)
+
+// Repositories bundles the persistence backends used by the proxy.
+type Repositories struct {
+	Instances         repository.ExtensionInstanceRepository
+	Sessions          repository.SessionRepository
+	LoginAttempts     repository.LoginAttemptRepository
+	APIKeys           repository.APIKeyRepository
+	WebhookDeliveries repository.WebhookDeliveryRepository
+	Outbox            repository.OutboxRepository
+	WebhookQueue      repository.WebhookQueueRepository
+
+	// Ping checks the connectivity to the storage backend; it may be nil for
+	// backends that cannot fail.
+	Ping func(ctx context.Context) error
+}
+
+// BuildMemoryRepositories builds in-memory repositories, which are intended
+// for tests and local development.
+func BuildMemoryRepositories() Repositories {
+	return Repositories{
+		Instances:         persistence.NewMemoryExtensionInstanceRepository(),
+		Sessions:          persistence.NewMemorySessionRepository(),
+		LoginAttempts:     persistence.NewMemoryLoginAttemptRepository(),
+		APIKeys:           persistence.NewMemoryAPIKeyRepository(),
+		WebhookDeliveries: persistence.NewMemoryWebhookDeliveryRepository(),
+		Outbox:            persistence.NewMemoryOutboxRepository(),
+		WebhookQueue:      persistence.NewMemoryWebhookQueueRepository(),
+	}
+}
@@ -1,13 +1,90 @@
 package bootstrap
 
 import (
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"time"
+
 	mittwaldv2 "github.com/mittwald/api-client-go/mittwaldv2/generated/clients"
 	"github.com/mittwald/mstudio-ext-proxy/pkg/webhooks/webhookscommon"
 )
 
-func BuildWebhookVerifier(client mittwaldv2.Client) *webhookscommon.Verifier {
-	keyProvider := webhookscommon.KeyProviderCache{Inner: &webhookscommon.KeyProviderMStudio{Client: client}}
-	webhookVerifier := webhookscommon.Verifier{KeyProvider: &keyProvider}
+func BuildWebhookVerifier(c *Config, client mittwaldv2.Client, l *slog.Logger) (*webhookscommon.Verifier, error) {
+	keyProvider, err := BuildWebhookKeyProvider(c, client, l)
+	if err != nil {
+		return nil, err
+	}
+
+	webhookVerifier := webhookscommon.Verifier{
+		KeyProvider: keyProvider,
+	}
+
+	return &webhookVerifier, nil
+}
+
+// BuildWebhookKeyProvider builds the provider for the public keys used to
+// verify webhook signatures. Statically configured keys take precedence over
+// keys fetched from the marketplace API; in offline mode, only the static keys
+// are used.
+func BuildWebhookKeyProvider(c *Config, client mittwaldv2.Client, l *slog.Logger) (webhookscommon.KeyProvider, error) {
+	staticKeys := make(map[string]ed25519.PublicKey)
+
+	if c.Webhooks.PublicKeys != "" {
+		keys, err := webhookscommon.ParseStaticKeys(c.Webhooks.PublicKeys)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing webhook public keys: %w", err)
+		}
+
+		maps.Copy(staticKeys, keys)
+	}
+
+	if c.Webhooks.PublicKeysFile != "" {
+		keys, err := webhookscommon.LoadKeysFromFile(c.Webhooks.PublicKeysFile)
+		if err != nil {
+			return nil, fmt.Errorf("error loading webhook public keys: %w", err)
+		}
+
+		maps.Copy(staticKeys, keys)
+	}
+
+	chain := webhookscommon.KeyProviderChain{}
+
+	if len(staticKeys) > 0 {
+		chain = append(chain, &webhookscommon.KeyProviderStatic{Keys: staticKeys})
+	}
+
+	if c.Webhooks.Offline {
+		if len(staticKeys) == 0 {
+			return nil, errors.New("offline mode requires MITTWALD_EXT_PROXY_WEBHOOKS_PUBLIC_KEYS or MITTWALD_EXT_PROXY_WEBHOOKS_PUBLIC_KEYS_FILE")
+		}
+
+		return chain, nil
+	}
+
+	apiKeyProvider := webhookscommon.KeyProviderCache{
+		Inner:       &webhookscommon.KeyProviderMStudio{Client: client},
+		TTL:         c.Webhooks.KeyCacheTTL,
+		NegativeTTL: c.Webhooks.KeyCacheNegativeTTL,
+		LookupRate:  c.Webhooks.KeyLookupRate,
+		LookupBurst: c.Webhooks.KeyLookupBurst,
+	}
+
+	if len(c.Webhooks.PreloadKeySerials) > 0 {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		if err := apiKeyProvider.Preload(ctx, c.Webhooks.PreloadKeySerials...); err != nil {
+			l.Warn("error preloading webhook public keys", "err", err)
+		}
+	}
+
+	if len(chain) == 0 {
+		return &apiKeyProvider, nil
+	}
 
-	return &webhookVerifier
+	return append(chain, &apiKeyProvider), nil
 }
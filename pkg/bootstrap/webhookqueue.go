@@ -0,0 +1,21 @@
+package bootstrap
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/mittwald/mstudio-ext-proxy/pkg/domain/repository"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/domain/service"
+)
+
+func BuildWebhookWorker(c *Config, r repository.WebhookQueueRepository, s service.WebhookService, l *slog.Logger) *service.WebhookWorker {
+	opts := service.WebhookWorkerOptions{
+		Concurrency:  c.WebhookQueue.Workers,
+		PollInterval: 1 * time.Second,
+		BaseDelay:    c.WebhookQueue.BaseDelay,
+		MaxDelay:     c.WebhookQueue.MaxDelay,
+		MaxAttempts:  c.WebhookQueue.MaxAttempts,
+	}
+
+	return service.NewWebhookWorker(r, s, opts, l)
+}
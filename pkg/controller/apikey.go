@@ -0,0 +1,121 @@
+package controller
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/authentication"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/domain/model"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/domain/service"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/httperr"
+)
+
+// APIKeyController allows logged-in users to manage personal API keys, which
+// are bound to their user and extension instance.
+type APIKeyController struct {
+	SessionService        service.SessionService
+	APIKeyService         service.APIKeyService
+	AuthenticationOptions authentication.Options
+	Logger                *slog.Logger
+}
+
+func (c *APIKeyController) HandleList(ctx *gin.Context) {
+	session, ok := c.requireSession(ctx)
+	if !ok {
+		return
+	}
+
+	keys, err := c.APIKeyService.ListPersonalAPIKeys(ctx, session)
+	if err != nil {
+		respondWithError(ctx, httperr.StatusForError(err), ErrorResponseFromErr("error listing API keys", err))
+		return
+	}
+
+	out := make([]APIKeyDTO, len(keys))
+	for i := range keys {
+		out[i] = APIKeyDTOFromModel(&keys[i])
+	}
+
+	ctx.JSON(http.StatusOK, out)
+}
+
+func (c *APIKeyController) HandleCreate(ctx *gin.Context) {
+	// Requiring a JSON body prevents cross-site form submissions, since
+	// browsers will not send JSON requests to other origins without a CORS
+	// preflight.
+	if ctx.ContentType() != "application/json" {
+		respondWithError(ctx, http.StatusUnsupportedMediaType, &ErrorResponse{Message: "expected JSON request body"})
+		return
+	}
+
+	session, ok := c.requireSession(ctx)
+	if !ok {
+		return
+	}
+
+	input := CreateAPIKeyInput{}
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		respondWithError(ctx, http.StatusBadRequest, ErrorResponseFromErr("invalid request body", err))
+		return
+	}
+
+	expires := time.Time{}
+	if input.Expires != nil {
+		expires = *input.Expires
+	}
+
+	key, token, err := c.APIKeyService.CreatePersonalAPIKey(ctx, session, input.Name, expires, input.Scopes)
+	if err != nil {
+		respondWithError(ctx, httperr.StatusForError(err), ErrorResponseFromErr("error creating API key", err))
+		return
+	}
+
+	c.Logger.InfoContext(ctx.Request.Context(), "created personal API key", "userID", session.UserID, "instanceID", session.Instance.ID, "keyID", key.ID)
+
+	ctx.JSON(http.StatusCreated, CreatedAPIKeyDTO{
+		APIKeyDTO: APIKeyDTOFromModel(key),
+		Token:     token,
+	})
+}
+
+func (c *APIKeyController) HandleRevoke(ctx *gin.Context) {
+	session, ok := c.requireSession(ctx)
+	if !ok {
+		return
+	}
+
+	if err := c.APIKeyService.RevokePersonalAPIKey(ctx, session, ctx.Param("id")); err != nil {
+		respondWithError(ctx, httperr.StatusForError(err), ErrorResponseFromErr("error revoking API key", err))
+		return
+	}
+
+	c.Logger.InfoContext(ctx.Request.Context(), "revoked personal API key", "userID", session.UserID, "instanceID", session.Instance.ID, "keyID", ctx.Param("id"))
+
+	ctx.Status(http.StatusNoContent)
+}
+
+// requireSession retrieves the session from the session cookie. API keys
+// cannot be used to manage other API keys.
+func (c *APIKeyController) requireSession(ctx *gin.Context) (*model.Session, bool) {
+	authCookie, err := ctx.Cookie(c.AuthenticationOptions.CookieName)
+	if err != nil {
+		respondWithError(ctx, http.StatusUnauthorized, &ErrorResponse{Message: "no session"})
+		return nil, false
+	}
+
+	sessionID, sessionSecret := model.SessionIDAndSecretFromCookieString(authCookie)
+	session, err := c.SessionService.RetrieveSession(ctx.Request.Context(), sessionID, sessionSecret)
+	if err != nil {
+		respondWithError(ctx, httperr.StatusForError(err), &ErrorResponse{Message: "no session"})
+		return nil, false
+	}
+
+	if !c.AuthenticationOptions.AllowsExtension(session.Instance.ExtensionID) {
+		respondWithError(ctx, http.StatusUnauthorized, &ErrorResponse{Message: "no session"})
+		return nil, false
+	}
+
+	return session, true
+}
@@ -0,0 +1,46 @@
+package controller
+
+import (
+	"time"
+
+	"github.com/mittwald/mstudio-ext-proxy/pkg/domain/model"
+)
+
+type APIKeyDTO struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	InstanceID string     `json:"instanceId"`
+	Scopes     []string   `json:"scopes,omitempty"`
+	Created    time.Time  `json:"created"`
+	Expires    *time.Time `json:"expires,omitempty"`
+	Expired    bool       `json:"expired"`
+}
+
+type CreatedAPIKeyDTO struct {
+	APIKeyDTO
+	Token string `json:"token"`
+}
+
+type CreateAPIKeyInput struct {
+	Name    string     `json:"name" binding:"required"`
+	Expires *time.Time `json:"expires"`
+	Scopes  []string   `json:"scopes"`
+}
+
+func APIKeyDTOFromModel(key *model.APIKey) APIKeyDTO {
+	dto := APIKeyDTO{
+		ID:         key.ID,
+		Name:       key.Name,
+		InstanceID: key.InstanceID,
+		Scopes:     key.Scopes,
+		Created:    key.Created,
+		Expired:    key.IsExpired(),
+	}
+
+	if !key.Expires.IsZero() {
+		expires := key.Expires
+		dto.Expires = &expires
+	}
+
+	return dto
+}
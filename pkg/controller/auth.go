@@ -1,10 +1,13 @@
 package controller
 
 import (
+	"context"
+	"crypto/subtle"
 	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
@@ -15,6 +18,15 @@ import (
 	"github.com/mittwald/mstudio-ext-proxy/pkg/domain/repository"
 	"github.com/mittwald/mstudio-ext-proxy/pkg/domain/service"
 	"github.com/mittwald/mstudio-ext-proxy/pkg/httperr"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/metrics"
+)
+
+// Login methods, as used in the metrics; additional authentication providers
+// use their name.
+const (
+	loginMethodOneClick = "oneclick"
+	loginMethodPassword = "password"
+	loginMethodFake     = "fake"
 )
 
 type UserAuthenticationController struct {
@@ -22,12 +34,14 @@ type UserAuthenticationController struct {
 	SessionRepository     repository.SessionRepository
 	SessionService        service.SessionService
 	InstanceRepository    repository.ExtensionInstanceRepository
+	LoginThrottleService  service.LoginThrottleService
 	Development           bool
 	AuthenticationOptions authentication.Options
 	Logger                *slog.Logger
 }
 
 type PasswordFormInput struct {
+	Username string `form:"username"`
 	Password string `form:"password"`
 }
 
@@ -36,95 +50,213 @@ func (c *UserAuthenticationController) HandleAuthenticationRequest(ctx *gin.Cont
 
 	userID, instanceID, atrek, err := extractAuthenticationParamsFromRequest(ctx.Request)
 	if err != nil {
-		l.Error("failed to extract authentication parameters", "error", err)
-		ctx.JSON(http.StatusBadRequest, ErrorResponseFromErr("could not retrieve instance", err))
+		l.ErrorContext(ctx.Request.Context(), "failed to extract authentication parameters", "error", err)
+		respondWithError(ctx, http.StatusBadRequest, ErrorResponseFromErr("could not retrieve instance", err))
 		return
 	}
 
 	l = l.With("userID", userID, "instanceID", instanceID)
 
-	session, err := c.SessionService.InitializeSessionFromRetrievalKey(ctx, atrek, userID, instanceID)
+	if c.AuthenticationOptions.ExtensionID != "" {
+		instance, err := c.InstanceRepository.FindExtensionInstanceByID(ctx, instanceID)
+		if err != nil {
+			l.ErrorContext(ctx.Request.Context(), "failed to retrieve instance", "error", err)
+			respondWithError(ctx, http.StatusNotFound, ErrorResponseFromErr("could not retrieve instance", err))
+			return
+		}
+
+		if !c.AuthenticationOptions.AllowsExtension(instance.ExtensionID) {
+			l.WarnContext(ctx.Request.Context(), "rejecting login for instance of another extension", "extensionID", instance.ExtensionID)
+			respondWithError(ctx, http.StatusForbidden, &ErrorResponse{Message: "instance belongs to another extension"})
+			return
+		}
+	}
+
+	session, err := c.SessionService.InitializeSessionFromRetrievalKey(ctx.Request.Context(), atrek, userID, instanceID)
 	if err != nil {
-		l.Error("failed to create session", "error", err)
-		ctx.JSON(httperr.StatusForError(err), ErrorResponseFromErr("error initializing session", err))
+		l.ErrorContext(ctx.Request.Context(), "failed to create session", "error", err)
+		metrics.Logins.WithLabelValues(loginMethodOneClick, metrics.ResultFailure).Inc()
+		respondWithError(ctx, httperr.StatusForError(err), ErrorResponseFromErr("error initializing session", err))
 		return
 	}
 
-	if c.Development {
-		ctx.SetCookie(c.AuthenticationOptions.CookieName, session.CookieString(), 0, "/", "", false, false)
-	} else {
-		ctx.SetCookie(c.AuthenticationOptions.CookieName, session.CookieString(), 0, "/", "", true, true)
-	}
+	setSessionCookie(ctx, c.AuthenticationOptions, session.CookieString(), 0, !c.Development)
 
-	ctx.Redirect(http.StatusSeeOther, "/")
+	metrics.Logins.WithLabelValues(loginMethodOneClick, metrics.ResultSuccess).Inc()
+
+	ctx.Redirect(http.StatusSeeOther, c.AuthenticationOptions.HomeURL)
 }
 
 func (c *UserAuthenticationController) HandlePasswordAuthentication(ctx *gin.Context) {
-	if ctx.Request.Method == http.MethodPost {
-		input := PasswordFormInput{}
-		if err := ctx.Bind(&input); err != nil {
-			ctx.String(http.StatusBadRequest, "missing 'password' parameter")
+	if ctx.Request.Method != http.MethodPost {
+		c.renderLoginForm(ctx, http.StatusOK, "")
+		return
+	}
+
+	if !verifyCSRFToken(ctx) {
+		c.Logger.WarnContext(ctx.Request.Context(), "rejected password login with invalid CSRF token", "remoteAddr", ctx.ClientIP())
+		c.renderLoginForm(ctx, http.StatusForbidden, "Your login form has expired. Please try again.")
+		return
+	}
+
+	clientIP := ctx.ClientIP()
+
+	// The attempt is counted before the credentials are verified, so that
+	// concurrent requests cannot exceed the allowed number of attempts.
+	if err := c.LoginThrottleService.RegisterLoginAttempt(ctx, clientIP); err != nil {
+		if throttled := new(service.LoginThrottledError); errors.As(err, &throttled) {
+			c.Logger.WarnContext(ctx.Request.Context(), "throttled password login", "remoteAddr", clientIP, "retryAfter", throttled.RetryAfter)
+			metrics.Logins.WithLabelValues(loginMethodPassword, "throttled").Inc()
+			ctx.Header("Retry-After", strconv.Itoa(int(throttled.RetryAfter.Seconds())+1))
+			c.renderLoginForm(ctx, http.StatusTooManyRequests, "Too many failed login attempts. Please try again later.")
 			return
 		}
 
-		if input.Password == c.AuthenticationOptions.StaticPassword {
-			session, err := c.buildFakeSession()
-			if err != nil {
-				ctx.String(http.StatusInternalServerError, "error initializing session")
-				return
-			}
+		respondWithError(ctx, http.StatusInternalServerError, ErrorResponseFromErr("error registering login attempt", err))
+		return
+	}
 
-			if err := c.SessionRepository.CreateSessionWithUnhashedSecret(ctx, session); err != nil {
-				ctx.JSON(http.StatusInternalServerError, ErrorResponseFromErr("error initializing session", err))
-				return
-			}
+	input := PasswordFormInput{}
+	if err := ctx.Bind(&input); err != nil {
+		ctx.String(http.StatusBadRequest, "missing 'password' parameter")
+		return
+	}
 
-			ctx.SetCookie(c.AuthenticationOptions.CookieName, session.CookieString(), 3600, "/", "", false, false)
-			ctx.Redirect(http.StatusSeeOther, "/")
-			return
+	session, err := c.buildPasswordSession(ctx, input)
+	if errors.Is(err, authentication.ErrInvalidCredentials) {
+		c.Logger.WarnContext(ctx.Request.Context(), "failed password login", "username", input.Username, "remoteAddr", clientIP)
+		metrics.Logins.WithLabelValues(loginMethodPassword, metrics.ResultFailure).Inc()
+
+		if err := c.LoginThrottleService.RegisterFailedLogin(ctx, clientIP); err != nil {
+			c.Logger.ErrorContext(ctx.Request.Context(), "error registering failed login attempt", "err", err)
 		}
+
+		c.renderLoginForm(ctx, http.StatusUnauthorized, "Invalid credentials")
+		return
+	}
+
+	if err != nil {
+		respondWithError(ctx, httperr.StatusForError(err), ErrorResponseFromErr("error initializing session", err))
+		return
+	}
+
+	if !c.AuthenticationOptions.AllowsExtension(session.Instance.ExtensionID) {
+		c.Logger.WarnContext(ctx.Request.Context(), "rejecting password login for instance of another extension", "username", input.Username, "instanceID", session.Instance.ID)
+		respondWithError(ctx, http.StatusForbidden, &ErrorResponse{Message: "instance belongs to another extension"})
+		return
+	}
+
+	if err := c.SessionRepository.CreateSessionWithUnhashedSecret(ctx, session); err != nil {
+		respondWithError(ctx, http.StatusInternalServerError, ErrorResponseFromErr("error initializing session", err))
+		return
 	}
 
-	ctx.HTML(http.StatusOK, "login.html", gin.H{
-		"LoginRoute": "/mstudio/auth/password",
+	if err := c.LoginThrottleService.RegisterSuccessfulLogin(ctx, clientIP); err != nil {
+		c.Logger.ErrorContext(ctx.Request.Context(), "error resetting failed login attempts", "err", err)
+	}
+
+	c.Logger.InfoContext(ctx.Request.Context(), "successful password login", "userID", session.UserID, "instanceID", session.Instance.ID)
+	metrics.Logins.WithLabelValues(loginMethodPassword, metrics.ResultSuccess).Inc()
+
+	setSessionCookie(ctx, c.AuthenticationOptions, session.CookieString(), int(c.AuthenticationOptions.CookieTTL.Seconds()), !c.Development)
+	ctx.Redirect(http.StatusSeeOther, c.AuthenticationOptions.HomeURL)
+}
+
+func (c *UserAuthenticationController) renderLoginForm(ctx *gin.Context, status int, errorMessage string) {
+	csrfToken, err := issueCSRFToken(ctx, c.AuthenticationOptions.BasePath+"/auth", !c.Development)
+	if err != nil {
+		respondWithError(ctx, http.StatusInternalServerError, ErrorResponseFromErr("error rendering login form", err))
+		return
+	}
+
+	ctx.HTML(status, "login.html", gin.H{
+		"LoginRoute":   c.AuthenticationOptions.BasePath + "/auth/password",
+		"WithUsername": len(c.AuthenticationOptions.StaticUsers) > 0,
+		"CSRFField":    csrfFormField,
+		"CSRFToken":    csrfToken,
+		"Error":        errorMessage,
 	})
 }
 
+// buildPasswordSession authenticates the submitted credentials. If a static
+// user list is configured, the session is built from the matching user's
+// identity; otherwise, the legacy static password is checked.
+func (c *UserAuthenticationController) buildPasswordSession(ctx context.Context, input PasswordFormInput) (model.Session, error) {
+	if len(c.AuthenticationOptions.StaticUsers) == 0 {
+		if subtle.ConstantTimeCompare([]byte(input.Password), []byte(c.AuthenticationOptions.StaticPassword)) != 1 {
+			return model.Session{}, authentication.ErrInvalidCredentials
+		}
+
+		return c.buildFakeSession()
+	}
+
+	user, err := c.AuthenticationOptions.StaticUsers.Authenticate(input.Username, input.Password)
+	if err != nil {
+		return model.Session{}, err
+	}
+
+	instance, err := c.InstanceRepository.FindExtensionInstanceByID(ctx, user.InstanceID)
+	if err != nil {
+		return model.Session{}, httperr.ErrWithStatus(http.StatusNotFound, "instance not found", fmt.Errorf("error getting instance %s: %w", user.InstanceID, err))
+	}
+
+	session, err := model.NewSession()
+	if err != nil {
+		return session, err
+	}
+
+	session.Expires = time.Now().Add(c.AuthenticationOptions.CookieTTL)
+	session.Email = user.Email
+	session.UserID = user.UserID
+	session.FirstName = user.FirstName
+	session.LastName = user.LastName
+	session.Instance = instance
+
+	return session, nil
+}
+
 // CAUTION: DO NOT USE IN PRODUCTION
 func (c *UserAuthenticationController) HandleFakeAuthentication(ctx *gin.Context) {
 	if !c.Development {
-		ctx.JSON(http.StatusForbidden, ErrorResponse{Message: "not available"})
+		respondWithError(ctx, http.StatusForbidden, &ErrorResponse{Message: "not available"})
 		return
 	}
 
 	session, err := c.buildFakeSession()
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, ErrorResponseFromErr("error initializing session", err))
+		respondWithError(ctx, http.StatusInternalServerError, ErrorResponseFromErr("error initializing session", err))
 		return
 	}
 
 	if err := c.SessionRepository.CreateSessionWithUnhashedSecret(ctx, session); err != nil {
-		ctx.JSON(http.StatusInternalServerError, ErrorResponseFromErr("error initializing session", err))
+		respondWithError(ctx, http.StatusInternalServerError, ErrorResponseFromErr("error initializing session", err))
 		return
 	}
 
-	ctx.SetCookie(c.AuthenticationOptions.CookieName, session.CookieString(), 3600, "/", "", false, false)
-	ctx.Redirect(http.StatusSeeOther, "/")
+	metrics.Logins.WithLabelValues(loginMethodFake, metrics.ResultSuccess).Inc()
+
+	setSessionCookie(ctx, c.AuthenticationOptions, session.CookieString(), 3600, false)
+	ctx.Redirect(http.StatusSeeOther, c.AuthenticationOptions.HomeURL)
 }
 
 func (c *UserAuthenticationController) HandleUserInfo(ctx *gin.Context) {
 	authCookie, err := ctx.Cookie(c.AuthenticationOptions.CookieName)
 	if err != nil {
 		if errors.Is(err, http.ErrNoCookie) {
-			ctx.JSON(http.StatusUnauthorized, ErrorResponse{Message: "no session"})
+			respondWithError(ctx, http.StatusUnauthorized, &ErrorResponse{Message: "no session"})
 			return
 		}
 	}
 
 	sessionID, sessionSecret := model.SessionIDAndSecretFromCookieString(authCookie)
-	session, err := c.SessionService.RetrieveSession(ctx, sessionID, sessionSecret)
+	session, err := c.SessionService.RetrieveSession(ctx.Request.Context(), sessionID, sessionSecret)
 	if err != nil {
-		ctx.JSON(httperr.StatusForError(err), ErrorResponse{Message: "no session"})
+		respondWithError(ctx, httperr.StatusForError(err), &ErrorResponse{Message: "no session"})
+		return
+	}
+
+	if !c.AuthenticationOptions.AllowsExtension(session.Instance.ExtensionID) {
+		respondWithError(ctx, http.StatusUnauthorized, &ErrorResponse{Message: "no session"})
 		return
 	}
 
@@ -149,6 +281,7 @@ func (c *UserAuthenticationController) buildFakeSession() (model.Session, error)
 	session.LastName = "Mustermann"
 	session.AccessToken = "fake-api-token"
 	session.Instance.ID = "848821a6-7bbb-4b15-a267-7b67e14e5a27"
+	session.Instance.ExtensionID = c.AuthenticationOptions.ExtensionID
 	session.Instance.Enabled = true
 	session.Instance.Context.Kind = "customer"
 	session.Instance.Context.ID = "4a30329f-3bb7-4871-b9e2-e4815718e74a"
@@ -180,3 +313,11 @@ func extractAuthenticationParamsFromRequest(req *http.Request) (userID, instance
 
 	return
 }
+
+// setSessionCookie sets the session cookie for each of the configured cookie
+// paths. Secure cookies are also HTTP-only.
+func setSessionCookie(ctx *gin.Context, opts authentication.Options, value string, maxAge int, secure bool) {
+	for _, path := range opts.SessionCookiePaths() {
+		ctx.SetCookie(opts.CookieName, value, maxAge, path, "", secure, secure)
+	}
+}
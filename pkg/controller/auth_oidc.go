@@ -0,0 +1,189 @@
+package controller
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/authentication"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/authentication/oidc"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/domain/model"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/domain/repository"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/httperr"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/metrics"
+)
+
+var _ AuthenticationProvider = &OIDCAuthenticationProvider{}
+
+const (
+	oidcStateCookieName = "mstudio_ext_oidc"
+	oidcStateTTL        = 10 * time.Minute
+)
+
+// OIDCAuthenticationProvider authenticates users (like support staff) at a
+// generic OpenID Connect identity provider. Since these users do not have an
+// mStudio identity, their sessions are bound to a configured extension
+// instance; optionally, the instance may be chosen at login by passing an
+// "instanceId" query parameter to the login endpoint.
+type OIDCAuthenticationProvider struct {
+	Provider               *oidc.Provider
+	ClaimMapping           oidc.ClaimMapping
+	InstanceID             string
+	AllowInstanceSelection bool
+	SessionRepository      repository.SessionRepository
+	InstanceRepository     repository.ExtensionInstanceRepository
+	Development            bool
+	AuthenticationOptions  authentication.Options
+	Logger                 *slog.Logger
+}
+
+func (p *OIDCAuthenticationProvider) Name() string {
+	return "oidc"
+}
+
+func (p *OIDCAuthenticationProvider) HandleLogin(ctx *gin.Context) {
+	instanceID := p.InstanceID
+	if selected := ctx.Query("instanceId"); selected != "" {
+		instanceID = selected
+	}
+
+	if instanceID == "" {
+		respondWithError(ctx, http.StatusBadRequest, &ErrorResponse{Message: "no instance configured; the 'instanceId' query parameter is required"})
+		return
+	}
+
+	if !p.allowsInstance(instanceID) {
+		respondWithError(ctx, http.StatusForbidden, &ErrorResponse{Message: "instance selection is not allowed"})
+		return
+	}
+
+	authReq, err := oidc.NewAuthorizationRequest()
+	if err != nil {
+		respondWithError(ctx, http.StatusInternalServerError, ErrorResponseFromErr("error initializing login", err))
+		return
+	}
+
+	loginState := oidc.LoginState{
+		AuthorizationRequest: authReq,
+		InstanceID:           instanceID,
+		Expires:              time.Now().Add(oidcStateTTL),
+	}
+
+	cookieValue, err := loginState.Encode(p.AuthenticationOptions.JWTSecret)
+	if err != nil {
+		respondWithError(ctx, http.StatusInternalServerError, ErrorResponseFromErr("error initializing login", err))
+		return
+	}
+
+	ctx.SetSameSite(http.SameSiteLaxMode)
+	ctx.SetCookie(oidcStateCookieName, cookieValue, int(oidcStateTTL.Seconds()), p.cookiePath(), "", !p.Development, true)
+	ctx.Redirect(http.StatusFound, p.Provider.AuthCodeURL(authReq))
+}
+
+func (p *OIDCAuthenticationProvider) HandleCallback(ctx *gin.Context) {
+	if errCode := ctx.Query("error"); errCode != "" {
+		p.Logger.WarnContext(ctx.Request.Context(), "OIDC login failed at identity provider", "error", errCode, "description", ctx.Query("error_description"))
+		metrics.Logins.WithLabelValues(p.Name(), metrics.ResultFailure).Inc()
+		respondWithError(ctx, http.StatusUnauthorized, &ErrorResponse{Message: "login failed", Details: errCode})
+		return
+	}
+
+	cookieValue, err := ctx.Cookie(oidcStateCookieName)
+	if err != nil {
+		respondWithError(ctx, http.StatusBadRequest, &ErrorResponse{Message: "missing login state; please retry the login"})
+		return
+	}
+
+	ctx.SetCookie(oidcStateCookieName, "", -1, p.cookiePath(), "", !p.Development, true)
+
+	loginState, err := oidc.DecodeLoginState(p.AuthenticationOptions.JWTSecret, cookieValue)
+	if err != nil {
+		respondWithError(ctx, http.StatusBadRequest, &ErrorResponse{Message: "invalid login state; please retry the login"})
+		return
+	}
+
+	if subtle.ConstantTimeCompare([]byte(loginState.State), []byte(ctx.Query("state"))) != 1 {
+		respondWithError(ctx, http.StatusBadRequest, &ErrorResponse{Message: "state mismatch; please retry the login"})
+		return
+	}
+
+	// The state is signed, but the configuration might have changed since the
+	// login was started.
+	if !p.allowsInstance(loginState.InstanceID) {
+		respondWithError(ctx, http.StatusForbidden, &ErrorResponse{Message: "instance selection is not allowed"})
+		return
+	}
+
+	session, err := p.buildSession(ctx, ctx.Query("code"), loginState.CodeVerifier, loginState.Nonce, loginState.InstanceID)
+	if err != nil {
+		p.Logger.WarnContext(ctx.Request.Context(), "OIDC login failed", "err", err)
+		metrics.Logins.WithLabelValues(p.Name(), metrics.ResultFailure).Inc()
+		respondWithError(ctx, httperr.StatusForError(err), ErrorResponseFromErr("error initializing session", err))
+		return
+	}
+
+	if err := p.SessionRepository.CreateSessionWithUnhashedSecret(ctx, session); err != nil {
+		respondWithError(ctx, http.StatusInternalServerError, ErrorResponseFromErr("error initializing session", err))
+		return
+	}
+
+	p.Logger.InfoContext(ctx.Request.Context(), "successful OIDC login", "userID", session.UserID, "instanceID", session.Instance.ID)
+	metrics.Logins.WithLabelValues(p.Name(), metrics.ResultSuccess).Inc()
+
+	ctx.SetSameSite(http.SameSiteDefaultMode)
+	setSessionCookie(ctx, p.AuthenticationOptions, session.CookieString(), 0, !p.Development)
+	ctx.Redirect(http.StatusSeeOther, p.AuthenticationOptions.HomeURL)
+}
+
+// allowsInstance returns true if sessions may be bound to the given instance:
+// either it is the configured instance, or instance selection is allowed.
+func (p *OIDCAuthenticationProvider) allowsInstance(instanceID string) bool {
+	return instanceID == p.InstanceID || p.AllowInstanceSelection
+}
+
+func (p *OIDCAuthenticationProvider) cookiePath() string {
+	return p.AuthenticationOptions.BasePath + "/auth/" + p.Name()
+}
+
+func (p *OIDCAuthenticationProvider) buildSession(ctx *gin.Context, code, codeVerifier, nonce, instanceID string) (model.Session, error) {
+	token, err := p.Provider.Exchange(ctx.Request.Context(), code, codeVerifier)
+	if err != nil {
+		return model.Session{}, httperr.ErrWithStatus(http.StatusUnauthorized, "invalid authorization code", err)
+	}
+
+	claims, err := p.Provider.VerifyIDToken(ctx.Request.Context(), token.IDToken, nonce)
+	if err != nil {
+		return model.Session{}, httperr.ErrWithStatus(http.StatusUnauthorized, "invalid ID token", err)
+	}
+
+	identity, err := p.ClaimMapping.Identity(claims)
+	if err != nil {
+		return model.Session{}, httperr.ErrWithStatus(http.StatusUnauthorized, "invalid ID token", err)
+	}
+
+	instance, err := p.InstanceRepository.FindExtensionInstanceByID(ctx, instanceID)
+	if err != nil {
+		return model.Session{}, httperr.ErrWithStatus(http.StatusNotFound, "instance not found", fmt.Errorf("error getting instance %s: %w", instanceID, err))
+	}
+
+	if !p.AuthenticationOptions.AllowsExtension(instance.ExtensionID) {
+		return model.Session{}, httperr.ErrWithStatus(http.StatusForbidden, "instance belongs to another extension", fmt.Errorf("instance %s is not an instance of extension %s", instanceID, p.AuthenticationOptions.ExtensionID))
+	}
+
+	session, err := model.NewSession()
+	if err != nil {
+		return session, err
+	}
+
+	session.Expires = time.Now().Add(p.AuthenticationOptions.CookieTTL)
+	session.UserID = identity.UserID
+	session.Email = identity.Email
+	session.FirstName = identity.FirstName
+	session.LastName = identity.LastName
+	session.Instance = instance
+
+	return session, nil
+}
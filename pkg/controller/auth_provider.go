@@ -0,0 +1,22 @@
+package controller
+
+import "github.com/gin-gonic/gin"
+
+// AuthenticationProvider is a pluggable login method that complements the
+// mStudio one-click authentication handled by UserAuthenticationController.
+// Each provider is mounted at "/mstudio/auth/{name}/login" and
+// "/mstudio/auth/{name}/callback".
+type AuthenticationProvider interface {
+	Name() string
+	HandleLogin(ctx *gin.Context)
+	HandleCallback(ctx *gin.Context)
+}
+
+// RegisterAuthenticationProviders mounts the login and callback routes of all
+// given providers.
+func RegisterAuthenticationProviders(rg gin.IRoutes, providers ...AuthenticationProvider) {
+	for _, p := range providers {
+		rg.GET("/auth/"+p.Name()+"/login", p.HandleLogin)
+		rg.GET("/auth/"+p.Name()+"/callback", p.HandleCallback)
+	}
+}
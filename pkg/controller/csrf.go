@@ -0,0 +1,48 @@
+package controller
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	csrfCookieName = "mstudio_ext_csrf"
+	csrfFormField  = "csrf_token"
+)
+
+// issueCSRFToken generates a new random token and stores it in a cookie. The
+// same token needs to be embedded into the form and submitted with it
+// ("double-submit cookie" pattern).
+func issueCSRFToken(ctx *gin.Context, path string, secure bool) (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+
+	token := hex.EncodeToString(raw)
+
+	ctx.SetSameSite(http.SameSiteStrictMode)
+	ctx.SetCookie(csrfCookieName, token, 0, path, "", secure, true)
+
+	return token, nil
+}
+
+// verifyCSRFToken checks if the CSRF token submitted with a form matches the
+// token stored in the CSRF cookie.
+func verifyCSRFToken(ctx *gin.Context) bool {
+	cookieToken, err := ctx.Cookie(csrfCookieName)
+	if err != nil || cookieToken == "" {
+		return false
+	}
+
+	formToken := ctx.PostForm(csrfFormField)
+	if formToken == "" {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(cookieToken), []byte(formToken)) == 1
+}
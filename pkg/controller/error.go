@@ -1,10 +1,23 @@
 package controller
 
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/middleware"
+)
+
 type ErrorResponse struct {
-	Message string `json:"message"`
-	Details string `json:"details,omitempty"`
+	Message   string `json:"message"`
+	Details   string `json:"details,omitempty"`
+	RequestID string `json:"requestId,omitempty"`
 }
 
 func ErrorResponseFromErr(msg string, err error) *ErrorResponse {
-	return &ErrorResponse{msg, err.Error()}
+	return &ErrorResponse{Message: msg, Details: err.Error()}
+}
+
+// respondWithError writes an error response that contains the request ID, so
+// that users can reference it in support requests.
+func respondWithError(ctx *gin.Context, code int, resp *ErrorResponse) {
+	resp.RequestID = middleware.RequestIDFromContext(ctx.Request.Context())
+	ctx.JSON(code, resp)
 }
@@ -0,0 +1,43 @@
+package controller
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/health"
+	"log/slog"
+	"net/http"
+)
+
+type HealthController struct {
+	Checker *health.Checker
+	Logger  *slog.Logger
+
+	// Detailed includes the results of the individual checks (including their
+	// error messages) in the readiness report. This should only be enabled on
+	// listeners that are not publicly reachable.
+	Detailed bool
+}
+
+// HandleLiveness reports whether the process is able to serve requests at all.
+// Dependencies are deliberately not checked, so that an outage of a dependency
+// does not cause the proxy to be restarted.
+func (c *HealthController) HandleLiveness(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, health.Report{Status: health.StatusOK})
+}
+
+// HandleReadiness runs the dependency checks, and responds with 503 Service
+// Unavailable if a critical check failed.
+func (c *HealthController) HandleReadiness(ctx *gin.Context) {
+	report := c.Checker.Run(ctx.Request.Context())
+
+	status := http.StatusOK
+	if !report.Ready() {
+		c.Logger.WarnContext(ctx.Request.Context(), "readiness check failed", "health.report", report)
+		status = http.StatusServiceUnavailable
+	}
+
+	if !c.Detailed {
+		report = health.Report{Status: report.Status}
+	}
+
+	ctx.JSON(status, report)
+}
@@ -1,104 +1,116 @@
 package controller
 
 import (
-	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"github.com/gin-gonic/gin"
 	"github.com/mittwald/mstudio-ext-proxy/pkg/domain/model"
-	"github.com/mittwald/mstudio-ext-proxy/pkg/domain/repository"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/domain/service"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/httperr"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/metrics"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/tracing"
 	"github.com/mittwald/mstudio-ext-proxy/pkg/webhooks"
 	"github.com/mittwald/mstudio-ext-proxy/pkg/webhooks/webhookscommon"
-	"github.com/mittwald/mstudio-ext-proxy/pkg/webhooks/webhooksv1"
+	"go.opentelemetry.io/otel/trace"
 	"io"
 	"log/slog"
 	"net/http"
 )
 
+// unknownWebhookKind is used as metric label for requests that were rejected
+// before their payload was decoded.
+const unknownWebhookKind = "unknown"
+
 type WebhookController struct {
-	ExtensionInstanceRepository repository.ExtensionInstanceRepository
-	WebhookVerifier             *webhookscommon.Verifier
-	Logger                      *slog.Logger
+	WebhookQueueService service.WebhookQueueService
+	WebhookVerifier     *webhookscommon.Verifier
+	Allowlist           webhooks.OriginVerifier
+	Logger              *slog.Logger
 }
 
 func (c *WebhookController) HandleWebhookRequest(ctx *gin.Context) {
 	payload, err := io.ReadAll(ctx.Request.Body)
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, ErrorResponseFromErr("error reading payload", err))
+		metrics.WebhooksReceived.WithLabelValues(unknownWebhookKind, "error").Inc()
+		respondWithError(ctx, http.StatusInternalServerError, ErrorResponseFromErr("error reading payload", err))
 		return
 	}
 
-	if err := c.WebhookVerifier.VerifyWebhookRequest(ctx, ctx.Request, payload); err != nil {
-		c.Logger.Debug("invalid webhook signature", "err", err)
-		ctx.JSON(http.StatusForbidden, ErrorResponseFromErr("invalid request signature", err))
+	verifyCtx, verifySpan := tracing.Start(ctx.Request.Context(), "webhook.Verify")
+	err = c.WebhookVerifier.VerifyWebhookRequest(verifyCtx, ctx.Request, payload)
+	tracing.End(verifySpan, err)
+
+	if errors.Is(err, webhookscommon.ErrKeyLookupRateLimited) {
+		c.Logger.WarnContext(ctx.Request.Context(), "rejecting webhook with uncached key serial", "err", err)
+		metrics.WebhooksReceived.WithLabelValues(unknownWebhookKind, "rate_limited").Inc()
+		respondWithError(ctx, http.StatusServiceUnavailable, ErrorResponseFromErr("key lookup rate limit exceeded", err))
 		return
 	}
 
-	wh, env, err := webhooks.UnmarshalWebhookRequest(payload)
 	if err != nil {
-		c.Logger.Debug("invalid webhook request", "err", err)
-		ctx.JSON(http.StatusBadRequest, ErrorResponseFromErr("could not decode webhook request", err))
+		c.Logger.DebugContext(ctx.Request.Context(), "invalid webhook signature", "err", err)
+		metrics.WebhooksReceived.WithLabelValues(unknownWebhookKind, "invalid_signature").Inc()
+		respondWithError(ctx, http.StatusForbidden, ErrorResponseFromErr("invalid request signature", err))
 		return
 	}
 
-	c.Logger.Debug("handling webhook", "webhook.kind", env.Kind, "webhook.version", env.APIVersion)
-
-	switch wht := wh.(type) {
-	case *webhooksv1.ExtensionAddedToContext:
-		err = c.handleExtensionAddedToContextV1(ctx, wht)
-	case *webhooksv1.ExtensionInstanceUpdated:
-		err = c.handleExtensionUpdatedV1(ctx, wht)
-	case *webhooksv1.ExtensionInstanceSecretRotated:
-		err = c.handleExtensionSecretRotatedV1(ctx, wht)
-	case *webhooksv1.ExtensionInstanceRemovedFromContext:
-		err = c.handleExtensionInstanceFromvedFromContextV1(ctx, wht)
-	}
-
+	wh, env, err := webhooks.UnmarshalWebhookRequest(payload)
 	if err != nil {
-		c.Logger.Debug("invalid webhook request", "err", err)
-		ctx.JSON(http.StatusBadRequest, ErrorResponseFromErr("could not decode webhook request", err))
+		c.Logger.DebugContext(ctx.Request.Context(), "invalid webhook request", "err", err)
+		metrics.WebhooksReceived.WithLabelValues(unknownWebhookKind, "invalid").Inc()
+		respondWithError(ctx, http.StatusBadRequest, ErrorResponseFromErr("could not decode webhook request", err))
 		return
 	}
 
-	ctx.JSON(http.StatusOK, payload)
-}
+	trace.SpanFromContext(ctx.Request.Context()).SetAttributes(tracing.AttrWebhookKind.String(env.Kind))
 
-func (c *WebhookController) handleExtensionAddedToContextV1(ctx context.Context, wh *webhooksv1.ExtensionAddedToContext) error {
-	instance := model.ExtensionInstance{
-		ID: wh.ID,
-		Context: model.ExtensionInstanceContext{
-			ID:   wh.Context.ID,
-			Kind: string(wh.Context.Kind),
-		},
-		Enabled: wh.State.Enabled,
-		Scopes:  wh.ConsentedScopes,
-		Secret:  []byte(wh.Secret),
+	if err := c.Allowlist.VerifyWebhookOrigin(wh); err != nil {
+		c.Logger.WarnContext(ctx.Request.Context(), "rejecting webhook for foreign extension", "err", err, "webhook.kind", env.Kind)
+		metrics.WebhooksReceived.WithLabelValues(env.Kind, "forbidden").Inc()
+		respondWithError(ctx, http.StatusForbidden, ErrorResponseFromErr("webhook not accepted", err))
+		return
 	}
 
-	return c.ExtensionInstanceRepository.AddExtensionInstance(ctx, instance)
-}
-
-func (c *WebhookController) handleExtensionUpdatedV1(ctx context.Context, wh *webhooksv1.ExtensionInstanceUpdated) error {
-	instance, err := c.ExtensionInstanceRepository.FindExtensionInstanceByID(ctx, wh.ID)
-	if err != nil {
-		return err
+	// Redeliveries of the same event carry the same (signed) body; the delivery
+	// ID is derived from the body hash, so that they are recognized as such.
+	payloadHash := sha256.Sum256(payload)
+	delivery := model.WebhookDelivery{
+		PayloadHash:     hex.EncodeToString(payloadHash[:]),
+		Kind:            env.Kind,
+		APIVersion:      env.APIVersion,
+		SignatureSerial: ctx.GetHeader("X-Marketplace-Signature-Serial"),
 	}
 
-	instance.Scopes = wh.ConsentedScopes
-	instance.Enabled = wh.State.Enabled
+	l := c.Logger.With("webhook.kind", env.Kind, "webhook.version", env.APIVersion)
 
-	return c.ExtensionInstanceRepository.UpdateExtensionInstance(ctx, instance)
-}
+	// The webhook is only persisted here and acknowledged right away; it is
+	// processed asynchronously by the webhook worker. Redeliveries of an event
+	// that was already received are acknowledged, too (so that the marketplace
+	// stops retrying), but are not processed again; they are rejected once the
+	// redelivery window has passed.
+	enqueueCtx, enqueueSpan := tracing.Start(ctx.Request.Context(), "webhook.Enqueue")
+	enqueued, err := c.WebhookQueueService.EnqueueWebhook(enqueueCtx, delivery, wh, payload)
+	tracing.End(enqueueSpan, err)
 
-func (c *WebhookController) handleExtensionSecretRotatedV1(ctx context.Context, wh *webhooksv1.ExtensionInstanceSecretRotated) error {
-	instance, err := c.ExtensionInstanceRepository.FindExtensionInstanceByID(ctx, wh.ID)
-	if err != nil {
-		return err
+	if errors.Is(err, service.ErrWebhookReplayed) {
+		l.WarnContext(ctx.Request.Context(), "rejecting replayed webhook", "err", err)
+		metrics.WebhooksReceived.WithLabelValues(env.Kind, "replayed").Inc()
+
+		respondWithError(ctx, httperr.StatusForError(err), ErrorResponseFromErr("webhook was already received", err))
+		return
 	}
 
-	instance.Secret = []byte(wh.Secret)
+	if err != nil {
+		l.ErrorContext(ctx.Request.Context(), "error enqueueing webhook", "err", err)
+		metrics.WebhooksReceived.WithLabelValues(env.Kind, "error").Inc()
 
-	return c.ExtensionInstanceRepository.UpdateExtensionInstance(ctx, instance)
-}
+		respondWithError(ctx, httperr.StatusForError(err), ErrorResponseFromErr("error enqueueing webhook request", err))
+		return
+	}
+
+	l.DebugContext(ctx.Request.Context(), "enqueued webhook", "webhook.id", enqueued.ID)
+	metrics.WebhooksReceived.WithLabelValues(env.Kind, "accepted").Inc()
 
-func (c *WebhookController) handleExtensionInstanceFromvedFromContextV1(ctx context.Context, wh *webhooksv1.ExtensionInstanceRemovedFromContext) error {
-	return c.ExtensionInstanceRepository.RemoveExtensionInstanceByID(ctx, wh.ID)
+	ctx.JSON(http.StatusAccepted, payload)
 }
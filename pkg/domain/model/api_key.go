@@ -0,0 +1,110 @@
+package model
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const apiKeyPrefix = "mxp_"
+
+// APIKey is a proxy-issued credential that non-browser clients (like CLI tools
+// or cron jobs) can present as bearer token instead of a session cookie. Each
+// key is scoped to a single extension instance.
+//
+// Keys may either be service keys (created by an administrator) or personal
+// keys, which are created by a logged-in user and carry that user's identity.
+type APIKey struct {
+	ID         string `bson:"_id"`
+	Name       string
+	InstanceID string
+	Secret     []byte
+	Created    time.Time
+	Expires    time.Time
+
+	// UserID, FirstName, LastName and Email are only set for personal keys.
+	UserID    string
+	FirstName string
+	LastName  string
+	Email     string
+
+	// Scopes optionally restricts the key to a subset of the instance's
+	// scopes. If nil, all scopes of the instance are granted.
+	Scopes []string
+}
+
+func NewAPIKey() (APIKey, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return APIKey{}, err
+	}
+
+	return APIKey{
+		ID:      uuid.Must(uuid.NewUUID()).String(),
+		Secret:  secret,
+		Created: time.Now(),
+	}, nil
+}
+
+// TokenString returns the bearer token for this key. This only works as long
+// as the secret has not yet been hashed.
+func (k APIKey) TokenString() string {
+	return fmt.Sprintf("%s%s_%X", apiKeyPrefix, k.ID, k.Secret)
+}
+
+// IsExpired returns true if the key has an expiry date that has passed. Keys
+// without expiry date never expire.
+func (k APIKey) IsExpired() bool {
+	return !k.Expires.IsZero() && k.Expires.Compare(time.Now()) < 0
+}
+
+// IsPersonal returns true if the key belongs to a user.
+func (k APIKey) IsPersonal() bool {
+	return k.UserID != ""
+}
+
+// GrantedScopes returns the scopes that are granted to the key, given the
+// scopes that are currently consented for its instance.
+func (k APIKey) GrantedScopes(instanceScopes []string) []string {
+	if k.Scopes == nil {
+		return instanceScopes
+	}
+
+	granted := make([]string, 0, len(k.Scopes))
+	for _, scope := range k.Scopes {
+		if slices.Contains(instanceScopes, scope) {
+			granted = append(granted, scope)
+		}
+	}
+
+	return granted
+}
+
+// IsAPIKeyTokenString returns true if the given bearer token looks like a
+// proxy-issued API key.
+func IsAPIKeyTokenString(tokenString string) bool {
+	return strings.HasPrefix(tokenString, apiKeyPrefix)
+}
+
+func APIKeyIDAndSecretFromTokenString(tokenString string) (string, []byte) {
+	if !IsAPIKeyTokenString(tokenString) {
+		return "", nil
+	}
+
+	parts := strings.SplitN(strings.TrimPrefix(tokenString, apiKeyPrefix), "_", 2)
+	if len(parts) != 2 {
+		return "", nil
+	}
+
+	secret, err := hex.DecodeString(parts[1])
+	if err != nil {
+		return "", nil
+	}
+
+	return parts[0], secret
+}
@@ -6,9 +6,10 @@ type ExtensionInstanceContext struct {
 }
 
 type ExtensionInstance struct {
-	ID      string                   `bson:"_id" json:"id"`
-	Enabled bool                     `json:"enabled"`
-	Context ExtensionInstanceContext `json:"context"`
-	Scopes  []string                 `json:"scopes"`
-	Secret  []byte                   `json:"secret"`
+	ID          string                   `bson:"_id" json:"id"`
+	ExtensionID string                   `json:"extensionId"`
+	Enabled     bool                     `json:"enabled"`
+	Context     ExtensionInstanceContext `json:"context"`
+	Scopes      []string                 `json:"scopes"`
+	Secret      []byte                   `json:"secret"`
 }
@@ -0,0 +1,13 @@
+package model
+
+import "time"
+
+// LoginAttempts tracks failed login attempts for a single throttling key (like
+// a client IP address, or the global counter). Per-client attempts are counted
+// before the credentials are verified, and reset after a successful login.
+type LoginAttempts struct {
+	Key         string `bson:"_id"`
+	Failures    int
+	LastFailure time.Time
+	Expires     time.Time
+}
@@ -0,0 +1,27 @@
+package model
+
+import "time"
+
+type OutboxMessageStatus string
+
+const (
+	OutboxMessageStatusPending OutboxMessageStatus = "pending"
+	OutboxMessageStatusFailed  OutboxMessageStatus = "failed"
+)
+
+// OutboxMessage is a lifecycle event that still needs to be delivered to an
+// upstream application. There is one message per event and target; messages
+// are removed once they were delivered successfully.
+type OutboxMessage struct {
+	ID          string `bson:"_id"`
+	EventID     string
+	EventKind   string
+	InstanceID  string
+	TargetURL   string
+	Payload     []byte
+	Status      OutboxMessageStatus
+	Attempts    int
+	LastError   string
+	Created     time.Time
+	NextAttempt time.Time
+}
@@ -0,0 +1,35 @@
+package model
+
+import "time"
+
+// QueuedWebhook is a verified webhook request that is waiting to be processed
+// (or, when stored in the dead-letter collection, that could not be processed
+// after the maximum number of attempts).
+type QueuedWebhook struct {
+	// ID is the same as the ID of the corresponding WebhookDelivery.
+	ID              string `bson:"_id"`
+	PayloadHash     string
+	Kind            string
+	APIVersion      string
+	InstanceID      string
+	SignatureSerial string
+	Payload         []byte
+	Attempts        int
+	LastError       string
+	Enqueued        time.Time
+	NextAttempt     time.Time
+	DeadLettered    time.Time
+}
+
+// Delivery returns the delivery log entry that corresponds to this webhook.
+func (q QueuedWebhook) Delivery() WebhookDelivery {
+	return WebhookDelivery{
+		ID:              q.ID,
+		PayloadHash:     q.PayloadHash,
+		Kind:            q.Kind,
+		APIVersion:      q.APIVersion,
+		InstanceID:      q.InstanceID,
+		SignatureSerial: q.SignatureSerial,
+		FirstReceived:   q.Enqueued,
+	}
+}
@@ -0,0 +1,59 @@
+package model
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+)
+
+type WebhookDeliveryOutcome string
+
+const (
+	WebhookDeliveryOutcomeQueued    WebhookDeliveryOutcome = "queued"
+	WebhookDeliveryOutcomeProcessed WebhookDeliveryOutcome = "processed"
+	WebhookDeliveryOutcomeFailed    WebhookDeliveryOutcome = "failed"
+)
+
+// WebhookDelivery is an entry of the webhook delivery log. There is one entry
+// per distinct webhook; redeliveries and retries of a queued webhook update the
+// existing entry.
+type WebhookDelivery struct {
+	// ID is derived from the webhook kind, instance and payload hash (see
+	// WebhookDeliveryID), so that a redelivery maps to the same entry.
+	ID string `bson:"_id"`
+
+	// PayloadHash is the SHA-256 hash of the (signed) request body. The
+	// marketplace does not include an event ID in its webhooks, so a
+	// redelivery can only be recognized by having the same body as an earlier
+	// webhook for the same instance.
+	PayloadHash     string
+	Kind            string
+	APIVersion      string
+	InstanceID      string
+	SignatureSerial string
+	Outcome         WebhookDeliveryOutcome
+	Error           string
+	Attempts        int
+	Duplicates      int
+	FirstReceived   time.Time
+	LastReceived    time.Time
+	ProcessedAt     time.Time
+	Duration        time.Duration
+	Expires         time.Time
+}
+
+func (d WebhookDelivery) IsProcessed() bool {
+	return d.Outcome == WebhookDeliveryOutcomeProcessed
+}
+
+// WebhookDeliveryID returns the delivery log ID for a webhook with the given
+// kind, instance ID and payload hash.
+func WebhookDeliveryID(kind, instanceID, payloadHash string) string {
+	h := sha256.New()
+	for _, part := range []string{kind, instanceID, payloadHash} {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
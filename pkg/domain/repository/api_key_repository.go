@@ -0,0 +1,15 @@
+package repository
+
+import (
+	"context"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/domain/model"
+)
+
+type APIKeyRepository interface {
+	FindAPIKeyByIDAndSecret(ctx context.Context, id string, secret []byte) (*model.APIKey, error)
+	FindAPIKeysByInstanceID(ctx context.Context, instanceID string) ([]model.APIKey, error)
+	FindAPIKeysByUserIDAndInstanceID(ctx context.Context, userID, instanceID string) ([]model.APIKey, error)
+	CreateAPIKeyWithUnhashedSecret(ctx context.Context, key model.APIKey) error
+	RemoveAPIKeyByID(ctx context.Context, id string) error
+	RemoveAPIKeyByIDUserIDAndInstanceID(ctx context.Context, id, userID, instanceID string) (bool, error)
+}
@@ -7,8 +7,24 @@ import (
 
 type ExtensionInstanceRepository interface {
 	FindExtensionInstanceByID(context.Context, string) (model.ExtensionInstance, error)
+	FindExtensionInstancesByIDs(context.Context, []string) ([]model.ExtensionInstance, error)
+	FindExtensionInstancesByExtensionID(context.Context, string) ([]model.ExtensionInstance, error)
 	AddExtensionInstance(context.Context, model.ExtensionInstance) error
 	UpdateExtensionInstance(context.Context, model.ExtensionInstance) error
+
+	// SyncExtensionInstance updates all fields of an instance except for its
+	// secret, or adds the instance (without a secret) if it does not exist.
+	SyncExtensionInstance(context.Context, model.ExtensionInstance) error
+
+	// SyncExistingExtensionInstance updates all fields of an instance except
+	// for its secret; unlike SyncExtensionInstance, it does nothing if the
+	// instance does not exist.
+	SyncExistingExtensionInstance(context.Context, model.ExtensionInstance) error
+
+	// AssignExtensionIDToLegacyInstances sets the extension ID of all
+	// instances that do not have one yet, and returns how many were updated.
+	AssignExtensionIDToLegacyInstances(context.Context, string) (int, error)
+
 	RemoveExtensionInstance(context.Context, model.ExtensionInstance) error
 	RemoveExtensionInstanceByID(context.Context, string) error
 }
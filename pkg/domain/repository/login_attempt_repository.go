@@ -0,0 +1,25 @@
+package repository
+
+import (
+	"context"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/domain/model"
+	"time"
+)
+
+type LoginAttemptRepository interface {
+	// FindLoginAttempts returns the failed login attempts for a key; if there
+	// are none, an empty record is returned.
+	FindLoginAttempts(ctx context.Context, key string) (model.LoginAttempts, error)
+
+	// RegisterLoginAttempt atomically increments the failure counter of a key
+	// and returns the record as it was before the increment (or an empty record,
+	// if there was none). The record is discarded after the given expiry time.
+	RegisterLoginAttempt(ctx context.Context, key string, at time.Time, expires time.Time) (model.LoginAttempts, error)
+
+	// RegisterLoginAttemptIfUnchanged atomically increments the failure counter
+	// of a key, but only if it still has the given number of failures (where
+	// an expired record counts as none). It returns false if the counter was
+	// changed concurrently, and was not incremented.
+	RegisterLoginAttemptIfUnchanged(ctx context.Context, key string, failures int, at time.Time, expires time.Time) (bool, error)
+	ResetLoginAttempts(ctx context.Context, key string) error
+}
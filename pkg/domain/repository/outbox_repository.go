@@ -0,0 +1,26 @@
+package repository
+
+import (
+	"context"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/domain/model"
+	"time"
+)
+
+type OutboxRepository interface {
+	// AddOutboxMessage stores a new message; if a message with the same ID
+	// already exists, it is left untouched.
+	AddOutboxMessage(ctx context.Context, msg model.OutboxMessage) error
+
+	// ClaimDueOutboxMessage atomically fetches a pending message that is due
+	// for delivery, and postpones its next attempt by the given lease duration
+	// so that it is not claimed by another worker in the meantime. If there is
+	// no due message, nil is returned.
+	ClaimDueOutboxMessage(ctx context.Context, now time.Time, lease time.Duration) (*model.OutboxMessage, error)
+
+	// HasEarlierOutboxMessage returns true if there is a pending message for
+	// the same target and extension instance that was created before the given
+	// message.
+	HasEarlierOutboxMessage(ctx context.Context, msg model.OutboxMessage) (bool, error)
+	UpdateOutboxMessage(ctx context.Context, msg model.OutboxMessage) error
+	RemoveOutboxMessageByID(ctx context.Context, id string) error
+}
@@ -10,4 +10,8 @@ type SessionRepository interface {
 	CreateSession(ctx context.Context, session model.Session) error
 	CreateSessionWithUnhashedSecret(ctx context.Context, session model.Session) error
 	RefreshSession(ctx context.Context, session model.Session) error
+
+	// CountActiveSessionsByInstance returns the number of sessions that have
+	// not expired, by extension instance ID.
+	CountActiveSessionsByInstance(ctx context.Context) (map[string]int, error)
 }
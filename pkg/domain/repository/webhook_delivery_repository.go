@@ -0,0 +1,13 @@
+package repository
+
+import (
+	"context"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/domain/model"
+)
+
+type WebhookDeliveryRepository interface {
+	// FindWebhookDeliveryByID returns the delivery log entry with the given ID,
+	// or nil if there is none.
+	FindWebhookDeliveryByID(ctx context.Context, id string) (*model.WebhookDelivery, error)
+	SaveWebhookDelivery(ctx context.Context, delivery model.WebhookDelivery) error
+}
@@ -0,0 +1,37 @@
+package repository
+
+import (
+	"context"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/domain/model"
+	"time"
+)
+
+type WebhookQueueRepository interface {
+	// EnqueueWebhook adds a webhook to the queue; if a webhook with the same ID
+	// is already queued, it is left untouched.
+	EnqueueWebhook(ctx context.Context, wh model.QueuedWebhook) error
+
+	// ClaimDueWebhook atomically fetches the oldest webhook that is due for
+	// processing, and postpones its next attempt by the given lease duration so
+	// that it is not claimed by another worker in the meantime. If there is no
+	// due webhook, nil is returned.
+	ClaimDueWebhook(ctx context.Context, now time.Time, lease time.Duration) (*model.QueuedWebhook, error)
+
+	// HasEarlierQueuedWebhook returns true if there is another queued webhook
+	// for the same instance that was enqueued before the given one.
+	HasEarlierQueuedWebhook(ctx context.Context, wh model.QueuedWebhook) (bool, error)
+	UpdateQueuedWebhook(ctx context.Context, wh model.QueuedWebhook) error
+	RemoveQueuedWebhookByID(ctx context.Context, id string) error
+
+	// MoveWebhookToDeadLetters removes a webhook from the queue and stores it
+	// in the dead-letter collection.
+	MoveWebhookToDeadLetters(ctx context.Context, wh model.QueuedWebhook) error
+	FindDeadLetters(ctx context.Context) ([]model.QueuedWebhook, error)
+	FindDeadLetterByID(ctx context.Context, id string) (*model.QueuedWebhook, error)
+
+	// ReplayDeadLetter moves a webhook from the dead-letter collection back
+	// into the queue, resetting its attempts. The webhook is enqueued anew, so
+	// that it does not hold back webhooks for the same instance that were
+	// enqueued in the meantime.
+	ReplayDeadLetter(ctx context.Context, id string) error
+}
@@ -0,0 +1,177 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/mittwald/mstudio-ext-proxy/pkg/domain/model"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/domain/repository"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/httperr"
+)
+
+// apiKeySessionTTL is the lifetime of the transient sessions that are built
+// for API key requests (and thus, of the JWT passed to the upstream).
+const apiKeySessionTTL = 5 * time.Minute
+
+// APIKeyService manages proxy-issued API keys, and authenticates bearer tokens
+// into the same session model that is used for cookie-based sessions. This way,
+// upstream applications receive the same JWT regardless of how the caller
+// authenticated.
+type APIKeyService interface {
+	CreateAPIKey(ctx context.Context, name, instanceID string, expires time.Time) (*model.APIKey, string, error)
+	ListAPIKeysForInstance(ctx context.Context, instanceID string) ([]model.APIKey, error)
+	RevokeAPIKey(ctx context.Context, id string) error
+
+	CreatePersonalAPIKey(ctx context.Context, session *model.Session, name string, expires time.Time, scopes []string) (*model.APIKey, string, error)
+	ListPersonalAPIKeys(ctx context.Context, session *model.Session) ([]model.APIKey, error)
+	RevokePersonalAPIKey(ctx context.Context, session *model.Session, id string) error
+
+	AuthenticateAPIKey(ctx context.Context, token string) (*model.Session, error)
+}
+
+type apiKeyService struct {
+	apiKeyRepository   repository.APIKeyRepository
+	instanceRepository repository.ExtensionInstanceRepository
+}
+
+func NewAPIKeyService(kr repository.APIKeyRepository, ir repository.ExtensionInstanceRepository) APIKeyService {
+	return &apiKeyService{
+		apiKeyRepository:   kr,
+		instanceRepository: ir,
+	}
+}
+
+// CreateAPIKey creates a new service API key for an extension instance.
+func (s *apiKeyService) CreateAPIKey(ctx context.Context, name, instanceID string, expires time.Time) (*model.APIKey, string, error) {
+	if _, err := s.instanceRepository.FindExtensionInstanceByID(ctx, instanceID); err != nil {
+		return nil, "", httperr.ErrWithStatus(http.StatusNotFound, "instance not found", fmt.Errorf("error getting instance %s: %w", instanceID, err))
+	}
+
+	key, err := model.NewAPIKey()
+	if err != nil {
+		return nil, "", fmt.Errorf("error generating API key: %w", err)
+	}
+
+	key.Name = name
+	key.InstanceID = instanceID
+	key.Expires = expires
+
+	return s.storeAPIKey(ctx, key)
+}
+
+func (s *apiKeyService) ListAPIKeysForInstance(ctx context.Context, instanceID string) ([]model.APIKey, error) {
+	return s.apiKeyRepository.FindAPIKeysByInstanceID(ctx, instanceID)
+}
+
+func (s *apiKeyService) RevokeAPIKey(ctx context.Context, id string) error {
+	return s.apiKeyRepository.RemoveAPIKeyByID(ctx, id)
+}
+
+// CreatePersonalAPIKey creates a new API key that is bound to the user and
+// extension instance of the given session. The requested scopes must be a
+// subset of the instance's scopes; if no scopes are given, the key is granted
+// all scopes of the instance.
+func (s *apiKeyService) CreatePersonalAPIKey(ctx context.Context, session *model.Session, name string, expires time.Time, scopes []string) (*model.APIKey, string, error) {
+	for _, scope := range scopes {
+		if !slices.Contains(session.Instance.Scopes, scope) {
+			return nil, "", httperr.ErrWithStatus(http.StatusBadRequest, "invalid scope", fmt.Errorf("scope '%s' is not granted to instance %s", scope, session.Instance.ID))
+		}
+	}
+
+	if !expires.IsZero() && expires.Before(time.Now()) {
+		return nil, "", httperr.ErrWithStatus(http.StatusBadRequest, "invalid expiry date", fmt.Errorf("expiry date %s is in the past", expires))
+	}
+
+	key, err := model.NewAPIKey()
+	if err != nil {
+		return nil, "", fmt.Errorf("error generating API key: %w", err)
+	}
+
+	key.Name = name
+	key.InstanceID = session.Instance.ID
+	key.Expires = expires
+	key.Scopes = scopes
+	key.UserID = session.UserID
+	key.FirstName = session.FirstName
+	key.LastName = session.LastName
+	key.Email = session.Email
+
+	return s.storeAPIKey(ctx, key)
+}
+
+func (s *apiKeyService) ListPersonalAPIKeys(ctx context.Context, session *model.Session) ([]model.APIKey, error) {
+	return s.apiKeyRepository.FindAPIKeysByUserIDAndInstanceID(ctx, session.UserID, session.Instance.ID)
+}
+
+func (s *apiKeyService) RevokePersonalAPIKey(ctx context.Context, session *model.Session, id string) error {
+	// Keys are only revoked within the session's instance; a user's keys for
+	// other instances must not be reachable from this session.
+	removed, err := s.apiKeyRepository.RemoveAPIKeyByIDUserIDAndInstanceID(ctx, id, session.UserID, session.Instance.ID)
+	if err != nil {
+		return err
+	}
+
+	if !removed {
+		return httperr.ErrWithStatus(http.StatusNotFound, "API key not found", fmt.Errorf("API key %s not found", id))
+	}
+
+	return nil
+}
+
+// storeAPIKey stores a new key and returns it, together with the bearer token.
+// The token is only available at this point, since only a hash of the key's
+// secret is stored.
+func (s *apiKeyService) storeAPIKey(ctx context.Context, key model.APIKey) (*model.APIKey, string, error) {
+	token := key.TokenString()
+
+	if err := s.apiKeyRepository.CreateAPIKeyWithUnhashedSecret(ctx, key); err != nil {
+		return nil, "", fmt.Errorf("error storing API key: %w", err)
+	}
+
+	key.Secret = nil
+	return &key, token, nil
+}
+
+func (s *apiKeyService) AuthenticateAPIKey(ctx context.Context, token string) (*model.Session, error) {
+	keyID, keySecret := model.APIKeyIDAndSecretFromTokenString(token)
+	if keyID == "" {
+		return nil, httperr.ErrWithStatus(http.StatusUnauthorized, "invalid API key", fmt.Errorf("malformed API key"))
+	}
+
+	key, err := s.apiKeyRepository.FindAPIKeyByIDAndSecret(ctx, keyID, keySecret)
+	if err != nil {
+		return nil, httperr.ErrWithStatus(http.StatusUnauthorized, "invalid API key", err)
+	}
+
+	if key.IsExpired() {
+		return nil, httperr.ErrWithStatus(http.StatusUnauthorized, "API key expired", fmt.Errorf("API key %s expired at %s", key.ID, key.Expires))
+	}
+
+	instance, err := s.instanceRepository.FindExtensionInstanceByID(ctx, key.InstanceID)
+	if err != nil {
+		return nil, httperr.ErrWithStatus(http.StatusUnauthorized, "invalid API key", fmt.Errorf("error getting instance %s: %w", key.InstanceID, err))
+	}
+
+	instance.Scopes = key.GrantedScopes(instance.Scopes)
+
+	session := model.Session{
+		ID:       "apikey:" + key.ID,
+		Expires:  time.Now().Add(apiKeySessionTTL),
+		Instance: instance,
+	}
+
+	if key.IsPersonal() {
+		session.UserID = key.UserID
+		session.FirstName = key.FirstName
+		session.LastName = key.LastName
+		session.Email = key.Email
+	} else {
+		session.UserID = "apikey:" + key.ID
+		session.FirstName = key.Name
+	}
+
+	return &session, nil
+}
@@ -0,0 +1,174 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/mittwald/mstudio-ext-proxy/pkg/domain/model"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/domain/repository"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/events"
+)
+
+// outboxLease is the duration for which a claimed message is not handed out
+// to other workers. This needs to be longer than the HTTP client timeout, so
+// that a message is not delivered twice concurrently.
+const outboxLease = 5 * time.Minute
+
+// outboxOrderingDelay is the delay after which a message is tried again when
+// an earlier message for the same instance and target is still pending.
+const outboxOrderingDelay = 5 * time.Second
+
+type EventDispatcherOptions struct {
+	// Secret is the key used to sign events; upstream applications need it to
+	// verify the events' authenticity.
+	Secret []byte
+
+	PollInterval time.Duration
+	BaseDelay    time.Duration
+	MaxDelay     time.Duration
+	MaxAttempts  int
+}
+
+// EventDispatcher delivers the messages from the outbox to the upstream
+// applications. Messages for the same extension instance are delivered to each
+// target in the order in which they were created. Failed deliveries are retried with exponential backoff; after
+// the maximum number of attempts, a message is marked as failed and kept in the
+// outbox for inspection.
+type EventDispatcher struct {
+	outboxRepository repository.OutboxRepository
+	client           *http.Client
+	options          EventDispatcherOptions
+	logger           *slog.Logger
+}
+
+func NewEventDispatcher(r repository.OutboxRepository, client *http.Client, opts EventDispatcherOptions, logger *slog.Logger) *EventDispatcher {
+	return &EventDispatcher{
+		outboxRepository: r,
+		client:           client,
+		options:          opts,
+		logger:           logger,
+	}
+}
+
+// Run delivers due messages until the context is cancelled.
+func (d *EventDispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.options.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		d.dispatchDueMessages(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (d *EventDispatcher) dispatchDueMessages(ctx context.Context) {
+	for ctx.Err() == nil {
+		msg, err := d.outboxRepository.ClaimDueOutboxMessage(ctx, time.Now(), outboxLease)
+		if err != nil {
+			d.logger.Error("error retrieving due outbox messages", "err", err)
+			return
+		}
+
+		if msg == nil {
+			return
+		}
+
+		d.dispatchMessage(ctx, msg)
+	}
+}
+
+func (d *EventDispatcher) dispatchMessage(ctx context.Context, msg *model.OutboxMessage) {
+	l := d.logger.With("event.id", msg.EventID, "event.kind", msg.EventKind, "event.target", msg.TargetURL, "event.instanceID", msg.InstanceID)
+
+	earlier, err := d.outboxRepository.HasEarlierOutboxMessage(ctx, *msg)
+	if err != nil {
+		l.Error("error checking for earlier events", "err", err)
+		return
+	}
+
+	if earlier {
+		l.Debug("postponing event until earlier events for the same instance are delivered")
+		msg.NextAttempt = time.Now().Add(outboxOrderingDelay)
+		if err := d.outboxRepository.UpdateOutboxMessage(ctx, *msg); err != nil {
+			l.Error("error updating outbox message", "err", err)
+		}
+		return
+	}
+
+	msg.Attempts++
+
+	err = d.deliver(ctx, msg)
+	if err == nil {
+		l.Info("delivered event", "event.attempts", msg.Attempts)
+
+		if err := d.outboxRepository.RemoveOutboxMessageByID(ctx, msg.ID); err != nil {
+			l.Error("error removing delivered event from outbox", "err", err)
+		}
+
+		return
+	}
+
+	msg.LastError = err.Error()
+
+	if msg.Attempts >= d.options.MaxAttempts {
+		l.Error("giving up delivering event", "err", err, "event.attempts", msg.Attempts)
+		msg.Status = model.OutboxMessageStatusFailed
+	} else {
+		delay := d.backoff(msg.Attempts)
+		l.Warn("error delivering event; retrying", "err", err, "event.attempts", msg.Attempts, "event.retryIn", delay)
+		msg.NextAttempt = time.Now().Add(delay)
+	}
+
+	if err := d.outboxRepository.UpdateOutboxMessage(ctx, *msg); err != nil {
+		l.Error("error updating outbox message", "err", err)
+	}
+}
+
+func (d *EventDispatcher) deliver(ctx context.Context, msg *model.OutboxMessage) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, msg.TargetURL, bytes.NewReader(msg.Payload))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(events.HeaderEventID, msg.EventID)
+	req.Header.Set(events.HeaderEventKind, msg.EventKind)
+	req.Header.Set(events.HeaderSignature, events.Sign(d.options.Secret, time.Now(), msg.Payload))
+
+	res, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer res.Body.Close()
+	_, _ = io.Copy(io.Discard, res.Body)
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %d", res.StatusCode)
+	}
+
+	return nil
+}
+
+func (d *EventDispatcher) backoff(attempts int) time.Duration {
+	delay := d.options.BaseDelay
+	for i := 1; i < attempts && delay < d.options.MaxDelay; i++ {
+		delay *= 2
+	}
+
+	if delay > d.options.MaxDelay {
+		delay = d.options.MaxDelay
+	}
+
+	return delay
+}
@@ -0,0 +1,130 @@
+package service_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	"github.com/mittwald/mstudio-ext-proxy/pkg/domain/model"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/domain/repository"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/domain/service"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/events"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/persistence"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("EventDispatcher", func() {
+	var outbox repository.OutboxRepository
+	var publisher service.EventPublisher
+	var dispatcher *service.EventDispatcher
+	var target *httptest.Server
+
+	var lock sync.Mutex
+	var received []string
+	var failFor string
+
+	receivedIDs := func() []string {
+		lock.Lock()
+		defer lock.Unlock()
+
+		return append([]string{}, received...)
+	}
+
+	event := func(id string, enabled bool) events.Event {
+		return events.Event{
+			ID:         id,
+			Kind:       events.KindInstanceUpdated,
+			OccurredAt: time.Now(),
+			Instance:   model.ExtensionInstance{ID: "instance", Enabled: enabled},
+		}
+	}
+
+	BeforeEach(func() {
+		received = nil
+		failFor = ""
+
+		target = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer GinkgoRecover()
+
+			body, err := io.ReadAll(r.Body)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(events.VerifySignature([]byte("events-secret"), r.Header.Get(events.HeaderSignature), body, time.Minute)).To(Succeed())
+
+			e := events.Event{}
+			Expect(json.Unmarshal(body, &e)).To(Succeed())
+
+			lock.Lock()
+			defer lock.Unlock()
+
+			if e.ID == failFor {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+
+			received = append(received, e.ID)
+		}))
+		DeferCleanup(target.Close)
+
+		outbox = persistence.NewMemoryOutboxRepository()
+		publisher = service.NewEventPublisher(outbox, []string{target.URL})
+		dispatcher = service.NewEventDispatcher(outbox, target.Client(), service.EventDispatcherOptions{
+			Secret:       []byte("events-secret"),
+			PollInterval: 10 * time.Millisecond,
+			BaseDelay:    10 * time.Millisecond,
+			MaxDelay:     10 * time.Millisecond,
+			MaxAttempts:  1000,
+		}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	})
+
+	run := func(ctx context.Context) {
+		dispatchCtx, cancel := context.WithCancel(ctx)
+		done := make(chan struct{})
+
+		go func() {
+			defer close(done)
+			dispatcher.Run(dispatchCtx)
+		}()
+
+		DeferCleanup(func() {
+			cancel()
+			<-done
+		})
+	}
+
+	It("should deliver distinct events with identical content", func(ctx context.Context) {
+		Expect(publisher.PublishEvent(ctx, event("first", false))).To(Succeed())
+		Expect(publisher.PublishEvent(ctx, event("second", false))).To(Succeed())
+		Expect(publisher.PublishEvent(ctx, event("second", false))).To(Succeed())
+
+		run(ctx)
+
+		Eventually(receivedIDs).Should(Equal([]string{"first", "second"}))
+		Consistently(receivedIDs, "100ms").Should(HaveLen(2))
+	})
+
+	It("should not deliver an event before earlier events for the same instance", func(ctx context.Context) {
+		lock.Lock()
+		failFor = "first"
+		lock.Unlock()
+
+		Expect(publisher.PublishEvent(ctx, event("first", false))).To(Succeed())
+		time.Sleep(time.Millisecond)
+		Expect(publisher.PublishEvent(ctx, event("second", true))).To(Succeed())
+
+		run(ctx)
+
+		Consistently(receivedIDs, "200ms").Should(BeEmpty())
+
+		lock.Lock()
+		failFor = ""
+		lock.Unlock()
+
+		Eventually(receivedIDs, "10s").Should(Equal([]string{"first", "second"}))
+	})
+})
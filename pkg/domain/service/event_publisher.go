@@ -0,0 +1,71 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/mittwald/mstudio-ext-proxy/pkg/domain/model"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/domain/repository"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/events"
+)
+
+// EventPublisher fans out lifecycle events to the configured upstream
+// applications. Events are not sent directly, but written to a durable outbox,
+// from which they are delivered by an EventDispatcher.
+type EventPublisher interface {
+	PublishEvent(ctx context.Context, event events.Event) error
+}
+
+type outboxEventPublisher struct {
+	outboxRepository repository.OutboxRepository
+	targetURLs       []string
+}
+
+func NewEventPublisher(r repository.OutboxRepository, targetURLs []string) EventPublisher {
+	return &outboxEventPublisher{
+		outboxRepository: r,
+		targetURLs:       targetURLs,
+	}
+}
+
+func (p *outboxEventPublisher) PublishEvent(ctx context.Context, event events.Event) error {
+	if len(p.targetURLs) == 0 {
+		return nil
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("error encoding event: %w", err)
+	}
+
+	now := time.Now()
+
+	for _, target := range p.targetURLs {
+		// The message ID is derived from the event ID (which is unique for each
+		// received webhook) and target, so that publishing the same event twice
+		// does not lead to duplicate messages.
+		idHash := sha256.Sum256([]byte(event.ID + "\n" + target))
+
+		msg := model.OutboxMessage{
+			ID:          hex.EncodeToString(idHash[:]),
+			EventID:     event.ID,
+			EventKind:   string(event.Kind),
+			InstanceID:  event.Instance.ID,
+			TargetURL:   target,
+			Payload:     payload,
+			Status:      model.OutboxMessageStatusPending,
+			Created:     now,
+			NextAttempt: now,
+		}
+
+		if err := p.outboxRepository.AddOutboxMessage(ctx, msg); err != nil {
+			return fmt.Errorf("error adding event to outbox: %w", err)
+		}
+	}
+
+	return nil
+}
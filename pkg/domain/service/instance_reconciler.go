@@ -0,0 +1,202 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+
+	"github.com/mittwald/mstudio-ext-proxy/pkg/domain/model"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/domain/repository"
+)
+
+// InstanceLister lists the instances of an extension as known to the mStudio.
+type InstanceLister interface {
+	ListExtensionInstances(ctx context.Context, extensionID string) ([]model.ExtensionInstance, error)
+}
+
+// ReconciliationReport describes the differences that were found (and, unless
+// in a dry run, fixed) between the local and the remote instances.
+type ReconciliationReport struct {
+	Added   []string
+	Updated []string
+	Removed []string
+}
+
+func (r ReconciliationReport) IsEmpty() bool {
+	return len(r.Added) == 0 && len(r.Updated) == 0 && len(r.Removed) == 0
+}
+
+// InstanceReconciler makes the local extension instances match the instances
+// listed by the marketplace API, in case webhooks were missed. Since the API
+// does not expose instance secrets, instances that are added by the reconciler
+// have no secret until it is rotated, and the secrets of existing instances
+// are never written (so that a secret delivered by a concurrent webhook is not
+// overwritten).
+type InstanceReconciler struct {
+	lister             InstanceLister
+	instanceRepository repository.ExtensionInstanceRepository
+	extensionIDs       []string
+	logger             *slog.Logger
+}
+
+func NewInstanceReconciler(lister InstanceLister, ir repository.ExtensionInstanceRepository, extensionIDs []string, logger *slog.Logger) *InstanceReconciler {
+	return &InstanceReconciler{
+		lister:             lister,
+		instanceRepository: ir,
+		extensionIDs:       extensionIDs,
+		logger:             logger,
+	}
+}
+
+// Run reconciles the instances immediately, and then in the given interval
+// until the context is cancelled. If the interval is not positive, the
+// instances are only reconciled once.
+func (r *InstanceReconciler) Run(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		if _, err := r.Reconcile(ctx, false); err != nil {
+			r.logger.Error("error reconciling extension instances", "err", err)
+		}
+
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := r.Reconcile(ctx, false); err != nil {
+			r.logger.Error("error reconciling extension instances", "err", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Reconcile compares the local instances of all configured extensions with the
+// remote ones. If dryRun is set, the differences are only reported.
+func (r *InstanceReconciler) Reconcile(ctx context.Context, dryRun bool) (ReconciliationReport, error) {
+	report := ReconciliationReport{}
+
+	for _, extensionID := range r.extensionIDs {
+		if err := r.reconcileExtension(ctx, extensionID, dryRun, &report); err != nil {
+			return report, fmt.Errorf("error reconciling instances of extension %s: %w", extensionID, err)
+		}
+	}
+
+	r.logger.Info("reconciled extension instances", "added", report.Added, "updated", report.Updated, "removed", report.Removed, "dryRun", dryRun)
+
+	return report, nil
+}
+
+func (r *InstanceReconciler) reconcileExtension(ctx context.Context, extensionID string, dryRun bool, report *ReconciliationReport) error {
+	// Webhooks are processed while the reconciler is running. The local
+	// instances are loaded before the remote ones are listed, so that an
+	// instance that is installed after the listing is not removed (and an
+	// instance that is removed after it is not added again).
+	known, err := r.instanceRepository.FindExtensionInstancesByExtensionID(ctx, extensionID)
+	if err != nil {
+		return err
+	}
+
+	knownIDSet := make(map[string]struct{}, len(known))
+	for _, inst := range known {
+		knownIDSet[inst.ID] = struct{}{}
+	}
+
+	remote, err := r.lister.ListExtensionInstances(ctx, extensionID)
+	if err != nil {
+		return err
+	}
+
+	remoteIDs := make([]string, len(remote))
+	remoteIDSet := make(map[string]struct{}, len(remote))
+	for i := range remote {
+		remoteIDs[i] = remote[i].ID
+		remoteIDSet[remote[i].ID] = struct{}{}
+	}
+
+	// Instances that were created before the extension ID was recorded are
+	// looked up by their ID.
+	local, err := r.instanceRepository.FindExtensionInstancesByIDs(ctx, remoteIDs)
+	if err != nil {
+		return err
+	}
+
+	localByID := make(map[string]model.ExtensionInstance, len(local))
+	for _, inst := range local {
+		localByID[inst.ID] = inst
+	}
+
+	for _, remoteInstance := range remote {
+		remoteInstance.ExtensionID = extensionID
+
+		existing, ok := localByID[remoteInstance.ID]
+		if !ok {
+			if _, wasKnown := knownIDSet[remoteInstance.ID]; wasKnown {
+				r.logger.Info("not adding extension instance that was removed during reconciliation", "instanceID", remoteInstance.ID)
+				continue
+			}
+
+			r.logger.Warn("adding missing extension instance", "instanceID", remoteInstance.ID, "dryRun", dryRun)
+			report.Added = append(report.Added, remoteInstance.ID)
+
+			if !dryRun {
+				if err := r.instanceRepository.SyncExtensionInstance(ctx, remoteInstance); err != nil {
+					return err
+				}
+			}
+
+			continue
+		}
+
+		if instancesEqual(existing, remoteInstance) {
+			continue
+		}
+
+		r.logger.Warn("updating outdated extension instance", "instanceID", remoteInstance.ID, "dryRun", dryRun)
+		report.Updated = append(report.Updated, remoteInstance.ID)
+
+		if !dryRun {
+			if err := r.instanceRepository.SyncExistingExtensionInstance(ctx, remoteInstance); err != nil {
+				return err
+			}
+		}
+	}
+
+	// An empty list is more likely caused by a misconfiguration (like a token
+	// of the wrong contributor) than by all instances having been removed.
+	if len(remote) == 0 && len(known) > 0 {
+		r.logger.Warn("marketplace API returned no instances; not removing any local instances", "extensionID", extensionID)
+		return nil
+	}
+
+	for _, inst := range known {
+		if _, ok := remoteIDSet[inst.ID]; ok {
+			continue
+		}
+
+		r.logger.Warn("removing stale extension instance", "instanceID", inst.ID, "dryRun", dryRun)
+		report.Removed = append(report.Removed, inst.ID)
+
+		if !dryRun {
+			if err := r.instanceRepository.RemoveExtensionInstanceByID(ctx, inst.ID); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func instancesEqual(local, remote model.ExtensionInstance) bool {
+	return local.ExtensionID == remote.ExtensionID &&
+		local.Enabled == remote.Enabled &&
+		local.Context == remote.Context &&
+		slices.Equal(local.Scopes, remote.Scopes)
+}
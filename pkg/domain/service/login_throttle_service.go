@@ -0,0 +1,197 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/mittwald/mstudio-ext-proxy/pkg/domain/model"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/domain/repository"
+)
+
+const globalLoginThrottleKey = "global"
+
+// maxLoginAttemptRetries limits how often registering a login attempt is
+// retried when the counter was changed by a concurrent attempt.
+const maxLoginAttemptRetries = 10
+
+// LoginThrottleService protects password-based logins against brute-force
+// attacks. Failed attempts are counted both per client IP and globally; both
+// counters are stored in a repository, so that throttling also works when
+// running multiple replicas.
+//
+// The per-client counter is incremented atomically before the credentials are
+// verified, so that concurrent attempts cannot bypass the throttling; attempts
+// that are rejected are not counted, so that they do not extend the wait time.
+// The global counter only slows down clients that have failed to log in
+// themselves, so that a single client cannot lock out everyone else.
+type LoginThrottleService interface {
+	// RegisterLoginAttempt counts a login attempt of a client, or returns a
+	// *LoginThrottledError (without counting it) if the attempt must be
+	// rejected.
+	RegisterLoginAttempt(ctx context.Context, clientIP string) error
+
+	// RegisterFailedLogin counts a failed login for the global counter (the
+	// per-client counter already includes it).
+	RegisterFailedLogin(ctx context.Context, clientIP string) error
+
+	// RegisterSuccessfulLogin resets the per-client counter.
+	RegisterSuccessfulLogin(ctx context.Context, clientIP string) error
+}
+
+// LoginThrottleLimits describes the throttling behaviour for a single counter.
+// After FreeAttempts failures, each additional failure doubles the wait time
+// (starting at BaseDelay, up to MaxDelay). After LockoutThreshold failures, the
+// counter is locked for LockoutDuration.
+type LoginThrottleLimits struct {
+	FreeAttempts     int
+	BaseDelay        time.Duration
+	MaxDelay         time.Duration
+	LockoutThreshold int
+	LockoutDuration  time.Duration
+}
+
+type LoginThrottleOptions struct {
+	PerIP  LoginThrottleLimits
+	Global LoginThrottleLimits
+
+	// Window is the duration after the last failure, after which a counter is
+	// reset.
+	Window time.Duration
+}
+
+// LoginThrottledError is returned when a login attempt is rejected because of
+// too many failed attempts.
+type LoginThrottledError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LoginThrottledError) Error() string {
+	return fmt.Sprintf("too many failed login attempts; retry after %s", e.RetryAfter.Round(time.Second))
+}
+
+func (e *LoginThrottledError) StatusCode() int {
+	return http.StatusTooManyRequests
+}
+
+func (e *LoginThrottledError) Message() string {
+	return "too many failed login attempts"
+}
+
+type loginThrottleService struct {
+	repository repository.LoginAttemptRepository
+	options    LoginThrottleOptions
+	now        func() time.Time
+}
+
+func NewLoginThrottleService(r repository.LoginAttemptRepository, opts LoginThrottleOptions) LoginThrottleService {
+	return &loginThrottleService{
+		repository: r,
+		options:    opts,
+		now:        time.Now,
+	}
+}
+
+func (s *loginThrottleService) RegisterLoginAttempt(ctx context.Context, clientIP string) error {
+	key := ipLoginThrottleKey(clientIP)
+
+	for range maxLoginAttemptRetries {
+		previous, err := s.repository.FindLoginAttempts(ctx, key)
+		if err != nil {
+			return fmt.Errorf("error retrieving login attempts: %w", err)
+		}
+
+		retryAfter, err := s.retryAfter(ctx, previous)
+		if err != nil {
+			return err
+		}
+
+		if retryAfter > 0 {
+			return &LoginThrottledError{RetryAfter: retryAfter}
+		}
+
+		now := s.now()
+
+		registered, err := s.repository.RegisterLoginAttemptIfUnchanged(ctx, key, previous.Failures, now, now.Add(s.options.Window))
+		if err != nil {
+			return fmt.Errorf("error registering login attempt: %w", err)
+		}
+
+		if registered {
+			return nil
+		}
+	}
+
+	// The counter keeps being changed by concurrent attempts of the same client.
+	return &LoginThrottledError{RetryAfter: time.Second}
+}
+
+// retryAfter returns how long a client with the given (per-client) attempts
+// needs to wait before its next attempt.
+func (s *loginThrottleService) retryAfter(ctx context.Context, previous model.LoginAttempts) (time.Duration, error) {
+	retryAfter := s.waitTime(previous, s.options.PerIP)
+
+	// Clients without recent failures are never slowed down by the global
+	// counter; otherwise, anyone could lock out all other users.
+	if previous.Failures > 0 {
+		global, err := s.repository.FindLoginAttempts(ctx, globalLoginThrottleKey)
+		if err != nil {
+			return 0, fmt.Errorf("error retrieving login attempts: %w", err)
+		}
+
+		if wait := s.waitTime(global, s.options.Global); wait > retryAfter {
+			retryAfter = wait
+		}
+	}
+
+	return retryAfter, nil
+}
+
+func (s *loginThrottleService) RegisterFailedLogin(ctx context.Context, _ string) error {
+	now := s.now()
+
+	if _, err := s.repository.RegisterLoginAttempt(ctx, globalLoginThrottleKey, now, now.Add(s.options.Window)); err != nil {
+		return fmt.Errorf("error registering failed login attempt: %w", err)
+	}
+
+	return nil
+}
+
+func (s *loginThrottleService) RegisterSuccessfulLogin(ctx context.Context, clientIP string) error {
+	return s.repository.ResetLoginAttempts(ctx, ipLoginThrottleKey(clientIP))
+}
+
+// waitTime computes how long a client needs to wait before the next login
+// attempt is allowed.
+func (s *loginThrottleService) waitTime(attempts model.LoginAttempts, limits LoginThrottleLimits) time.Duration {
+	if attempts.Failures <= limits.FreeAttempts {
+		return 0
+	}
+
+	var delay time.Duration
+
+	if limits.LockoutThreshold > 0 && attempts.Failures >= limits.LockoutThreshold {
+		delay = limits.LockoutDuration
+	} else {
+		delay = limits.BaseDelay
+		for i := limits.FreeAttempts + 1; i < attempts.Failures && delay < limits.MaxDelay; i++ {
+			delay *= 2
+		}
+
+		if limits.MaxDelay > 0 && delay > limits.MaxDelay {
+			delay = limits.MaxDelay
+		}
+	}
+
+	wait := attempts.LastFailure.Add(delay).Sub(s.now())
+	if wait < 0 {
+		return 0
+	}
+
+	return wait
+}
+
+func ipLoginThrottleKey(clientIP string) string {
+	return "ip:" + clientIP
+}
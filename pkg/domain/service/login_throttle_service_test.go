@@ -0,0 +1,134 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mittwald/mstudio-ext-proxy/pkg/domain/service"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/persistence"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("LoginThrottleService", func() {
+	var throttle service.LoginThrottleService
+
+	BeforeEach(func() {
+		throttle = service.NewLoginThrottleService(persistence.NewMemoryLoginAttemptRepository(), service.LoginThrottleOptions{
+			PerIP: service.LoginThrottleLimits{
+				FreeAttempts:     3,
+				BaseDelay:        time.Minute,
+				MaxDelay:         10 * time.Minute,
+				LockoutThreshold: 6,
+				LockoutDuration:  time.Hour,
+			},
+			Global: service.LoginThrottleLimits{
+				FreeAttempts: 5,
+				BaseDelay:    time.Minute,
+				MaxDelay:     10 * time.Minute,
+			},
+			Window: time.Hour,
+		})
+	})
+
+	// fail performs a failed login like the authentication controller does.
+	fail := func(ctx context.Context, clientIP string) error {
+		if err := throttle.RegisterLoginAttempt(ctx, clientIP); err != nil {
+			return err
+		}
+
+		return throttle.RegisterFailedLogin(ctx, clientIP)
+	}
+
+	retryAfter := func(err error) time.Duration {
+		throttled := new(service.LoginThrottledError)
+		Expect(errors.As(err, &throttled)).To(BeTrue())
+		return throttled.RetryAfter
+	}
+
+	It("should throttle a client after the free attempts", func(ctx context.Context) {
+		for range 4 {
+			Expect(throttle.RegisterLoginAttempt(ctx, "192.0.2.1")).To(Succeed())
+		}
+
+		err := throttle.RegisterLoginAttempt(ctx, "192.0.2.1")
+		Expect(retryAfter(err)).To(BeNumerically("~", time.Minute, time.Second))
+	})
+
+	It("should not count rejected attempts", func(ctx context.Context) {
+		for range 4 {
+			Expect(throttle.RegisterLoginAttempt(ctx, "192.0.2.1")).To(Succeed())
+		}
+
+		for range 5 {
+			err := throttle.RegisterLoginAttempt(ctx, "192.0.2.1")
+			Expect(retryAfter(err)).To(BeNumerically("~", time.Minute, time.Second))
+		}
+	})
+
+	It("should lock out a client after the lockout threshold", func(ctx context.Context) {
+		throttle = service.NewLoginThrottleService(persistence.NewMemoryLoginAttemptRepository(), service.LoginThrottleOptions{
+			PerIP:  service.LoginThrottleLimits{LockoutThreshold: 6, LockoutDuration: time.Hour},
+			Window: time.Hour,
+		})
+
+		for range 6 {
+			Expect(throttle.RegisterLoginAttempt(ctx, "192.0.2.1")).To(Succeed())
+		}
+
+		err := throttle.RegisterLoginAttempt(ctx, "192.0.2.1")
+		Expect(retryAfter(err)).To(BeNumerically("~", time.Hour, time.Second))
+	})
+
+	It("should not allow more attempts when they are made concurrently", func(ctx context.Context) {
+		var allowed atomic.Int32
+		var wg sync.WaitGroup
+
+		for range 20 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if throttle.RegisterLoginAttempt(ctx, "192.0.2.1") == nil {
+					allowed.Add(1)
+				}
+			}()
+		}
+
+		wg.Wait()
+		Expect(allowed.Load()).To(BeEquivalentTo(4))
+	})
+
+	It("should reset the counter of a client after a successful login", func(ctx context.Context) {
+		for range 4 {
+			Expect(fail(ctx, "192.0.2.1")).To(Succeed())
+		}
+
+		Expect(throttle.RegisterSuccessfulLogin(ctx, "192.0.2.1")).To(Succeed())
+		Expect(throttle.RegisterLoginAttempt(ctx, "192.0.2.1")).To(Succeed())
+	})
+
+	It("should not throttle other clients because of one client's failures", func(ctx context.Context) {
+		for range 4 {
+			Expect(fail(ctx, "192.0.2.1")).To(Succeed())
+		}
+
+		Expect(throttle.RegisterLoginAttempt(ctx, "192.0.2.1")).To(HaveOccurred())
+		Expect(throttle.RegisterLoginAttempt(ctx, "192.0.2.2")).To(Succeed())
+	})
+
+	It("should slow down failing clients when the global counter is exceeded", func(ctx context.Context) {
+		for i := range 6 {
+			Expect(fail(ctx, fmt.Sprintf("192.0.2.%d", i+1))).To(Succeed())
+		}
+
+		err := throttle.RegisterLoginAttempt(ctx, "192.0.2.1")
+		Expect(retryAfter(err)).To(BeNumerically(">", 0))
+
+		By("not throttling clients without failed attempts")
+		Expect(throttle.RegisterLoginAttempt(ctx, "192.0.2.100")).To(Succeed())
+	})
+})
@@ -2,6 +2,8 @@ package service
 
 import (
 	"context"
+
+	"github.com/mittwald/api-client-go/mittwaldv2"
 	generatedv2 "github.com/mittwald/api-client-go/mittwaldv2/generated/clients"
 	"github.com/mittwald/mstudio-ext-proxy/pkg/domain/model"
 	"github.com/mittwald/mstudio-ext-proxy/pkg/domain/repository"
@@ -17,12 +19,17 @@ type sessionService struct {
 	client             generatedv2.Client
 	sessionRepository  repository.SessionRepository
 	instanceRepository repository.ExtensionInstanceRepository
+
+	// clientOptions are used for building the API clients that act on behalf
+	// of an authenticated user (like the base URL).
+	clientOptions []mittwaldv2.ClientOption
 }
 
-func NewSessionService(c generatedv2.Client, sr repository.SessionRepository, ir repository.ExtensionInstanceRepository) SessionService {
+func NewSessionService(c generatedv2.Client, sr repository.SessionRepository, ir repository.ExtensionInstanceRepository, opts ...mittwaldv2.ClientOption) SessionService {
 	return &sessionService{
 		client:             c,
 		sessionRepository:  sr,
 		instanceRepository: ir,
+		clientOptions:      opts,
 	}
 }
@@ -4,32 +4,53 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"slices"
 	"time"
 
 	"github.com/mittwald/api-client-go/mittwaldv2"
 	"github.com/mittwald/api-client-go/mittwaldv2/generated/clients/userclientv2"
 	"github.com/mittwald/mstudio-ext-proxy/pkg/domain/model"
 	"github.com/mittwald/mstudio-ext-proxy/pkg/httperr"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/tracing"
+	"go.opentelemetry.io/otel/trace"
 )
 
 func (s *sessionService) InitializeSessionFromRetrievalKey(ctx context.Context, atrek, userID, instanceID string) (*model.Session, error) {
+	ctx, span := tracing.Start(ctx, "session.Initialize", trace.WithAttributes(
+		tracing.AttrUserID.String(userID),
+		tracing.AttrInstanceID.String(instanceID),
+	))
+
+	session, err := s.initializeSessionFromRetrievalKey(ctx, atrek, userID, instanceID)
+	tracing.End(span, err)
+
+	return session, err
+}
+
+func (s *sessionService) initializeSessionFromRetrievalKey(ctx context.Context, atrek, userID, instanceID string) (*model.Session, error) {
 	token, refresh, exp, err := s.getAPITokenFromATREK(ctx, atrek, userID)
 	if err != nil {
 		return nil, fmt.Errorf("error getting access token for user %s: %w", userID, err)
 	}
 
-	instance, err := s.instanceRepository.FindExtensionInstanceByID(ctx, instanceID)
+	instanceCtx, instanceSpan := tracing.Start(ctx, "instances.FindExtensionInstanceByID")
+	instance, err := s.instanceRepository.FindExtensionInstanceByID(instanceCtx, instanceID)
+	tracing.End(instanceSpan, err)
 	if err != nil {
 		return nil, httperr.ErrWithStatus(http.StatusNotFound, "instance not found", fmt.Errorf("error getting instance %s: %w", instanceID, err))
 	}
 
-	authClient, err := mittwaldv2.New(ctx, mittwaldv2.WithAccessToken(token))
+	opts := append(slices.Clone(s.clientOptions), mittwaldv2.WithAccessToken(token))
+
+	authClient, err := mittwaldv2.New(ctx, opts...)
 	if err != nil {
 		return nil, fmt.Errorf("error authenticating at API: %w", err)
 	}
 
+	userCtx, userSpan := tracing.Start(ctx, "mstudio.GetUser")
 	req := userclientv2.GetUserRequest{UserID: userID}
-	resp, _, err := authClient.User().GetUser(ctx, req)
+	resp, _, err := authClient.User().GetUser(userCtx, req)
+	tracing.End(userSpan, err)
 	if err != nil {
 		return nil, fmt.Errorf("error initializing session: %w", err)
 	}
@@ -48,7 +69,10 @@ func (s *sessionService) InitializeSessionFromRetrievalKey(ctx context.Context,
 	session.RefreshToken = refresh
 	session.Instance = instance
 
-	if err := s.sessionRepository.CreateSessionWithUnhashedSecret(ctx, session); err != nil {
+	createCtx, createSpan := tracing.Start(ctx, "session.Create")
+	err = s.sessionRepository.CreateSessionWithUnhashedSecret(createCtx, session)
+	tracing.End(createSpan, err)
+	if err != nil {
 		return nil, fmt.Errorf("error creating session: %w", err)
 	}
 
@@ -63,7 +87,9 @@ func (s *sessionService) getAPITokenFromATREK(ctx context.Context, atrek, userID
 		},
 	}
 
+	ctx, span := tracing.Start(ctx, "mstudio.AuthenticateWithAccessTokenRetrievalKey")
 	resp, _, err := s.client.User().AuthenticateWithAccessTokenRetrievalKey(ctx, req)
+	tracing.End(span, err)
 	if err != nil {
 		return "", "", time.Time{}, httperr.ErrWithStatus(http.StatusUnauthorized, "invalid retrieval key", err)
 	}
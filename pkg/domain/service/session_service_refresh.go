@@ -5,9 +5,25 @@ import (
 
 	"github.com/mittwald/api-client-go/mittwaldv2/generated/clients/userclientv2"
 	"github.com/mittwald/mstudio-ext-proxy/pkg/domain/model"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/metrics"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/tracing"
+	"go.opentelemetry.io/otel/trace"
 )
 
 func (s *sessionService) RefreshSession(ctx context.Context, session *model.Session) (*model.Session, error) {
+	ctx, span := tracing.Start(ctx, "session.Refresh", trace.WithAttributes(
+		tracing.AttrUserID.String(session.UserID),
+		tracing.AttrInstanceID.String(session.Instance.ID),
+	))
+
+	newSession, err := s.refreshSession(ctx, session)
+	metrics.SessionRefreshes.WithLabelValues(metrics.Result(err)).Inc()
+	tracing.End(span, err)
+
+	return newSession, err
+}
+
+func (s *sessionService) refreshSession(ctx context.Context, session *model.Session) (*model.Session, error) {
 	req := userclientv2.RefreshSessionRequest{
 		Body: userclientv2.RefreshSessionRequestBody{
 			RefreshToken: session.RefreshToken,
@@ -2,18 +2,39 @@ package service
 
 import (
 	"context"
+	"fmt"
 	"github.com/mittwald/mstudio-ext-proxy/pkg/domain/model"
 	"github.com/mittwald/mstudio-ext-proxy/pkg/httperr"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/metrics"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/tracing"
 	"net/http"
+	"time"
 )
 
 func (s *sessionService) RetrieveSession(ctx context.Context, sessionID string, sessionSecret []byte) (*model.Session, error) {
+	ctx, span := tracing.Start(ctx, "session.Retrieve")
+	defer span.End()
+
+	start := time.Now()
 	session, err := s.sessionRepository.FindSessionByIDAndSecret(ctx, sessionID, sessionSecret)
+	metrics.SessionLookupDuration.WithLabelValues(metrics.Result(err)).Observe(time.Since(start).Seconds())
+
 	if err != nil {
 		return nil, httperr.ErrWithStatus(http.StatusUnauthorized, "invalid session", err)
 	}
 
+	span.SetAttributes(
+		tracing.AttrUserID.String(session.UserID),
+		tracing.AttrInstanceID.String(session.Instance.ID),
+	)
+
 	if session.IsExpired() {
+		// sessions that were not initialized via mStudio (like the password
+		// login) cannot be refreshed and need to re-authenticate
+		if session.RefreshToken == "" {
+			return nil, httperr.ErrWithStatus(http.StatusUnauthorized, "session expired", fmt.Errorf("session %s has expired", session.ID))
+		}
+
 		refreshedSession, err := s.RefreshSession(ctx, session)
 		if err != nil {
 			return nil, httperr.ErrWithStatus(http.StatusInternalServerError, "internal server error", err)
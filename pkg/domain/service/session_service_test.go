@@ -0,0 +1,155 @@
+package service_test
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/mittwald/api-client-go/mittwaldv2"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/domain/model"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/domain/repository"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/domain/service"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/httperr"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/mstudiotest"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/persistence"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("SessionService", func() {
+	var api *mstudiotest.Server
+	var sessionRepository repository.SessionRepository
+	var sessionService service.SessionService
+
+	instance := model.ExtensionInstance{
+		ID:      "instance",
+		Enabled: true,
+		Context: model.ExtensionInstanceContext{ID: "project", Kind: "project"},
+	}
+
+	BeforeEach(func(ctx context.Context) {
+		api = mstudiotest.NewServer()
+		DeferCleanup(api.Close)
+
+		api.AddUser(mstudiotest.User{ID: "user", Email: "max@example.com", FirstName: "Max", LastName: "Mustermann"})
+
+		client, err := mittwaldv2.New(ctx, api.ClientOptions()...)
+		Expect(err).NotTo(HaveOccurred())
+
+		sessionRepository = persistence.NewMemorySessionRepository()
+		sessionService = service.NewSessionService(client, sessionRepository, persistence.NewMemoryExtensionInstanceRepository(instance), api.ClientOptions()...)
+	})
+
+	Describe("one-click login", func() {
+		It("should initialize a session from a retrieval key", func(ctx context.Context) {
+			session, err := sessionService.InitializeSessionFromRetrievalKey(ctx, api.IssueRetrievalKey("user"), "user", "instance")
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(session.UserID).To(Equal("user"))
+			Expect(session.Email).To(Equal("max@example.com"))
+			Expect(session.FirstName).To(Equal("Max"))
+			Expect(session.LastName).To(Equal("Mustermann"))
+			Expect(session.AccessToken).NotTo(BeEmpty())
+			Expect(session.RefreshToken).NotTo(BeEmpty())
+			Expect(session.Expires).To(BeTemporally("~", time.Now().Add(mstudiotest.DefaultTokenTTL), 2*time.Second))
+			Expect(session.Instance.ID).To(Equal("instance"))
+
+			stored, err := sessionService.RetrieveSession(ctx, session.ID, session.SessionSecret)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(stored.AccessToken).To(Equal(session.AccessToken))
+		})
+
+		It("should reject a retrieval key that was already used", func(ctx context.Context) {
+			atrek := api.IssueRetrievalKey("user")
+
+			_, err := sessionService.InitializeSessionFromRetrievalKey(ctx, atrek, "user", "instance")
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = sessionService.InitializeSessionFromRetrievalKey(ctx, atrek, "user", "instance")
+			Expect(httperr.StatusForError(err)).To(Equal(http.StatusUnauthorized))
+		})
+
+		It("should reject a retrieval key of a different user", func(ctx context.Context) {
+			_, err := sessionService.InitializeSessionFromRetrievalKey(ctx, api.IssueRetrievalKey("other"), "user", "instance")
+			Expect(httperr.StatusForError(err)).To(Equal(http.StatusUnauthorized))
+		})
+
+		It("should fail for unknown instances", func(ctx context.Context) {
+			_, err := sessionService.InitializeSessionFromRetrievalKey(ctx, api.IssueRetrievalKey("user"), "user", "unknown")
+			Expect(httperr.StatusForError(err)).To(Equal(http.StatusNotFound))
+		})
+
+		It("should fail when the user cannot be retrieved", func(ctx context.Context) {
+			api.FailNext(mstudiotest.EndpointGetUser, http.StatusServiceUnavailable, 1)
+
+			_, err := sessionService.InitializeSessionFromRetrievalKey(ctx, api.IssueRetrievalKey("user"), "user", "instance")
+			Expect(err).To(HaveOccurred())
+			Expect(api.RequestCount(mstudiotest.EndpointGetUser)).To(Equal(1))
+		})
+
+		It("should respect the context deadline when the API is slow", func(ctx context.Context) {
+			api.SetLatency(mstudiotest.EndpointAuthenticateWithRetrievalKey, time.Second)
+
+			ctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+			defer cancel()
+
+			start := time.Now()
+			_, err := sessionService.InitializeSessionFromRetrievalKey(ctx, api.IssueRetrievalKey("user"), "user", "instance")
+			Expect(err).To(MatchError(ContainSubstring("context deadline exceeded")))
+			Expect(time.Since(start)).To(BeNumerically("<", time.Second))
+		})
+	})
+
+	Describe("refresh", func() {
+		var session *model.Session
+
+		BeforeEach(func(ctx context.Context) {
+			var err error
+			session, err = sessionService.InitializeSessionFromRetrievalKey(ctx, api.IssueRetrievalKey("user"), "user", "instance")
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		expire := func(ctx context.Context) {
+			expired := *session
+			expired.Expires = time.Now().Add(-time.Minute)
+			Expect(sessionRepository.RefreshSession(ctx, expired)).To(Succeed())
+		}
+
+		It("should not refresh sessions that are still valid", func(ctx context.Context) {
+			retrieved, err := sessionService.RetrieveSession(ctx, session.ID, session.SessionSecret)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(retrieved.AccessToken).To(Equal(session.AccessToken))
+			Expect(api.RequestCount(mstudiotest.EndpointRefreshSession)).To(Equal(0))
+		})
+
+		It("should refresh expired sessions", func(ctx context.Context) {
+			expire(ctx)
+
+			retrieved, err := sessionService.RetrieveSession(ctx, session.ID, session.SessionSecret)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(retrieved.AccessToken).NotTo(Equal(session.AccessToken))
+			Expect(retrieved.RefreshToken).NotTo(Equal(session.RefreshToken))
+			Expect(retrieved.IsExpired()).To(BeFalse())
+
+			stored, err := sessionRepository.FindSessionByIDAndSecret(ctx, session.ID, session.SessionSecret)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(stored.AccessToken).To(Equal(retrieved.AccessToken))
+		})
+
+		It("should fail when the refresh token was revoked", func(ctx context.Context) {
+			expire(ctx)
+			api.RevokeTokens("user")
+
+			_, err := sessionService.RetrieveSession(ctx, session.ID, session.SessionSecret)
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("should fail when the API is unavailable", func(ctx context.Context) {
+			expire(ctx)
+			api.FailNext(mstudiotest.EndpointRefreshSession, http.StatusBadGateway, 1)
+
+			_, err := sessionService.RetrieveSession(ctx, session.ID, session.SessionSecret)
+			Expect(httperr.StatusForError(err)).To(Equal(http.StatusInternalServerError))
+		})
+	})
+})
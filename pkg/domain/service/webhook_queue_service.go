@@ -0,0 +1,123 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/mittwald/mstudio-ext-proxy/pkg/domain/model"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/domain/repository"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/httperr"
+)
+
+// ErrWebhookReplayed is returned when a webhook is received again after the
+// redelivery window of its first delivery has passed.
+var ErrWebhookReplayed = errors.New("webhook was already received")
+
+// WebhookQueueService persists verified webhooks for asynchronous processing
+// by a WebhookWorker, and allows inspecting and replaying webhooks that could
+// not be processed.
+type WebhookQueueService interface {
+	// EnqueueWebhook records a verified webhook in the delivery log and enqueues
+	// it, and returns its delivery with the ID and instance ID filled in. The
+	// delivery ID is derived from the webhook payload; a webhook that was
+	// already received within the redelivery window is acknowledged without
+	// being enqueued again, and one received after that is rejected with
+	// ErrWebhookReplayed.
+	EnqueueWebhook(ctx context.Context, delivery model.WebhookDelivery, wh any, payload []byte) (*model.WebhookDelivery, error)
+	ListDeadLetters(ctx context.Context) ([]model.QueuedWebhook, error)
+	GetDeadLetter(ctx context.Context, id string) (*model.QueuedWebhook, error)
+	ReplayDeadLetter(ctx context.Context, id string) error
+}
+
+type webhookQueueService struct {
+	queueRepository    repository.WebhookQueueRepository
+	deliveryRepository repository.WebhookDeliveryRepository
+	redeliveryWindow   time.Duration
+}
+
+func NewWebhookQueueService(qr repository.WebhookQueueRepository, dr repository.WebhookDeliveryRepository, redeliveryWindow time.Duration) WebhookQueueService {
+	return &webhookQueueService{
+		queueRepository:    qr,
+		deliveryRepository: dr,
+		redeliveryWindow:   redeliveryWindow,
+	}
+}
+
+func (s *webhookQueueService) EnqueueWebhook(ctx context.Context, delivery model.WebhookDelivery, wh any, payload []byte) (*model.WebhookDelivery, error) {
+	now := time.Now()
+
+	delivery.InstanceID = instanceIDFromWebhook(wh)
+	delivery.ID = model.WebhookDeliveryID(delivery.Kind, delivery.InstanceID, delivery.PayloadHash)
+
+	existing, err := s.deliveryRepository.FindWebhookDeliveryByID(ctx, delivery.ID)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving webhook delivery log: %w", err)
+	}
+
+	if existing != nil {
+		return s.acknowledgeRedelivery(ctx, *existing, now)
+	}
+
+	delivery.Outcome = model.WebhookDeliveryOutcomeQueued
+	delivery.FirstReceived = now
+	delivery.LastReceived = now
+	delivery.Expires = now.Add(webhookDeliveryRetention)
+
+	if err := s.deliveryRepository.SaveWebhookDelivery(ctx, delivery); err != nil {
+		return nil, fmt.Errorf("error updating webhook delivery log: %w", err)
+	}
+
+	queued := model.QueuedWebhook{
+		ID:              delivery.ID,
+		PayloadHash:     delivery.PayloadHash,
+		Kind:            delivery.Kind,
+		APIVersion:      delivery.APIVersion,
+		InstanceID:      delivery.InstanceID,
+		SignatureSerial: delivery.SignatureSerial,
+		Payload:         payload,
+		Enqueued:        now,
+		NextAttempt:     now,
+	}
+
+	if err := s.queueRepository.EnqueueWebhook(ctx, queued); err != nil {
+		return nil, fmt.Errorf("error enqueueing webhook: %w", err)
+	}
+
+	return &delivery, nil
+}
+
+// acknowledgeRedelivery records a repeated delivery of a webhook. Within the
+// redelivery window, this is a retry of the marketplace (for example, after
+// its first delivery timed out), which is acknowledged; the webhook was
+// already enqueued and is not processed again. After that, the request is
+// rejected as a replay.
+func (s *webhookQueueService) acknowledgeRedelivery(ctx context.Context, existing model.WebhookDelivery, now time.Time) (*model.WebhookDelivery, error) {
+	existing.Duplicates++
+	existing.LastReceived = now
+
+	if err := s.deliveryRepository.SaveWebhookDelivery(ctx, existing); err != nil {
+		return nil, fmt.Errorf("error updating webhook delivery log: %w", err)
+	}
+
+	if now.Sub(existing.FirstReceived) > s.redeliveryWindow {
+		err := fmt.Errorf("%w at %s, which is outside of the redelivery window", ErrWebhookReplayed, existing.FirstReceived.Format(time.RFC3339))
+		return &existing, httperr.ErrWithStatus(http.StatusConflict, "rejecting replayed webhook", err)
+	}
+
+	return &existing, nil
+}
+
+func (s *webhookQueueService) ListDeadLetters(ctx context.Context) ([]model.QueuedWebhook, error) {
+	return s.queueRepository.FindDeadLetters(ctx)
+}
+
+func (s *webhookQueueService) GetDeadLetter(ctx context.Context, id string) (*model.QueuedWebhook, error) {
+	return s.queueRepository.FindDeadLetterByID(ctx, id)
+}
+
+func (s *webhookQueueService) ReplayDeadLetter(ctx context.Context, id string) error {
+	return s.queueRepository.ReplayDeadLetter(ctx, id)
+}
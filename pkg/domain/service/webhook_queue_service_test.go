@@ -0,0 +1,121 @@
+package service_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/mittwald/mstudio-ext-proxy/pkg/domain/model"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/domain/repository"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/domain/service"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/httperr"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/persistence"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/webhooks/webhookscommon"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/webhooks/webhooksv1"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("WebhookQueueService", func() {
+	const redeliveryWindow = time.Hour
+
+	var queue repository.WebhookQueueRepository
+	var deliveries repository.WebhookDeliveryRepository
+	var queueService service.WebhookQueueService
+
+	updated := func(enabled bool) *webhooksv1.ExtensionInstanceUpdated {
+		return &webhooksv1.ExtensionInstanceUpdated{
+			Envelope: webhookscommon.Envelope{APIVersion: "v1", Kind: "ExtensionInstanceUpdated"},
+			ID:       "instance",
+			State:    webhooksv1.State{Enabled: enabled},
+			Meta:     webhooksv1.Meta{ExtensionID: "extension"},
+		}
+	}
+
+	// enqueue enqueues a webhook, like the webhook controller does.
+	enqueue := func(ctx context.Context, wh *webhooksv1.ExtensionInstanceUpdated) (*model.WebhookDelivery, error) {
+		payload, err := json.Marshal(wh)
+		Expect(err).NotTo(HaveOccurred())
+
+		hash := sha256.Sum256(payload)
+		delivery := model.WebhookDelivery{
+			PayloadHash: hex.EncodeToString(hash[:]),
+			Kind:        wh.Kind,
+			APIVersion:  wh.APIVersion,
+		}
+
+		return queueService.EnqueueWebhook(ctx, delivery, wh, payload)
+	}
+
+	queuedIDs := func(ctx context.Context) []string {
+		ids := make([]string, 0)
+		for {
+			wh, err := queue.ClaimDueWebhook(ctx, time.Now(), time.Hour)
+			Expect(err).NotTo(HaveOccurred())
+
+			if wh == nil {
+				return ids
+			}
+
+			ids = append(ids, wh.ID)
+		}
+	}
+
+	BeforeEach(func() {
+		queue = persistence.NewMemoryWebhookQueueRepository()
+		deliveries = persistence.NewMemoryWebhookDeliveryRepository()
+		queueService = service.NewWebhookQueueService(queue, deliveries, redeliveryWindow)
+	})
+
+	It("should record and enqueue new webhooks", func(ctx context.Context) {
+		disabled, err := enqueue(ctx, updated(false))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(disabled.InstanceID).To(Equal("instance"))
+
+		enabled, err := enqueue(ctx, updated(true))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(enabled.ID).NotTo(Equal(disabled.ID))
+
+		Expect(queuedIDs(ctx)).To(ConsistOf(disabled.ID, enabled.ID))
+
+		recorded, err := deliveries.FindWebhookDeliveryByID(ctx, disabled.ID)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(recorded).NotTo(BeNil())
+		Expect(recorded.Outcome).To(Equal(model.WebhookDeliveryOutcomeQueued))
+		Expect(recorded.Expires).To(BeTemporally(">", time.Now().Add(redeliveryWindow)))
+	})
+
+	It("should acknowledge a redelivery within the redelivery window without enqueueing it again", func(ctx context.Context) {
+		first, err := enqueue(ctx, updated(false))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(queuedIDs(ctx)).To(Equal([]string{first.ID}))
+
+		redelivered, err := enqueue(ctx, updated(false))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(redelivered.ID).To(Equal(first.ID))
+		Expect(redelivered.Duplicates).To(Equal(1))
+
+		Expect(queuedIDs(ctx)).To(BeEmpty())
+	})
+
+	It("should reject a replay after the redelivery window", func(ctx context.Context) {
+		first, err := enqueue(ctx, updated(false))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(queuedIDs(ctx)).To(Equal([]string{first.ID}))
+
+		recorded, err := deliveries.FindWebhookDeliveryByID(ctx, first.ID)
+		Expect(err).NotTo(HaveOccurred())
+
+		recorded.FirstReceived = recorded.FirstReceived.Add(-2 * redeliveryWindow)
+		Expect(deliveries.SaveWebhookDelivery(ctx, *recorded)).To(Succeed())
+
+		_, err = enqueue(ctx, updated(false))
+		Expect(err).To(MatchError(service.ErrWebhookReplayed))
+		Expect(httperr.StatusForError(err)).To(Equal(http.StatusConflict))
+
+		Expect(queuedIDs(ctx)).To(BeEmpty())
+	})
+})
@@ -0,0 +1,224 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/mittwald/mstudio-ext-proxy/pkg/domain/model"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/domain/repository"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/events"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/webhooks/webhooksv1"
+)
+
+// webhookDeliveryRetention is the duration for which entries of the webhook
+// delivery log are kept.
+const webhookDeliveryRetention = 30 * 24 * time.Hour
+
+// ErrWebhookAlreadyProcessed is returned when a webhook (or an earlier delivery
+// with the same payload) was already processed successfully. Callers should
+// treat this as success.
+var ErrWebhookAlreadyProcessed = errors.New("webhook was already processed")
+
+// WebhookService applies the lifecycle webhooks sent by the mStudio to the
+// local extension instance state, and forwards them to the upstream
+// applications. Each webhook is recorded in a delivery log, keyed by its kind,
+// instance and payload hash. A webhook with the same key as any processed
+// entry of the delivery log is considered a redelivery, and is not applied
+// again.
+type WebhookService interface {
+	ProcessWebhook(ctx context.Context, delivery model.WebhookDelivery, wh any) (*model.WebhookDelivery, error)
+}
+
+type webhookService struct {
+	instanceRepository repository.ExtensionInstanceRepository
+	deliveryRepository repository.WebhookDeliveryRepository
+	eventPublisher     EventPublisher
+}
+
+func NewWebhookService(ir repository.ExtensionInstanceRepository, dr repository.WebhookDeliveryRepository, ep EventPublisher) WebhookService {
+	return &webhookService{
+		instanceRepository: ir,
+		deliveryRepository: dr,
+		eventPublisher:     ep,
+	}
+}
+
+func (s *webhookService) ProcessWebhook(ctx context.Context, delivery model.WebhookDelivery, wh any) (*model.WebhookDelivery, error) {
+	start := time.Now()
+
+	existing, err := s.deliveryRepository.FindWebhookDeliveryByID(ctx, delivery.ID)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving webhook delivery log: %w", err)
+	}
+
+	if existing != nil && existing.IsProcessed() {
+		existing.Duplicates++
+		existing.LastReceived = start
+
+		if err := s.deliveryRepository.SaveWebhookDelivery(ctx, *existing); err != nil {
+			return nil, fmt.Errorf("error updating webhook delivery log: %w", err)
+		}
+
+		return existing, ErrWebhookAlreadyProcessed
+	}
+
+	if delivery.FirstReceived.IsZero() {
+		delivery.FirstReceived = start
+	}
+
+	if existing != nil {
+		delivery.FirstReceived = existing.FirstReceived
+		delivery.Attempts = existing.Attempts
+		delivery.Duplicates = existing.Duplicates
+	}
+
+	delivery.LastReceived = start
+	delivery.InstanceID = instanceIDFromWebhook(wh)
+
+	delivery.Attempts++
+
+	processErr := s.applyWebhook(ctx, delivery, wh)
+
+	delivery.Duration = time.Since(start)
+	delivery.Expires = start.Add(webhookDeliveryRetention)
+
+	if processErr != nil {
+		delivery.Outcome = model.WebhookDeliveryOutcomeFailed
+		delivery.Error = processErr.Error()
+	} else {
+		delivery.Outcome = model.WebhookDeliveryOutcomeProcessed
+		delivery.Error = ""
+		delivery.ProcessedAt = time.Now()
+	}
+
+	if err := s.deliveryRepository.SaveWebhookDelivery(ctx, delivery); err != nil {
+		return &delivery, errors.Join(processErr, fmt.Errorf("error updating webhook delivery log: %w", err))
+	}
+
+	return &delivery, processErr
+}
+
+// applyWebhook applies a webhook to the local state, and then publishes a
+// lifecycle event for the upstream applications.
+func (s *webhookService) applyWebhook(ctx context.Context, delivery model.WebhookDelivery, wh any) error {
+	var instance model.ExtensionInstance
+	var kind events.Kind
+	var err error
+
+	switch wht := wh.(type) {
+	case *webhooksv1.ExtensionAddedToContext:
+		kind = events.KindInstanceAdded
+		instance, err = s.handleExtensionAddedToContextV1(ctx, wht)
+	case *webhooksv1.ExtensionInstanceUpdated:
+		kind = events.KindInstanceUpdated
+		instance, err = s.handleExtensionUpdatedV1(ctx, wht)
+	case *webhooksv1.ExtensionInstanceSecretRotated:
+		kind = events.KindInstanceSecretRotated
+		instance, err = s.handleExtensionSecretRotatedV1(ctx, wht)
+	case *webhooksv1.ExtensionInstanceRemovedFromContext:
+		kind = events.KindInstanceRemoved
+		instance, err = s.handleExtensionInstanceRemovedFromContextV1(ctx, wht)
+	default:
+		return fmt.Errorf("unsupported webhook type %T", wh)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	// The event ID is the ID of the webhook delivery, so that upstream
+	// applications can detect duplicates when a webhook is processed again.
+	event := events.Event{
+		ID:         delivery.ID,
+		Kind:       kind,
+		OccurredAt: delivery.FirstReceived,
+		Instance:   instance,
+	}
+
+	if err := s.eventPublisher.PublishEvent(ctx, event); err != nil {
+		return fmt.Errorf("error publishing lifecycle event: %w", err)
+	}
+
+	return nil
+}
+
+func (s *webhookService) handleExtensionAddedToContextV1(ctx context.Context, wh *webhooksv1.ExtensionAddedToContext) (model.ExtensionInstance, error) {
+	instance := model.ExtensionInstance{
+		ID:          wh.ID,
+		ExtensionID: wh.Meta.ExtensionID,
+		Context: model.ExtensionInstanceContext{
+			ID:   wh.Context.ID,
+			Kind: string(wh.Context.Kind),
+		},
+		Enabled: wh.State.Enabled,
+		Scopes:  wh.ConsentedScopes,
+		Secret:  []byte(wh.Secret),
+	}
+
+	return instance, s.instanceRepository.AddExtensionInstance(ctx, instance)
+}
+
+func (s *webhookService) handleExtensionUpdatedV1(ctx context.Context, wh *webhooksv1.ExtensionInstanceUpdated) (model.ExtensionInstance, error) {
+	instance, err := s.instanceRepository.FindExtensionInstanceByID(ctx, wh.ID)
+	if err != nil {
+		return instance, err
+	}
+
+	if wh.Meta.ExtensionID != "" {
+		instance.ExtensionID = wh.Meta.ExtensionID
+	}
+
+	instance.Scopes = wh.ConsentedScopes
+	instance.Enabled = wh.State.Enabled
+
+	return instance, s.instanceRepository.UpdateExtensionInstance(ctx, instance)
+}
+
+func (s *webhookService) handleExtensionSecretRotatedV1(ctx context.Context, wh *webhooksv1.ExtensionInstanceSecretRotated) (model.ExtensionInstance, error) {
+	instance, err := s.instanceRepository.FindExtensionInstanceByID(ctx, wh.ID)
+	if err != nil {
+		return instance, err
+	}
+
+	if wh.Meta.ExtensionID != "" {
+		instance.ExtensionID = wh.Meta.ExtensionID
+	}
+
+	instance.Secret = []byte(wh.Secret)
+
+	return instance, s.instanceRepository.UpdateExtensionInstance(ctx, instance)
+}
+
+func (s *webhookService) handleExtensionInstanceRemovedFromContextV1(ctx context.Context, wh *webhooksv1.ExtensionInstanceRemovedFromContext) (model.ExtensionInstance, error) {
+	// The removal webhook does not contain the instance secret, so the event
+	// is built from the webhook itself.
+	instance := model.ExtensionInstance{
+		ID:          wh.ID,
+		ExtensionID: wh.Meta.ExtensionID,
+		Context: model.ExtensionInstanceContext{
+			ID:   wh.Context.ID,
+			Kind: string(wh.Context.Kind),
+		},
+		Enabled: wh.State.Enabled,
+		Scopes:  wh.ConsentedScopes,
+	}
+
+	return instance, s.instanceRepository.RemoveExtensionInstanceByID(ctx, wh.ID)
+}
+
+func instanceIDFromWebhook(wh any) string {
+	switch wht := wh.(type) {
+	case *webhooksv1.ExtensionAddedToContext:
+		return wht.ID
+	case *webhooksv1.ExtensionInstanceUpdated:
+		return wht.ID
+	case *webhooksv1.ExtensionInstanceSecretRotated:
+		return wht.ID
+	case *webhooksv1.ExtensionInstanceRemovedFromContext:
+		return wht.ID
+	default:
+		return ""
+	}
+}
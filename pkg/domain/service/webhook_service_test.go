@@ -0,0 +1,144 @@
+package service_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/mittwald/mstudio-ext-proxy/pkg/domain/model"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/domain/repository"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/domain/service"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/events"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/persistence"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/webhooks/webhookscommon"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/webhooks/webhooksv1"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+type recordingEventPublisher struct {
+	lock   sync.Mutex
+	events []events.Event
+}
+
+func (p *recordingEventPublisher) PublishEvent(_ context.Context, event events.Event) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.events = append(p.events, event)
+	return nil
+}
+
+func (p *recordingEventPublisher) Events() []events.Event {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	return append([]events.Event{}, p.events...)
+}
+
+var _ = Describe("WebhookService", func() {
+	var instances repository.ExtensionInstanceRepository
+	var publisher *recordingEventPublisher
+	var webhookService service.WebhookService
+
+	updated := func(enabled bool) *webhooksv1.ExtensionInstanceUpdated {
+		return &webhooksv1.ExtensionInstanceUpdated{
+			Envelope: webhookscommon.Envelope{APIVersion: "v1", Kind: "ExtensionInstanceUpdated"},
+			ID:       "instance",
+			Context:  webhooksv1.Context{ID: "project", Kind: webhooksv1.ContextKindProject},
+			State:    webhooksv1.State{Enabled: enabled},
+			Meta:     webhooksv1.Meta{ExtensionID: "extension"},
+		}
+	}
+
+	// receive builds the delivery of a webhook request, like the webhook
+	// controller does.
+	receive := func(wh any, received time.Time) model.WebhookDelivery {
+		payload, err := json.Marshal(wh)
+		Expect(err).NotTo(HaveOccurred())
+
+		hash := sha256.Sum256(payload)
+		payloadHash := hex.EncodeToString(hash[:])
+		return model.WebhookDelivery{
+			ID:            model.WebhookDeliveryID("ExtensionInstanceUpdated", "instance", payloadHash),
+			PayloadHash:   payloadHash,
+			Kind:          "ExtensionInstanceUpdated",
+			APIVersion:    "v1",
+			FirstReceived: received,
+		}
+	}
+
+	enabledStates := func() []bool {
+		states := make([]bool, 0)
+		for _, e := range publisher.Events() {
+			states = append(states, e.Instance.Enabled)
+		}
+		return states
+	}
+
+	BeforeEach(func() {
+		instances = persistence.NewMemoryExtensionInstanceRepository(model.ExtensionInstance{ID: "instance", ExtensionID: "extension", Enabled: true})
+		publisher = &recordingEventPublisher{}
+		webhookService = service.NewWebhookService(instances, persistence.NewMemoryWebhookDeliveryRepository(), publisher)
+	})
+
+	It("should apply distinct state changes", func(ctx context.Context) {
+		start := time.Now()
+
+		for i, enabled := range []bool{false, true} {
+			_, err := webhookService.ProcessWebhook(ctx, receive(updated(enabled), start.Add(time.Duration(i)*time.Second)), updated(enabled))
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		Expect(enabledStates()).To(Equal([]bool{false, true}))
+
+		instance, err := instances.FindExtensionInstanceByID(ctx, "instance")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(instance.Enabled).To(BeTrue())
+	})
+
+	It("should not apply a redelivery", func(ctx context.Context) {
+		start := time.Now()
+
+		first, err := webhookService.ProcessWebhook(ctx, receive(updated(false), start), updated(false))
+		Expect(err).NotTo(HaveOccurred())
+
+		duplicate, err := webhookService.ProcessWebhook(ctx, receive(updated(false), start.Add(10*time.Second)), updated(false))
+		Expect(err).To(MatchError(service.ErrWebhookAlreadyProcessed))
+		Expect(duplicate.ID).To(Equal(first.ID))
+		Expect(duplicate.Duplicates).To(Equal(1))
+
+		Expect(enabledStates()).To(Equal([]bool{false}))
+	})
+
+	It("should not apply a redelivery of an earlier webhook", func(ctx context.Context) {
+		start := time.Now()
+
+		for i, enabled := range []bool{false, true} {
+			_, err := webhookService.ProcessWebhook(ctx, receive(updated(enabled), start.Add(time.Duration(i)*time.Second)), updated(enabled))
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		_, err := webhookService.ProcessWebhook(ctx, receive(updated(false), start.Add(24*time.Hour)), updated(false))
+		Expect(err).To(MatchError(service.ErrWebhookAlreadyProcessed))
+
+		Expect(enabledStates()).To(Equal([]bool{false, true}))
+
+		instance, err := instances.FindExtensionInstanceByID(ctx, "instance")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(instance.Enabled).To(BeTrue())
+	})
+
+	It("should use the delivery ID as event ID", func(ctx context.Context) {
+		delivery := receive(updated(false), time.Now())
+
+		_, err := webhookService.ProcessWebhook(ctx, delivery, updated(false))
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(publisher.Events()).To(HaveLen(1))
+		Expect(publisher.Events()[0].ID).To(Equal(delivery.ID))
+	})
+})
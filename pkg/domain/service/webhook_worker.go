@@ -0,0 +1,182 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/mittwald/mstudio-ext-proxy/pkg/domain/model"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/domain/repository"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/metrics"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/webhooks"
+)
+
+// webhookQueueLease is the duration for which a claimed webhook is not handed
+// out to other workers.
+const webhookQueueLease = 5 * time.Minute
+
+// webhookOrderingDelay is the delay after which a webhook is tried again when
+// an earlier webhook for the same instance is still pending.
+const webhookOrderingDelay = 5 * time.Second
+
+type WebhookWorkerOptions struct {
+	Concurrency  int
+	PollInterval time.Duration
+	BaseDelay    time.Duration
+	MaxDelay     time.Duration
+	MaxAttempts  int
+}
+
+// WebhookWorker processes the webhooks from the webhook queue. Webhooks for the
+// same extension instance are processed in the order in which they were
+// received. Failed webhooks are retried with exponential backoff; after the
+// maximum number of attempts, they are moved to the dead-letter collection.
+type WebhookWorker struct {
+	queueRepository repository.WebhookQueueRepository
+	webhookService  WebhookService
+	options         WebhookWorkerOptions
+	logger          *slog.Logger
+}
+
+func NewWebhookWorker(r repository.WebhookQueueRepository, s WebhookService, opts WebhookWorkerOptions, logger *slog.Logger) *WebhookWorker {
+	return &WebhookWorker{
+		queueRepository: r,
+		webhookService:  s,
+		options:         opts,
+		logger:          logger,
+	}
+}
+
+// Run starts the configured number of workers and blocks until the context is
+// cancelled.
+func (w *WebhookWorker) Run(ctx context.Context) {
+	concurrency := max(w.options.Concurrency, 1)
+	done := make(chan struct{}, concurrency)
+
+	for range concurrency {
+		go func() {
+			w.run(ctx)
+			done <- struct{}{}
+		}()
+	}
+
+	for range concurrency {
+		<-done
+	}
+}
+
+func (w *WebhookWorker) run(ctx context.Context) {
+	ticker := time.NewTicker(w.options.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		w.processDueWebhooks(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (w *WebhookWorker) processDueWebhooks(ctx context.Context) {
+	for ctx.Err() == nil {
+		queued, err := w.queueRepository.ClaimDueWebhook(ctx, time.Now(), webhookQueueLease)
+		if err != nil {
+			w.logger.Error("error retrieving due webhooks", "err", err)
+			return
+		}
+
+		if queued == nil {
+			return
+		}
+
+		w.processWebhook(ctx, queued)
+	}
+}
+
+func (w *WebhookWorker) processWebhook(ctx context.Context, queued *model.QueuedWebhook) {
+	l := w.logger.With("webhook.id", queued.ID, "webhook.kind", queued.Kind, "webhook.version", queued.APIVersion, "webhook.instanceID", queued.InstanceID)
+
+	earlier, err := w.queueRepository.HasEarlierQueuedWebhook(ctx, *queued)
+	if err != nil {
+		l.Error("error checking for earlier webhooks", "err", err)
+		return
+	}
+
+	if earlier {
+		l.Debug("postponing webhook until earlier webhooks for the same instance are processed")
+		queued.NextAttempt = time.Now().Add(webhookOrderingDelay)
+		if err := w.queueRepository.UpdateQueuedWebhook(ctx, *queued); err != nil {
+			l.Error("error updating queued webhook", "err", err)
+		}
+		return
+	}
+
+	queued.Attempts++
+
+	result, err := w.apply(ctx, queued)
+	if err == nil || errors.Is(err, ErrWebhookAlreadyProcessed) {
+		if err != nil {
+			l.Info("ignoring redelivery of already processed webhook")
+			metrics.WebhooksProcessed.WithLabelValues(queued.Kind, "duplicate").Inc()
+		} else {
+			l.Info("processed webhook", "webhook.attempts", queued.Attempts, "webhook.duration", result.Duration)
+			metrics.WebhooksProcessed.WithLabelValues(queued.Kind, metrics.ResultSuccess).Inc()
+		}
+
+		if err := w.queueRepository.RemoveQueuedWebhookByID(ctx, queued.ID); err != nil {
+			l.Error("error removing processed webhook from queue", "err", err)
+		}
+
+		return
+	}
+
+	queued.LastError = err.Error()
+
+	if queued.Attempts >= w.options.MaxAttempts {
+		l.Error("giving up processing webhook; moving to dead letters", "err", err, "webhook.attempts", queued.Attempts)
+		metrics.WebhooksProcessed.WithLabelValues(queued.Kind, "dead_lettered").Inc()
+		queued.DeadLettered = time.Now()
+
+		if err := w.queueRepository.MoveWebhookToDeadLetters(ctx, *queued); err != nil {
+			l.Error("error moving webhook to dead letters", "err", err)
+		}
+
+		return
+	}
+
+	delay := w.backoff(queued.Attempts)
+	l.Warn("error processing webhook; retrying", "err", err, "webhook.attempts", queued.Attempts, "webhook.retryIn", delay)
+	metrics.WebhooksProcessed.WithLabelValues(queued.Kind, "retried").Inc()
+	queued.NextAttempt = time.Now().Add(delay)
+
+	if err := w.queueRepository.UpdateQueuedWebhook(ctx, *queued); err != nil {
+		l.Error("error updating queued webhook", "err", err)
+	}
+}
+
+func (w *WebhookWorker) apply(ctx context.Context, queued *model.QueuedWebhook) (*model.WebhookDelivery, error) {
+	wh, _, err := webhooks.UnmarshalWebhookRequest(queued.Payload)
+	if err != nil {
+		return nil, fmt.Errorf("could not decode webhook request: %w", err)
+	}
+
+	return w.webhookService.ProcessWebhook(ctx, queued.Delivery(), wh)
+}
+
+func (w *WebhookWorker) backoff(attempts int) time.Duration {
+	delay := w.options.BaseDelay
+	for i := 1; i < attempts && delay < w.options.MaxDelay; i++ {
+		delay *= 2
+	}
+
+	if delay > w.options.MaxDelay {
+		delay = w.options.MaxDelay
+	}
+
+	return delay
+}
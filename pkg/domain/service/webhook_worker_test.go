@@ -0,0 +1,199 @@
+package service_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/mittwald/mstudio-ext-proxy/pkg/domain/model"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/domain/repository"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/domain/service"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/persistence"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/webhooks/webhookscommon"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/webhooks/webhooksv1"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// flakyWebhookService fails the first n attempts to process a webhook, and
+// records the time of each attempt.
+type flakyWebhookService struct {
+	lock     sync.Mutex
+	failures int
+	attempts []time.Time
+}
+
+func (s *flakyWebhookService) ProcessWebhook(_ context.Context, delivery model.WebhookDelivery, _ any) (*model.WebhookDelivery, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.attempts = append(s.attempts, time.Now())
+	if s.failures > 0 {
+		s.failures--
+		return nil, errors.New("temporary failure")
+	}
+
+	return &delivery, nil
+}
+
+func (s *flakyWebhookService) Attempts() []time.Time {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return append([]time.Time{}, s.attempts...)
+}
+
+func (s *flakyWebhookService) SetFailures(n int) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.failures = n
+}
+
+var _ = Describe("WebhookWorker", func() {
+	const baseDelay = 50 * time.Millisecond
+	const maxDelay = 100 * time.Millisecond
+
+	var queue repository.WebhookQueueRepository
+	var webhookService *flakyWebhookService
+	var worker *service.WebhookWorker
+
+	enqueue := func(ctx context.Context, id string, enqueued time.Time) {
+		payload, err := json.Marshal(&webhooksv1.ExtensionInstanceUpdated{
+			Envelope: webhookscommon.Envelope{APIVersion: "v1", Kind: "ExtensionInstanceUpdated"},
+			ID:       "instance",
+			Meta:     webhooksv1.Meta{ExtensionID: "extension"},
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(queue.EnqueueWebhook(ctx, model.QueuedWebhook{
+			ID:          id,
+			Kind:        "ExtensionInstanceUpdated",
+			APIVersion:  "v1",
+			InstanceID:  "instance",
+			Payload:     payload,
+			Enqueued:    enqueued,
+			NextAttempt: enqueued,
+		})).To(Succeed())
+	}
+
+	deadLetterIDs := func(ctx context.Context) []string {
+		deadLetters, err := queue.FindDeadLetters(ctx)
+		Expect(err).NotTo(HaveOccurred())
+
+		ids := make([]string, 0, len(deadLetters))
+		for _, wh := range deadLetters {
+			ids = append(ids, wh.ID)
+		}
+		return ids
+	}
+
+	BeforeEach(func() {
+		queue = persistence.NewMemoryWebhookQueueRepository()
+		webhookService = &flakyWebhookService{}
+		worker = service.NewWebhookWorker(queue, webhookService, service.WebhookWorkerOptions{
+			Concurrency:  1,
+			PollInterval: 5 * time.Millisecond,
+			BaseDelay:    baseDelay,
+			MaxDelay:     maxDelay,
+			MaxAttempts:  4,
+		}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	})
+
+	// run starts the worker; it is stopped by calling the returned function, or
+	// at the end of the test.
+	run := func(ctx context.Context) func() {
+		workerCtx, cancel := context.WithCancel(ctx)
+		done := make(chan struct{})
+
+		go func() {
+			defer close(done)
+			worker.Run(workerCtx)
+		}()
+
+		stop := func() {
+			cancel()
+			<-done
+		}
+
+		DeferCleanup(stop)
+		return stop
+	}
+
+	It("should process queued webhooks", func(ctx context.Context) {
+		enqueue(ctx, "webhook", time.Now())
+		run(ctx)
+
+		Eventually(webhookService.Attempts).Should(HaveLen(1))
+		Eventually(func() (*model.QueuedWebhook, error) {
+			return queue.ClaimDueWebhook(ctx, time.Now().Add(time.Hour), time.Minute)
+		}).Should(BeNil())
+		Expect(deadLetterIDs(ctx)).To(BeEmpty())
+	})
+
+	It("should retry failed webhooks with exponential backoff", func(ctx context.Context) {
+		webhookService.SetFailures(3)
+		enqueue(ctx, "webhook", time.Now())
+		run(ctx)
+
+		Eventually(webhookService.Attempts, "2s").Should(HaveLen(4))
+		Consistently(webhookService.Attempts, "200ms").Should(HaveLen(4))
+
+		attempts := webhookService.Attempts()
+		Expect(attempts[1].Sub(attempts[0])).To(BeNumerically(">=", baseDelay))
+		Expect(attempts[2].Sub(attempts[1])).To(BeNumerically(">=", 2*baseDelay))
+		Expect(attempts[3].Sub(attempts[2])).To(SatisfyAll(
+			BeNumerically(">=", maxDelay),
+			BeNumerically("<", 2*maxDelay),
+		))
+		Expect(deadLetterIDs(ctx)).To(BeEmpty())
+	})
+
+	It("should move webhooks to the dead letters after the maximum number of attempts", func(ctx context.Context) {
+		webhookService.SetFailures(10)
+		enqueue(ctx, "webhook", time.Now())
+		run(ctx)
+
+		Eventually(deadLetterIDs, "2s").WithArguments(ctx).Should(Equal([]string{"webhook"}))
+		Consistently(webhookService.Attempts, "200ms").Should(HaveLen(4))
+
+		deadLetter, err := queue.FindDeadLetterByID(ctx, "webhook")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(deadLetter.Attempts).To(Equal(4))
+		Expect(deadLetter.LastError).To(Equal("temporary failure"))
+		Expect(deadLetter.DeadLettered).NotTo(BeZero())
+	})
+
+	It("should process replayed dead letters", func(ctx context.Context) {
+		webhookService.SetFailures(4)
+		enqueue(ctx, "webhook", time.Now().Add(-time.Hour))
+		stop := run(ctx)
+
+		Eventually(deadLetterIDs, "2s").WithArguments(ctx).Should(Equal([]string{"webhook"}))
+		stop()
+
+		replayed := time.Now()
+		Expect(queue.ReplayDeadLetter(ctx, "webhook")).To(Succeed())
+		Expect(deadLetterIDs(ctx)).To(BeEmpty())
+
+		By("enqueueing the webhook anew, with its attempts reset")
+		queued, err := queue.ClaimDueWebhook(ctx, time.Now(), 0)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(queued).NotTo(BeNil())
+		Expect(queued.ID).To(Equal("webhook"))
+		Expect(queued.Attempts).To(BeZero())
+		Expect(queued.LastError).To(BeEmpty())
+		Expect(queued.Enqueued).To(BeTemporally(">=", replayed))
+
+		run(ctx)
+
+		Eventually(webhookService.Attempts).Should(HaveLen(5))
+		Eventually(func() (*model.QueuedWebhook, error) {
+			return queue.ClaimDueWebhook(ctx, time.Now().Add(time.Hour), time.Minute)
+		}).Should(BeNil())
+	})
+})
@@ -0,0 +1,30 @@
+// Package events contains the lifecycle events that the proxy forwards to
+// upstream applications, and the functions to sign and verify them. Upstream
+// applications written in Go may import this package to verify incoming
+// events.
+package events
+
+import (
+	"time"
+
+	"github.com/mittwald/mstudio-ext-proxy/pkg/domain/model"
+)
+
+type Kind string
+
+const (
+	KindInstanceAdded         Kind = "instance.added"
+	KindInstanceUpdated       Kind = "instance.updated"
+	KindInstanceSecretRotated Kind = "instance.secret_rotated"
+	KindInstanceRemoved       Kind = "instance.removed"
+)
+
+// Event is a normalized lifecycle event, independent of the mStudio webhook
+// API version. The instance has the same structure as the "inst" claim of the
+// JWT passed to upstream applications.
+type Event struct {
+	ID         string                  `json:"id"`
+	Kind       Kind                    `json:"kind"`
+	OccurredAt time.Time               `json:"occurredAt"`
+	Instance   model.ExtensionInstance `json:"instance"`
+}
@@ -0,0 +1,75 @@
+package events
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	HeaderSignature = "X-Mstudio-Proxy-Signature"
+	HeaderEventID   = "X-Mstudio-Proxy-Event-Id"
+	HeaderEventKind = "X-Mstudio-Proxy-Event-Kind"
+)
+
+// Sign computes the value of the signature header for an event body. The
+// signature is an HMAC-SHA256 over the timestamp and the body, and is encoded
+// as "t=<unix timestamp>,v1=<hex signature>".
+func Sign(secret []byte, timestamp time.Time, body []byte) string {
+	ts := strconv.FormatInt(timestamp.Unix(), 10)
+	return fmt.Sprintf("t=%s,v1=%s", ts, hex.EncodeToString(computeSignature(secret, ts, body)))
+}
+
+// VerifySignature verifies the signature header of an event. Signatures with a
+// timestamp that differs from the current time by more than the given
+// tolerance are rejected, to prevent replay attacks.
+func VerifySignature(secret []byte, header string, body []byte, tolerance time.Duration) error {
+	var ts string
+	var signatures [][]byte
+
+	for _, part := range strings.Split(header, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			continue
+		}
+
+		switch key {
+		case "t":
+			ts = value
+		case "v1":
+			if sig, err := hex.DecodeString(value); err == nil {
+				signatures = append(signatures, sig)
+			}
+		}
+	}
+
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return fmt.Errorf("missing or invalid signature timestamp")
+	}
+
+	if age := time.Since(time.Unix(unix, 0)); age > tolerance || age < -tolerance {
+		return fmt.Errorf("signature timestamp outside of tolerance")
+	}
+
+	expected := computeSignature(secret, ts, body)
+	for _, sig := range signatures {
+		if hmac.Equal(sig, expected) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("invalid signature")
+}
+
+func computeSignature(secret []byte, ts string, body []byte) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(ts))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return mac.Sum(nil)
+}
@@ -0,0 +1,34 @@
+package events_test
+
+import (
+	"time"
+
+	"github.com/mittwald/mstudio-ext-proxy/pkg/events"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Signature", func() {
+	secret := []byte("secret")
+	body := []byte(`{"id":"foo","kind":"instance.added"}`)
+
+	It("should verify a valid signature", func() {
+		header := events.Sign(secret, time.Now(), body)
+		Expect(events.VerifySignature(secret, header, body, 5*time.Minute)).To(Succeed())
+	})
+
+	It("should reject a modified body", func() {
+		header := events.Sign(secret, time.Now(), body)
+		Expect(events.VerifySignature(secret, header, []byte(`{}`), 5*time.Minute)).NotTo(Succeed())
+	})
+
+	It("should reject a different secret", func() {
+		header := events.Sign([]byte("other"), time.Now(), body)
+		Expect(events.VerifySignature(secret, header, body, 5*time.Minute)).NotTo(Succeed())
+	})
+
+	It("should reject stale signatures", func() {
+		header := events.Sign(secret, time.Now().Add(-10*time.Minute), body)
+		Expect(events.VerifySignature(secret, header, body, 5*time.Minute)).To(MatchError(ContainSubstring("tolerance")))
+	})
+})
@@ -0,0 +1,146 @@
+// Package health implements the dependency checks that are reported by the
+// readiness endpoint.
+package health
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+type Status string
+
+const (
+	StatusOK Status = "ok"
+
+	// StatusDegraded means that only non-critical checks are failing; the
+	// service is still considered ready.
+	StatusDegraded Status = "degraded"
+
+	StatusFailing Status = "failing"
+)
+
+const DefaultTimeout = 5 * time.Second
+
+// Check is a single dependency check.
+type Check struct {
+	Name string
+
+	// Critical checks make the service unready when they fail; failing
+	// non-critical checks are only reported.
+	Critical bool
+
+	Func func(ctx context.Context) error
+}
+
+type CheckResult struct {
+	Name       string `json:"name"`
+	Status     Status `json:"status"`
+	Critical   bool   `json:"critical"`
+	DurationMS int64  `json:"durationMs"`
+	Error      string `json:"error,omitempty"`
+}
+
+type Report struct {
+	Status Status        `json:"status"`
+	Checks []CheckResult `json:"checks,omitempty"`
+}
+
+// Ready reports whether no critical check failed.
+func (r *Report) Ready() bool {
+	return r.Status != StatusFailing
+}
+
+// Checker runs a set of checks concurrently.
+type Checker struct {
+	Checks []Check
+
+	// Timeout limits the duration of each check; if zero, DefaultTimeout is
+	// used.
+	Timeout time.Duration
+}
+
+func (c *Checker) Add(checks ...Check) {
+	c.Checks = append(c.Checks, checks...)
+}
+
+func (c *Checker) Run(ctx context.Context) Report {
+	timeout := c.Timeout
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+
+	report := Report{
+		Status: StatusOK,
+		Checks: make([]CheckResult, len(c.Checks)),
+	}
+
+	wg := sync.WaitGroup{}
+
+	for i, check := range c.Checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			report.Checks[i] = runCheck(ctx, check, timeout)
+		}()
+	}
+
+	wg.Wait()
+
+	for _, result := range report.Checks {
+		if result.Status == StatusOK {
+			continue
+		}
+
+		if result.Critical {
+			report.Status = StatusFailing
+		} else if report.Status == StatusOK {
+			report.Status = StatusDegraded
+		}
+	}
+
+	return report
+}
+
+func runCheck(ctx context.Context, check Check, timeout time.Duration) CheckResult {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	errs := make(chan error, 1)
+
+	// The check is run in a separate goroutine, so that checks that do not
+	// respect the context's deadline do not block the report.
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				errs <- fmt.Errorf("check panicked: %v", r)
+			}
+		}()
+
+		errs <- check.Func(ctx)
+	}()
+
+	var err error
+
+	select {
+	case err = <-errs:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	result := CheckResult{
+		Name:       check.Name,
+		Status:     StatusOK,
+		Critical:   check.Critical,
+		DurationMS: time.Since(start).Milliseconds(),
+	}
+
+	if err != nil {
+		result.Status = StatusFailing
+		result.Error = err.Error()
+	}
+
+	return result
+}
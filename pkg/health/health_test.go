@@ -0,0 +1,82 @@
+package health_test
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/mittwald/mstudio-ext-proxy/pkg/health"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Checker", func() {
+	succeeding := func(context.Context) error { return nil }
+	failing := func(context.Context) error { return errors.New("broken") }
+
+	It("should report ok if all checks succeed", func(ctx context.Context) {
+		checker := health.Checker{}
+		checker.Add(
+			health.Check{Name: "a", Critical: true, Func: succeeding},
+			health.Check{Name: "b", Func: succeeding},
+		)
+
+		report := checker.Run(ctx)
+		Expect(report.Status).To(Equal(health.StatusOK))
+		Expect(report.Ready()).To(BeTrue())
+		Expect(report.Checks).To(HaveLen(2))
+		Expect(report.Checks[0].Name).To(Equal("a"))
+	})
+
+	It("should report degraded if a non-critical check fails", func(ctx context.Context) {
+		checker := health.Checker{}
+		checker.Add(
+			health.Check{Name: "a", Critical: true, Func: succeeding},
+			health.Check{Name: "b", Func: failing},
+		)
+
+		report := checker.Run(ctx)
+		Expect(report.Status).To(Equal(health.StatusDegraded))
+		Expect(report.Ready()).To(BeTrue())
+		Expect(report.Checks[1].Status).To(Equal(health.StatusFailing))
+		Expect(report.Checks[1].Error).To(Equal("broken"))
+	})
+
+	It("should report failing if a critical check fails", func(ctx context.Context) {
+		checker := health.Checker{}
+		checker.Add(
+			health.Check{Name: "a", Critical: true, Func: failing},
+			health.Check{Name: "b", Func: failing},
+		)
+
+		report := checker.Run(ctx)
+		Expect(report.Status).To(Equal(health.StatusFailing))
+		Expect(report.Ready()).To(BeFalse())
+	})
+
+	It("should not wait for checks that exceed the timeout", func(ctx context.Context) {
+		checker := health.Checker{Timeout: 50 * time.Millisecond}
+		checker.Add(health.Check{Name: "slow", Critical: true, Func: func(context.Context) error {
+			time.Sleep(time.Second)
+			return nil
+		}})
+
+		start := time.Now()
+		report := checker.Run(ctx)
+
+		Expect(time.Since(start)).To(BeNumerically("<", 500*time.Millisecond))
+		Expect(report.Status).To(Equal(health.StatusFailing))
+		Expect(report.Checks[0].Error).To(ContainSubstring("deadline exceeded"))
+	})
+
+	It("should report panicking checks as failing", func(ctx context.Context) {
+		checker := health.Checker{}
+		checker.Add(health.Check{Name: "panic", Critical: true, Func: func(context.Context) error {
+			panic("oops")
+		}})
+
+		report := checker.Run(ctx)
+		Expect(report.Status).To(Equal(health.StatusFailing))
+		Expect(report.Checks[0].Error).To(ContainSubstring("oops"))
+	})
+})
@@ -25,6 +25,10 @@ func (w *wrappedWithStatus) Error() string {
 	return fmt.Sprintf("%s: %s", w.message, w.inner.Error())
 }
 
+func (w *wrappedWithStatus) Unwrap() error {
+	return w.inner
+}
+
 func (w *wrappedWithStatus) StatusCode() int {
 	return w.statusCode
 }
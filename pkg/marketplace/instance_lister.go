@@ -0,0 +1,58 @@
+package marketplace
+
+import (
+	"context"
+	"fmt"
+
+	mittwaldv2 "github.com/mittwald/api-client-go/mittwaldv2/generated/clients"
+	"github.com/mittwald/api-client-go/mittwaldv2/generated/clients/marketplaceclientv2"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/domain/model"
+)
+
+const listPageSize = 500
+
+// InstanceLister lists the instances of an extension using the marketplace
+// API. The client needs to be authenticated with an API token of the
+// contributor that owns the extension.
+type InstanceLister struct {
+	Client mittwaldv2.Client
+}
+
+// ListExtensionInstances returns all instances of an extension. Note that the
+// API does not expose the instance secrets, so the returned instances do not
+// contain a secret.
+func (l *InstanceLister) ListExtensionInstances(ctx context.Context, extensionID string) ([]model.ExtensionInstance, error) {
+	out := make([]model.ExtensionInstance, 0)
+	limit := int64(listPageSize)
+
+	for skip := int64(0); ; skip += limit {
+		req := marketplaceclientv2.ListExtensionInstancesRequest{
+			ExtensionID: &extensionID,
+			Limit:       &limit,
+			Skip:        &skip,
+		}
+
+		resp, _, err := l.Client.Marketplace().ListExtensionInstances(ctx, req)
+		if err != nil {
+			return nil, fmt.Errorf("error listing extension instances: %w", err)
+		}
+
+		page := *resp
+		for _, inst := range page {
+			out = append(out, model.ExtensionInstance{
+				ID:          inst.Id,
+				ExtensionID: inst.ExtensionId,
+				Enabled:     !inst.Disabled,
+				Context: model.ExtensionInstanceContext{
+					ID:   inst.AggregateReference.Id,
+					Kind: inst.AggregateReference.Aggregate,
+				},
+				Scopes: inst.ConsentedScopes,
+			})
+		}
+
+		if int64(len(page)) < limit {
+			return out, nil
+		}
+	}
+}
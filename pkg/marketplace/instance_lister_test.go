@@ -0,0 +1,181 @@
+package marketplace_test
+
+import (
+	"context"
+	"io"
+	"log/slog"
+
+	"github.com/mittwald/api-client-go/mittwaldv2"
+
+	"github.com/mittwald/mstudio-ext-proxy/pkg/domain/model"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/domain/repository"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/domain/service"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/marketplace"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/mstudiotest"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/persistence"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// concurrentLister calls a function after listing the instances, to simulate
+// webhooks that are processed while the reconciler is running.
+type concurrentLister struct {
+	service.InstanceLister
+	afterList func(ctx context.Context)
+}
+
+func (l *concurrentLister) ListExtensionInstances(ctx context.Context, extensionID string) ([]model.ExtensionInstance, error) {
+	remote, err := l.InstanceLister.ListExtensionInstances(ctx, extensionID)
+	l.afterList(ctx)
+	return remote, err
+}
+
+var _ = Describe("InstanceReconciler", func() {
+	const extensionID = "ext-1"
+
+	var api *mstudiotest.Server
+	var instances repository.ExtensionInstanceRepository
+	var reconciler *service.InstanceReconciler
+
+	buildLister := func(token string) service.InstanceLister {
+		client, err := mittwaldv2.New(context.Background(), append(api.ClientOptions(), mittwaldv2.WithAccessToken(token))...)
+		Expect(err).NotTo(HaveOccurred())
+
+		return &marketplace.InstanceLister{Client: client}
+	}
+
+	buildReconcilerWithLister := func(lister service.InstanceLister) *service.InstanceReconciler {
+		return service.NewInstanceReconciler(lister, instances, []string{extensionID}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	}
+
+	buildReconciler := func(token string) *service.InstanceReconciler {
+		return buildReconcilerWithLister(buildLister(token))
+	}
+
+	BeforeEach(func() {
+		api = mstudiotest.NewServer()
+		api.SetExtensionInstances(
+			mstudiotest.ExtensionInstance{ID: "inst-added", ExtensionID: extensionID, ContextKind: "project", ContextID: "p-1", Scopes: []string{"project:read"}},
+			mstudiotest.ExtensionInstance{ID: "inst-updated", ExtensionID: extensionID, ContextKind: "customer", ContextID: "c-1", Disabled: true},
+			mstudiotest.ExtensionInstance{ID: "inst-unchanged", ExtensionID: extensionID, ContextKind: "project", ContextID: "p-2"},
+			mstudiotest.ExtensionInstance{ID: "inst-other", ExtensionID: "ext-2", ContextKind: "project", ContextID: "p-3"},
+		)
+
+		instances = persistence.NewMemoryExtensionInstanceRepository(
+			model.ExtensionInstance{ID: "inst-updated", ExtensionID: extensionID, Enabled: true, Context: model.ExtensionInstanceContext{ID: "c-1", Kind: "customer"}, Secret: []byte("secret")},
+			model.ExtensionInstance{ID: "inst-unchanged", ExtensionID: extensionID, Enabled: true, Context: model.ExtensionInstanceContext{ID: "p-2", Kind: "project"}},
+			model.ExtensionInstance{ID: "inst-removed", ExtensionID: extensionID, Enabled: true},
+			model.ExtensionInstance{ID: "inst-foreign", ExtensionID: "ext-2", Enabled: true},
+		)
+
+		token, _ := api.IssueTokens("contributor")
+		reconciler = buildReconciler(token)
+	})
+
+	AfterEach(func() {
+		api.Close()
+	})
+
+	It("should report differences without changes in a dry run", func() {
+		report, err := reconciler.Reconcile(context.Background(), true)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report.Added).To(ConsistOf("inst-added"))
+		Expect(report.Updated).To(ConsistOf("inst-updated"))
+		Expect(report.Removed).To(ConsistOf("inst-removed"))
+
+		_, err = instances.FindExtensionInstanceByID(context.Background(), "inst-removed")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("should make the local instances match the remote ones", func() {
+		_, err := reconciler.Reconcile(context.Background(), false)
+		Expect(err).NotTo(HaveOccurred())
+
+		added, err := instances.FindExtensionInstanceByID(context.Background(), "inst-added")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(added.Context).To(Equal(model.ExtensionInstanceContext{ID: "p-1", Kind: "project"}))
+		Expect(added.Scopes).To(ConsistOf("project:read"))
+
+		updated, err := instances.FindExtensionInstanceByID(context.Background(), "inst-updated")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(updated.Enabled).To(BeFalse())
+		Expect(updated.Secret).To(Equal([]byte("secret")))
+
+		_, err = instances.FindExtensionInstanceByID(context.Background(), "inst-removed")
+		Expect(err).To(HaveOccurred())
+
+		_, err = instances.FindExtensionInstanceByID(context.Background(), "inst-foreign")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("should not overwrite secrets that were set concurrently", func() {
+		// a webhook delivers the secret of the missing instance while the
+		// reconciler is running
+		Expect(instances.AddExtensionInstance(context.Background(), model.ExtensionInstance{ID: "inst-added", ExtensionID: extensionID, Secret: []byte("new-secret")})).To(Succeed())
+		Expect(instances.UpdateExtensionInstance(context.Background(), model.ExtensionInstance{ID: "inst-updated", ExtensionID: extensionID, Secret: []byte("rotated-secret")})).To(Succeed())
+
+		_, err := reconciler.Reconcile(context.Background(), false)
+		Expect(err).NotTo(HaveOccurred())
+
+		added, err := instances.FindExtensionInstanceByID(context.Background(), "inst-added")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(added.Secret).To(Equal([]byte("new-secret")))
+
+		updated, err := instances.FindExtensionInstanceByID(context.Background(), "inst-updated")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(updated.Secret).To(Equal([]byte("rotated-secret")))
+		Expect(updated.Enabled).To(BeFalse())
+	})
+
+	It("should not change instances that were installed or removed after listing", func(ctx context.Context) {
+		token, _ := api.IssueTokens("contributor")
+		reconciler = buildReconcilerWithLister(&concurrentLister{
+			InstanceLister: buildLister(token),
+			afterList: func(ctx context.Context) {
+				Expect(instances.AddExtensionInstance(ctx, model.ExtensionInstance{ID: "inst-installed", ExtensionID: extensionID, Enabled: true, Secret: []byte("installed-secret")})).To(Succeed())
+				Expect(instances.RemoveExtensionInstanceByID(ctx, "inst-updated")).To(Succeed())
+			},
+		})
+
+		report, err := reconciler.Reconcile(ctx, false)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report.Added).To(ConsistOf("inst-added"))
+		Expect(report.Removed).To(ConsistOf("inst-removed"))
+
+		installed, err := instances.FindExtensionInstanceByID(ctx, "inst-installed")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(installed.Secret).To(Equal([]byte("installed-secret")))
+
+		_, err = instances.FindExtensionInstanceByID(ctx, "inst-updated")
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should reconcile only once if no interval is configured", func(ctx context.Context) {
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			reconciler.Run(ctx, 0)
+		}()
+
+		Eventually(done).Should(BeClosed())
+		Expect(api.RequestCount(mstudiotest.EndpointListExtensionInstances)).To(Equal(1))
+	})
+
+	It("should not remove any instances if the API returns none", func() {
+		api.SetExtensionInstances()
+
+		report, err := reconciler.Reconcile(context.Background(), false)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report.Removed).To(BeEmpty())
+	})
+
+	It("should fail on API errors", func() {
+		reconciler = buildReconciler("wrong")
+
+		_, err := reconciler.Reconcile(context.Background(), false)
+		Expect(err).To(HaveOccurred())
+
+		_, err = instances.FindExtensionInstanceByID(context.Background(), "inst-removed")
+		Expect(err).NotTo(HaveOccurred())
+	})
+})
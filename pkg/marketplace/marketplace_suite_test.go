@@ -0,0 +1,13 @@
+package marketplace_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestMarketplace(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Marketplace Suite")
+}
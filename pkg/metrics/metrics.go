@@ -0,0 +1,96 @@
+// Package metrics defines the Prometheus metrics of the proxy. The metrics
+// are registered with the default registry.
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/mittwald/mstudio-ext-proxy/pkg/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const namespace = "mstudio_ext_proxy"
+
+const (
+	ResultSuccess = "success"
+	ResultFailure = "failure"
+)
+
+var (
+	UpstreamRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "upstream_requests_total",
+		Help:      "Number of requests to the upstreams, by upstream and response status.",
+	}, []string{"upstream", "code"})
+
+	UpstreamRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "upstream_request_duration_seconds",
+		Help:      "Duration of requests to the upstreams (including authentication), by upstream and response status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"upstream", "code"})
+
+	SessionLookupDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "session_lookup_duration_seconds",
+		Help:      "Duration of session lookups, including the verification of the bcrypt-hashed session secret.",
+		Buckets:   prometheus.ExponentialBuckets(0.005, 2, 10),
+	}, []string{"result"})
+
+	SessionRefreshes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "session_refreshes_total",
+		Help:      "Number of refreshes of expired mStudio sessions, by result.",
+	}, []string{"result"})
+
+	Logins = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "logins_total",
+		Help:      "Number of logins, by login method and outcome.",
+	}, []string{"method", "outcome"})
+
+	WebhooksReceived = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "webhooks_received_total",
+		Help:      "Number of received webhook requests, by webhook kind and outcome.",
+	}, []string{"kind", "outcome"})
+
+	WebhooksProcessed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "webhooks_processed_total",
+		Help:      "Number of webhook processing attempts, by webhook kind and outcome.",
+	}, []string{"kind", "outcome"})
+
+	WebhookKeyCacheLookups = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "webhook_key_cache_lookups_total",
+		Help:      "Number of lookups in the webhook public key cache, by result (hit or miss).",
+	}, []string{"result"})
+)
+
+// Result returns the result label value for an operation that returned err.
+func Result(err error) string {
+	if err != nil {
+		return ResultFailure
+	}
+
+	return ResultSuccess
+}
+
+// InstrumentUpstream records the requests to the given upstream in
+// UpstreamRequests and UpstreamRequestDuration.
+func InstrumentUpstream(upstream string, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := middleware.NewResponseRecorder(w)
+
+		h.ServeHTTP(rec, r)
+
+		code := strconv.Itoa(rec.Status())
+		UpstreamRequests.WithLabelValues(upstream, code).Inc()
+		UpstreamRequestDuration.WithLabelValues(upstream, code).Observe(time.Since(start).Seconds())
+	})
+}
@@ -0,0 +1,81 @@
+package metrics_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"github.com/mittwald/mstudio-ext-proxy/pkg/metrics"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+type staticSessionCounter struct {
+	counts map[string]int
+	err    error
+}
+
+func (s *staticSessionCounter) CountActiveSessionsByInstance(context.Context) (map[string]int, error) {
+	return s.counts, s.err
+}
+
+var _ = Describe("InstrumentUpstream", func() {
+	It("should count requests by upstream and status", func() {
+		before := testutil.ToFloat64(metrics.UpstreamRequests.WithLabelValues("/count/", "418"))
+
+		h := metrics.InstrumentUpstream("/count/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusTeapot)
+		}))
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/count/", nil))
+
+		Expect(testutil.ToFloat64(metrics.UpstreamRequests.WithLabelValues("/count/", "418"))).To(Equal(before + 1))
+	})
+
+	It("should support flushing and response controllers", func() {
+		var deadlineErr, flushErr error
+
+		h := metrics.InstrumentUpstream("/stream/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte("data"))
+
+			rc := http.NewResponseController(w)
+			deadlineErr = rc.SetWriteDeadline(time.Now().Add(time.Minute))
+			flushErr = rc.Flush()
+		}))
+
+		server := httptest.NewServer(h)
+		defer server.Close()
+
+		res, err := http.Get(server.URL + "/stream/")
+		Expect(err).NotTo(HaveOccurred())
+		defer res.Body.Close()
+
+		Expect(res.StatusCode).To(Equal(http.StatusOK))
+		Expect(deadlineErr).NotTo(HaveOccurred())
+		Expect(flushErr).NotTo(HaveOccurred())
+	})
+})
+
+var _ = Describe("ActiveSessionsCollector", func() {
+	It("should report the active sessions per instance", func() {
+		collector := metrics.NewActiveSessionsCollector(&staticSessionCounter{counts: map[string]int{"a": 2, "b": 1}})
+
+		expected := `
+# HELP mstudio_ext_proxy_active_sessions Number of active (not expired) sessions, by extension instance.
+# TYPE mstudio_ext_proxy_active_sessions gauge
+mstudio_ext_proxy_active_sessions{instance="a"} 2
+mstudio_ext_proxy_active_sessions{instance="b"} 1
+`
+		Expect(testutil.CollectAndCompare(collector, strings.NewReader(expected))).To(Succeed())
+	})
+
+	It("should report errors", func() {
+		collector := metrics.NewActiveSessionsCollector(&staticSessionCounter{err: errors.New("database down")})
+
+		_, err := testutil.CollectAndLint(collector)
+		Expect(err).To(MatchError(ContainSubstring("database down")))
+	})
+})
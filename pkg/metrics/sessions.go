@@ -0,0 +1,49 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// SessionCounter counts the active sessions per extension instance.
+type SessionCounter interface {
+	CountActiveSessionsByInstance(ctx context.Context) (map[string]int, error)
+}
+
+var activeSessionsDesc = prometheus.NewDesc(
+	prometheus.BuildFQName(namespace, "", "active_sessions"),
+	"Number of active (not expired) sessions, by extension instance.",
+	[]string{"instance"}, nil,
+)
+
+// activeSessionsCollector queries the active sessions on each scrape, so that
+// the numbers are accurate across multiple replicas.
+type activeSessionsCollector struct {
+	counter SessionCounter
+	timeout time.Duration
+}
+
+func NewActiveSessionsCollector(c SessionCounter) prometheus.Collector {
+	return &activeSessionsCollector{counter: c, timeout: 5 * time.Second}
+}
+
+func (c *activeSessionsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- activeSessionsDesc
+}
+
+func (c *activeSessionsCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	counts, err := c.counter.CountActiveSessionsByInstance(ctx)
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(activeSessionsDesc, err)
+		return
+	}
+
+	for instanceID, count := range counts {
+		ch <- prometheus.MustNewConstMetric(activeSessionsDesc, prometheus.GaugeValue, float64(count), instanceID)
+	}
+}
@@ -0,0 +1,291 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AccessLogFormat is the output format of the access log.
+type AccessLogFormat string
+
+const (
+	AccessLogFormatJSON     AccessLogFormat = "json"
+	AccessLogFormatLogfmt   AccessLogFormat = "logfmt"
+	AccessLogFormatCombined AccessLogFormat = "combined"
+)
+
+// redacted replaces redacted path segments and header values.
+const redacted = "[REDACTED]"
+
+// sensitiveHeaders carry credentials; their values are always redacted, even
+// if they are listed in AccessLogOptions.Headers.
+var sensitiveHeaders = []string{
+	"Authorization",
+	"Proxy-Authorization",
+	"Cookie",
+	"Set-Cookie",
+	"X-Mstudio-User",
+}
+
+type AccessLogOptions struct {
+	Format AccessLogFormat
+	Output io.Writer
+
+	// Level is the level of the access log records; if it is below MinLevel,
+	// no access log is written.
+	Level    slog.Level
+	MinLevel slog.Leveler
+
+	// RedactPaths are applied to the request path; all matches are replaced
+	// by "[REDACTED]". Query strings are never logged.
+	RedactPaths []*regexp.Regexp
+
+	// Headers are the request headers that are included in the access log (in
+	// the JSON and logfmt formats). The values of RedactHeaders, and of
+	// headers carrying credentials, are replaced by "[REDACTED]".
+	Headers       []string
+	RedactHeaders []string
+}
+
+// AccessLogger writes an access log entry for each request.
+type AccessLogger struct {
+	options AccessLogOptions
+	logger  *slog.Logger
+	enabled bool
+
+	// writeLock serializes the entries in the Combined Log Format, so that
+	// concurrent requests do not interleave (the slog handlers already
+	// serialize their output).
+	writeLock sync.Mutex
+}
+
+func NewAccessLogger(opts AccessLogOptions) (*AccessLogger, error) {
+	if opts.MinLevel == nil {
+		opts.MinLevel = slog.LevelInfo
+	}
+
+	a := &AccessLogger{
+		options: opts,
+		enabled: opts.Level >= opts.MinLevel.Level(),
+	}
+
+	handlerOpts := slog.HandlerOptions{Level: opts.MinLevel}
+
+	switch opts.Format {
+	case AccessLogFormatJSON:
+		a.logger = slog.New(slog.NewJSONHandler(opts.Output, &handlerOpts))
+	case AccessLogFormatLogfmt:
+		a.logger = slog.New(slog.NewTextHandler(opts.Output, &handlerOpts))
+	case AccessLogFormatCombined:
+	default:
+		return nil, fmt.Errorf("unsupported access log format '%s'; expected 'json', 'logfmt' or 'combined'", opts.Format)
+	}
+
+	return a, nil
+}
+
+// AccessLogEntry collects the fields of an access log entry that are only known
+// to the inner handlers, like the authenticated user.
+type AccessLogEntry struct {
+	lock       sync.Mutex
+	upstream   string
+	userID     string
+	instanceID string
+}
+
+type accessLogEntryContextKey struct{}
+
+// AccessLogEntryFromContext returns the access log entry of the current
+// request. If the request is not logged, this returns nil; all methods of
+// AccessLogEntry can safely be called on nil.
+func AccessLogEntryFromContext(ctx context.Context) *AccessLogEntry {
+	e, _ := ctx.Value(accessLogEntryContextKey{}).(*AccessLogEntry)
+	return e
+}
+
+// SetUpstream sets the upstream (the configured path prefix) that a request
+// was proxied to.
+func (e *AccessLogEntry) SetUpstream(upstream string) {
+	if e == nil {
+		return
+	}
+
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	e.upstream = upstream
+}
+
+// SetUser sets the user and extension instance of an authenticated request.
+func (e *AccessLogEntry) SetUser(userID, instanceID string) {
+	if e == nil {
+		return
+	}
+
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	e.userID = userID
+	e.instanceID = instanceID
+}
+
+func (a *AccessLogger) Middleware(next http.Handler) http.Handler {
+	if !a.enabled {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		entry := &AccessLogEntry{}
+		rec := NewResponseRecorder(w)
+
+		next.ServeHTTP(rec, r.WithContext(context.WithValue(r.Context(), accessLogEntryContextKey{}, entry)))
+
+		entry.lock.Lock()
+		defer entry.lock.Unlock()
+
+		if a.options.Format == AccessLogFormatCombined {
+			a.writeCombined(r, rec, entry, start)
+			return
+		}
+
+		attrs := []slog.Attr{
+			slog.String("method", r.Method),
+			slog.String("path", a.redactPath(r.URL.Path)),
+			slog.String("upstream", entry.upstream),
+			slog.Int("status", rec.Status()),
+			slog.Int64("bytes", rec.BytesWritten()),
+			slog.Duration("duration", time.Since(start)),
+			slog.String("user_id", entry.userID),
+			slog.String("instance_id", entry.instanceID),
+			slog.String("request_id", RequestIDFromContext(r.Context())),
+			slog.String("remote_addr", remoteHost(r)),
+		}
+
+		if headers := a.headerAttrs(r.Header); len(headers) > 0 {
+			attrs = append(attrs, slog.Attr{Key: "headers", Value: slog.GroupValue(headers...)})
+		}
+
+		a.logger.LogAttrs(r.Context(), a.options.Level, "access", attrs...)
+	})
+}
+
+// writeCombined writes an entry in the Combined Log Format, as used by Apache
+// and nginx.
+func (a *AccessLogger) writeCombined(r *http.Request, rec *ResponseRecorder, entry *AccessLogEntry, start time.Time) {
+	user := escapeCombined(entry.userID)
+	if user == "" {
+		user = "-"
+	}
+
+	size := "-"
+	if rec.BytesWritten() > 0 {
+		size = strconv.FormatInt(rec.BytesWritten(), 10)
+	}
+
+	referer := "-"
+	if ref := r.Referer(); ref != "" {
+		// The referer might contain credentials in its query string, too.
+		referer, _, _ = strings.Cut(ref, "?")
+	}
+
+	line := fmt.Sprintf("%s - %s [%s] \"%s %s %s\" %d %s \"%s\" \"%s\"\n",
+		remoteHost(r),
+		user,
+		start.Format("02/Jan/2006:15:04:05 -0700"),
+		escapeCombined(r.Method),
+		escapeCombined(a.redactPath(r.URL.Path)),
+		escapeCombined(r.Proto),
+		rec.Status(),
+		size,
+		escapeCombined(referer),
+		escapeCombined(r.UserAgent()),
+	)
+
+	a.writeLock.Lock()
+	defer a.writeLock.Unlock()
+
+	_, _ = io.WriteString(a.options.Output, line)
+}
+
+func (a *AccessLogger) redactPath(path string) string {
+	for _, re := range a.options.RedactPaths {
+		path = re.ReplaceAllString(path, redacted)
+	}
+
+	return path
+}
+
+func (a *AccessLogger) headerAttrs(header http.Header) []slog.Attr {
+	attrs := make([]slog.Attr, 0, len(a.options.Headers))
+
+	for _, name := range a.options.Headers {
+		value := header.Get(name)
+		if value == "" {
+			continue
+		}
+
+		if a.isRedactedHeader(name) {
+			value = redacted
+		}
+
+		attrs = append(attrs, slog.String(http.CanonicalHeaderKey(name), value))
+	}
+
+	return attrs
+}
+
+func (a *AccessLogger) isRedactedHeader(name string) bool {
+	for _, h := range sensitiveHeaders {
+		if strings.EqualFold(h, name) {
+			return true
+		}
+	}
+
+	for _, h := range a.options.RedactHeaders {
+		if strings.EqualFold(h, name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func remoteHost(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
+
+// escapeCombined escapes quotes, backslashes and control characters (like nginx
+// does), so that request data cannot break out of its field or inject
+// additional lines into the access log.
+func escapeCombined(s string) string {
+	var b strings.Builder
+
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '"' || c == '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c < 0x20 || c == 0x7f:
+			fmt.Fprintf(&b, `\x%02X`, c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+
+	return b.String()
+}
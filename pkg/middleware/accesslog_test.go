@@ -0,0 +1,192 @@
+package middleware_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/mittwald/mstudio-ext-proxy/pkg/middleware"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("AccessLogger", func() {
+	var out *bytes.Buffer
+	var opts middleware.AccessLogOptions
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		entry := middleware.AccessLogEntryFromContext(r.Context())
+		entry.SetUpstream("/app/")
+		entry.SetUser("user", "instance")
+
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte("hello"))
+	})
+
+	serve := func(req *http.Request) {
+		logger, err := middleware.NewAccessLogger(opts)
+		Expect(err).NotTo(HaveOccurred())
+
+		middleware.RequestID(logger.Middleware(next)).ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	newRequest := func() *http.Request {
+		req := httptest.NewRequest(http.MethodPost, "/app/invites/abc123/accept?token=secret-token", nil)
+		req.RemoteAddr = "192.0.2.1:12345"
+		req.Header.Set("Cookie", "mstudio_ext_session=secret-cookie")
+		req.Header.Set("Authorization", "Bearer secret-key")
+		req.Header.Set("User-Agent", "test")
+		req.Header.Set("X-Request-Id", "request")
+		return req
+	}
+
+	BeforeEach(func() {
+		out = &bytes.Buffer{}
+		opts = middleware.AccessLogOptions{
+			Format:      middleware.AccessLogFormatJSON,
+			Output:      out,
+			Level:       slog.LevelInfo,
+			RedactPaths: []*regexp.Regexp{regexp.MustCompile(`/invites/[^/]+`)},
+		}
+	})
+
+	It("should log requests as JSON", func() {
+		serve(newRequest())
+
+		entry := map[string]any{}
+		Expect(json.Unmarshal(out.Bytes(), &entry)).To(Succeed())
+		Expect(entry).To(HaveKeyWithValue("method", "POST"))
+		Expect(entry).To(HaveKeyWithValue("path", "/app[REDACTED]/accept"))
+		Expect(entry).To(HaveKeyWithValue("upstream", "/app/"))
+		Expect(entry).To(HaveKeyWithValue("status", BeNumerically("==", 201)))
+		Expect(entry).To(HaveKeyWithValue("bytes", BeNumerically("==", 5)))
+		Expect(entry).To(HaveKeyWithValue("user_id", "user"))
+		Expect(entry).To(HaveKeyWithValue("instance_id", "instance"))
+		Expect(entry).To(HaveKeyWithValue("request_id", "request"))
+		Expect(entry).To(HaveKey("duration"))
+	})
+
+	It("should log requests as logfmt", func() {
+		opts.Format = middleware.AccessLogFormatLogfmt
+		serve(newRequest())
+
+		Expect(out.String()).To(ContainSubstring("method=POST"))
+		Expect(out.String()).To(ContainSubstring("status=201"))
+		Expect(out.String()).To(ContainSubstring("user_id=user"))
+	})
+
+	It("should log requests in the Combined Log Format", func() {
+		opts.Format = middleware.AccessLogFormatCombined
+		serve(newRequest())
+
+		Expect(out.String()).To(MatchRegexp(`^192\.0\.2\.1 - user \[[^\]]+\] "POST /app\[REDACTED\]/accept HTTP/1\.1" 201 5 "-" "test"\n$`))
+	})
+
+	It("should escape control characters in the Combined Log Format", func() {
+		opts.Format = middleware.AccessLogFormatCombined
+
+		req := httptest.NewRequest(http.MethodGet, "/app/foo%0A127.0.0.1%20-%20-%20%22x", nil)
+		req.RemoteAddr = "192.0.2.1:12345"
+		req.Header.Set("User-Agent", "test\r\n\"agent\"")
+		serve(req)
+
+		Expect(strings.Count(out.String(), "\n")).To(Equal(1))
+		Expect(out.String()).To(ContainSubstring(`"GET /app/foo\x0A127.0.0.1 - - \"x HTTP/1.1"`))
+		Expect(out.String()).To(ContainSubstring(`"test\x0D\x0A\"agent\""`))
+	})
+
+	It("should not interleave concurrent entries in the Combined Log Format", func() {
+		opts.Format = middleware.AccessLogFormatCombined
+		opts.Output = &slowWriter{out: out}
+
+		logger, err := middleware.NewAccessLogger(opts)
+		Expect(err).NotTo(HaveOccurred())
+
+		handler := logger.Middleware(next)
+
+		var wg sync.WaitGroup
+		for range 20 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				handler.ServeHTTP(httptest.NewRecorder(), newRequest())
+			}()
+		}
+		wg.Wait()
+
+		lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+		Expect(lines).To(HaveLen(20))
+		for _, line := range lines {
+			Expect(line).To(MatchRegexp(`^192\.0\.2\.1 - user \[[^\]]+\] "POST /app\[REDACTED\]/accept HTTP/1\.1" 201 5 "-" "test"$`))
+		}
+	})
+
+	It("should redact headers", func() {
+		opts.Headers = []string{"User-Agent", "Authorization", "Cookie", "X-Custom"}
+		opts.RedactHeaders = []string{"x-custom"}
+
+		req := newRequest()
+		req.Header.Set("X-Custom", "custom")
+		serve(req)
+
+		entry := map[string]any{}
+		Expect(json.Unmarshal(out.Bytes(), &entry)).To(Succeed())
+		Expect(entry).To(HaveKeyWithValue("headers", map[string]any{
+			"User-Agent":    "test",
+			"Authorization": "[REDACTED]",
+			"Cookie":        "[REDACTED]",
+			"X-Custom":      "[REDACTED]",
+		}))
+	})
+
+	It("should never log cookies or tokens", func() {
+		for _, format := range []middleware.AccessLogFormat{middleware.AccessLogFormatJSON, middleware.AccessLogFormatLogfmt, middleware.AccessLogFormatCombined} {
+			out.Reset()
+			opts.Format = format
+			opts.Headers = []string{"Authorization", "Cookie"}
+
+			req := newRequest()
+			req.Header.Set("Referer", "https://example.com/?token=secret-referer")
+			serve(req)
+
+			Expect(out.String()).NotTo(BeEmpty())
+			Expect(out.String()).NotTo(ContainSubstring("secret"))
+		}
+	})
+
+	It("should not log if the level is below the minimum level", func() {
+		opts.Level = slog.LevelDebug
+		opts.MinLevel = slog.LevelInfo
+		serve(newRequest())
+
+		Expect(out.String()).To(BeEmpty())
+	})
+
+	It("should reject unknown formats", func() {
+		opts.Format = "xml"
+
+		_, err := middleware.NewAccessLogger(opts)
+		Expect(err).To(HaveOccurred())
+	})
+})
+
+// slowWriter writes byte by byte, so that concurrent writes would interleave
+// (and be reported by the race detector) unless they are serialized.
+type slowWriter struct {
+	out *bytes.Buffer
+}
+
+func (w *slowWriter) Write(p []byte) (int, error) {
+	for _, b := range p {
+		w.out.WriteByte(b)
+		runtime.Gosched()
+	}
+
+	return len(p), nil
+}
@@ -0,0 +1,63 @@
+// Package middleware contains the HTTP middlewares that wrap the proxy's
+// handlers.
+package middleware
+
+import "net/http"
+
+// ResponseRecorder records the status and size of a response. Unlike most
+// third-party wrappers, it supports http.ResponseController, which is needed
+// for extending the write deadline of streaming responses.
+type ResponseRecorder struct {
+	http.ResponseWriter
+
+	status int
+	bytes  int64
+}
+
+func NewResponseRecorder(w http.ResponseWriter) *ResponseRecorder {
+	return &ResponseRecorder{ResponseWriter: w}
+}
+
+// Status returns the response status; if no status was written (yet), this is
+// 200 OK.
+func (r *ResponseRecorder) Status() int {
+	if r.status == 0 {
+		return http.StatusOK
+	}
+
+	return r.status
+}
+
+// BytesWritten returns the size of the response body written so far.
+func (r *ResponseRecorder) BytesWritten() int64 {
+	return r.bytes
+}
+
+func (r *ResponseRecorder) WriteHeader(code int) {
+	if r.status == 0 {
+		r.status = code
+	}
+
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *ResponseRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += int64(n)
+
+	return n, err
+}
+
+func (r *ResponseRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (r *ResponseRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
@@ -0,0 +1,108 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+)
+
+// RequestIDHeader is the header that carries the request ID; it is accepted
+// from clients, passed on to the upstreams and returned in the response.
+const RequestIDHeader = "X-Request-Id"
+
+// maxRequestIDLength limits the length of request IDs that are accepted from
+// clients.
+const maxRequestIDLength = 128
+
+type requestIDContextKey struct{}
+
+// ContextWithRequestID returns a copy of the context that carries the request
+// ID.
+func ContextWithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDContextKey{}, id)
+}
+
+// RequestIDFromContext returns the ID of the current request, or an empty
+// string if there is none.
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDContextKey{}).(string)
+	return id
+}
+
+// NewRequestID generates a random request ID.
+func NewRequestID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+
+	return hex.EncodeToString(b)
+}
+
+// RequestID accepts the X-Request-Id header of incoming requests, or generates
+// a new ID if the header is missing or invalid. The ID is stored in the request
+// context, set in the request headers (so that it is passed on to the
+// upstreams) and returned in the response headers.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !isValidRequestID(id) {
+			id = NewRequestID()
+		}
+
+		r.Header.Set(RequestIDHeader, id)
+		w.Header().Set(RequestIDHeader, id)
+
+		next.ServeHTTP(w, r.WithContext(ContextWithRequestID(r.Context(), id)))
+	})
+}
+
+// isValidRequestID checks that a client-supplied ID cannot be used to inject
+// arbitrary content into logs or headers.
+func isValidRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '_', c == '.', c == ':':
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+// requestIDLogHandler adds the request ID from the context to all log records.
+type requestIDLogHandler struct {
+	slog.Handler
+}
+
+// NewRequestIDLogHandler wraps a log handler, so that records that are logged
+// with a request context (like Logger.InfoContext) contain the request ID.
+func NewRequestIDLogHandler(h slog.Handler) slog.Handler {
+	if _, ok := h.(*requestIDLogHandler); ok {
+		return h
+	}
+
+	return &requestIDLogHandler{Handler: h}
+}
+
+func (h *requestIDLogHandler) Handle(ctx context.Context, record slog.Record) error {
+	if id := RequestIDFromContext(ctx); id != "" {
+		record.AddAttrs(slog.String("request_id", id))
+	}
+
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h *requestIDLogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &requestIDLogHandler{Handler: h.Handler.WithAttrs(attrs)}
+}
+
+func (h *requestIDLogHandler) WithGroup(name string) slog.Handler {
+	return &requestIDLogHandler{Handler: h.Handler.WithGroup(name)}
+}
@@ -0,0 +1,74 @@
+package middleware_test
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/mittwald/mstudio-ext-proxy/pkg/middleware"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("RequestID", func() {
+	var seen string
+	var seenHeader string
+
+	handler := middleware.RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = middleware.RequestIDFromContext(r.Context())
+		seenHeader = r.Header.Get(middleware.RequestIDHeader)
+	}))
+
+	serve := func(id string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if id != "" {
+			req.Header.Set(middleware.RequestIDHeader, id)
+		}
+
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	It("should accept the client's request ID", func() {
+		rec := serve("support-123")
+
+		Expect(seen).To(Equal("support-123"))
+		Expect(seenHeader).To(Equal("support-123"))
+		Expect(rec.Header().Get(middleware.RequestIDHeader)).To(Equal("support-123"))
+	})
+
+	It("should generate a request ID if there is none", func() {
+		rec := serve("")
+
+		Expect(seen).To(HaveLen(32))
+		Expect(seenHeader).To(Equal(seen))
+		Expect(rec.Header().Get(middleware.RequestIDHeader)).To(Equal(seen))
+	})
+
+	It("should replace invalid request IDs", func() {
+		for _, id := range []string{"foo bar", "foo\nlevel=ERROR", strings.Repeat("a", 129)} {
+			serve(id)
+			Expect(seen).NotTo(Equal(id))
+			Expect(seen).To(HaveLen(32))
+		}
+	})
+})
+
+var _ = Describe("NewRequestIDLogHandler", func() {
+	It("should add the request ID to log records", func() {
+		out := &bytes.Buffer{}
+		logger := slog.New(middleware.NewRequestIDLogHandler(slog.NewTextHandler(out, nil))).With("foo", "bar")
+
+		logger.InfoContext(middleware.ContextWithRequestID(context.Background(), "support-123"), "with ID")
+		logger.InfoContext(context.Background(), "without ID")
+
+		lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+		Expect(lines).To(HaveLen(2))
+		Expect(lines[0]).To(ContainSubstring("foo=bar request_id=support-123"))
+		Expect(lines[1]).NotTo(ContainSubstring("request_id"))
+	})
+})
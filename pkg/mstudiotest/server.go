@@ -0,0 +1,461 @@
+// Package mstudiotest provides an in-process fake of the mittwald mStudio API
+// for integration tests. It implements the endpoints used by the proxy
+// (access token retrieval key authentication, session refresh, user lookup,
+// the marketplace public keys and extension instances), and allows tests to program users, tokens,
+// failures and latency.
+package mstudiotest
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mittwald/api-client-go/mittwaldv2"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/webhooks/webhookscommon"
+)
+
+// Endpoint identifies one of the API operations implemented by the Server. The
+// values are http.ServeMux patterns.
+type Endpoint string
+
+const (
+	EndpointAuthenticateWithRetrievalKey Endpoint = "POST /v2/authenticate/token-retrieval-key"
+	EndpointRefreshSession               Endpoint = "PUT /v2/users/self/sessions"
+	EndpointGetUser                      Endpoint = "GET /v2/users/{userId}"
+	EndpointGetPublicKey                 Endpoint = "GET /v2/public-keys/{serial}"
+	EndpointListExtensionInstances       Endpoint = "GET /v2/extension-instances"
+)
+
+const DefaultTokenTTL = time.Hour
+
+// User is a user known to the fake API.
+type User struct {
+	ID        string
+	Email     string
+	FirstName string
+	LastName  string
+}
+
+// ExtensionInstance is an extension instance known to the fake API.
+type ExtensionInstance struct {
+	ID          string
+	ExtensionID string
+	ContextKind string
+	ContextID   string
+	Scopes      []string
+	Disabled    bool
+}
+
+type accessToken struct {
+	userID  string
+	expires time.Time
+}
+
+type failure struct {
+	status int
+	times  int
+}
+
+// Server is a fake mStudio API, served by an httptest.Server. Create it using
+// NewServer and close it when done.
+type Server struct {
+	*httptest.Server
+
+	// TokenTTL is the lifetime of access tokens issued by the server.
+	TokenTTL time.Duration
+
+	lock          sync.Mutex
+	users         map[string]User
+	retrievalKeys map[string]string
+	accessTokens  map[string]accessToken
+	refreshTokens map[string]string
+	publicKeys    map[string]ed25519.PublicKey
+	instances     []ExtensionInstance
+	failures      map[Endpoint]*failure
+	latencies     map[Endpoint]time.Duration
+	requests      map[Endpoint]int
+	requestIDs    map[Endpoint][]string
+}
+
+// NewServer starts a new fake API server.
+func NewServer() *Server {
+	s := &Server{
+		TokenTTL:      DefaultTokenTTL,
+		users:         make(map[string]User),
+		retrievalKeys: make(map[string]string),
+		accessTokens:  make(map[string]accessToken),
+		refreshTokens: make(map[string]string),
+		publicKeys:    make(map[string]ed25519.PublicKey),
+		failures:      make(map[Endpoint]*failure),
+		latencies:     make(map[Endpoint]time.Duration),
+		requests:      make(map[Endpoint]int),
+		requestIDs:    make(map[Endpoint][]string),
+	}
+
+	mux := http.NewServeMux()
+	s.handle(mux, EndpointAuthenticateWithRetrievalKey, s.handleAuthenticateWithRetrievalKey)
+	s.handle(mux, EndpointRefreshSession, s.handleRefreshSession)
+	s.handle(mux, EndpointGetUser, s.handleGetUser)
+	s.handle(mux, EndpointGetPublicKey, s.handleGetPublicKey)
+	s.handle(mux, EndpointListExtensionInstances, s.handleListExtensionInstances)
+
+	s.Server = httptest.NewServer(mux)
+	return s
+}
+
+// ClientOptions returns the options for building an API client that talks to
+// this server.
+func (s *Server) ClientOptions() []mittwaldv2.ClientOption {
+	return []mittwaldv2.ClientOption{mittwaldv2.WithBaseURL(s.URL)}
+}
+
+// AddUser registers a user, replacing any existing user with the same ID.
+func (s *Server) AddUser(u User) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.users[u.ID] = u
+}
+
+// IssueRetrievalKey returns a new access token retrieval key for a user, as
+// the mStudio would pass it to an extension during a one-click login. Like in
+// the real API, each key can only be used once.
+func (s *Server) IssueRetrievalKey(userID string) string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	key := uuid.NewString()
+	s.retrievalKeys[key] = userID
+	return key
+}
+
+// IssueTokens returns a new access and refresh token for a user without going
+// through the retrieval key authentication.
+func (s *Server) IssueTokens(userID string) (string, string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	token, refresh, _ := s.issueTokens(userID)
+	return token, refresh
+}
+
+// RevokeTokens invalidates all access and refresh tokens of a user.
+func (s *Server) RevokeTokens(userID string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for token, t := range s.accessTokens {
+		if t.userID == userID {
+			delete(s.accessTokens, token)
+		}
+	}
+
+	for refresh, u := range s.refreshTokens {
+		if u == userID {
+			delete(s.refreshTokens, refresh)
+		}
+	}
+}
+
+// AddPublicKey registers a public key that is used for signing webhooks.
+func (s *Server) AddPublicKey(serial string, key ed25519.PublicKey) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.publicKeys[serial] = key
+}
+
+// SetExtensionInstances replaces the extension instances that are returned by
+// the marketplace API. Listing instances requires an access token (see
+// IssueTokens).
+func (s *Server) SetExtensionInstances(instances ...ExtensionInstance) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.instances = instances
+}
+
+// GenerateSigner generates a new key pair, registers the public key under the
+// given serial and returns a signer for sending webhooks that verify against
+// this server.
+func (s *Server) GenerateSigner(serial string) (*webhookscommon.Signer, error) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	s.AddPublicKey(serial, publicKey)
+
+	return &webhookscommon.Signer{Serial: serial, PrivateKey: privateKey}, nil
+}
+
+// FailNext makes the next n requests to an endpoint fail with the given HTTP
+// status code.
+func (s *Server) FailNext(e Endpoint, status int, n int) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.failures[e] = &failure{status: status, times: n}
+}
+
+// SetLatency delays all responses of an endpoint by the given duration. Use a
+// zero duration to reset.
+func (s *Server) SetLatency(e Endpoint, d time.Duration) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.latencies[e] = d
+}
+
+// RequestCount returns the number of requests that were made to an endpoint,
+// including failed ones.
+func (s *Server) RequestCount(e Endpoint) int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.requests[e]
+}
+
+// RequestIDs returns the X-Request-Id headers of the requests that were made to
+// an endpoint (including empty ones for requests without the header).
+func (s *Server) RequestIDs(e Endpoint) []string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return append([]string{}, s.requestIDs[e]...)
+}
+
+func (s *Server) handle(mux *http.ServeMux, e Endpoint, h http.HandlerFunc) {
+	mux.HandleFunc(string(e), func(w http.ResponseWriter, r *http.Request) {
+		s.lock.Lock()
+		s.requests[e]++
+		s.requestIDs[e] = append(s.requestIDs[e], r.Header.Get("X-Request-Id"))
+		latency := s.latencies[e]
+
+		status := 0
+		if f, ok := s.failures[e]; ok && f.times > 0 {
+			f.times--
+			status = f.status
+		}
+		s.lock.Unlock()
+
+		if latency > 0 {
+			select {
+			case <-time.After(latency):
+			case <-r.Context().Done():
+				return
+			}
+		}
+
+		if status != 0 {
+			writeError(w, status, "injected failure")
+			return
+		}
+
+		h(w, r)
+	})
+}
+
+// issueTokens must be called with the lock held.
+func (s *Server) issueTokens(userID string) (string, string, time.Time) {
+	token := uuid.NewString()
+	refresh := uuid.NewString()
+	expires := time.Now().Add(s.TokenTTL).Truncate(time.Second)
+
+	s.accessTokens[token] = accessToken{userID: userID, expires: expires}
+	s.refreshTokens[refresh] = userID
+
+	return token, refresh, expires
+}
+
+// authenticatedUser returns the ID of the user that the request's access token
+// belongs to, or an empty string if the token is missing, unknown or expired.
+func (s *Server) authenticatedUser(r *http.Request) string {
+	token := r.Header.Get("X-Access-Token")
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		token = strings.TrimPrefix(auth, "Bearer ")
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	t, ok := s.accessTokens[token]
+	if !ok || t.expires.Before(time.Now()) {
+		return ""
+	}
+
+	return t.userID
+}
+
+func (s *Server) handleAuthenticateWithRetrievalKey(w http.ResponseWriter, r *http.Request) {
+	body := struct {
+		AccessTokenRetrievalKey string `json:"accessTokenRetrievalKey"`
+		UserID                  string `json:"userId"`
+	}{}
+
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	userID, ok := s.retrievalKeys[body.AccessTokenRetrievalKey]
+	if !ok || userID != body.UserID {
+		writeError(w, http.StatusForbidden, "invalid access token retrieval key")
+		return
+	}
+
+	delete(s.retrievalKeys, body.AccessTokenRetrievalKey)
+
+	token, refresh, expires := s.issueTokens(userID)
+	writeJSON(w, http.StatusOK, tokenResponse(token, refresh, expires))
+}
+
+func (s *Server) handleRefreshSession(w http.ResponseWriter, r *http.Request) {
+	body := struct {
+		RefreshToken string `json:"refreshToken"`
+	}{}
+
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	userID, ok := s.refreshTokens[body.RefreshToken]
+	if !ok {
+		writeError(w, http.StatusForbidden, "invalid refresh token")
+		return
+	}
+
+	// refresh tokens are rotated on every use
+	delete(s.refreshTokens, body.RefreshToken)
+
+	token, refresh, expires := s.issueTokens(userID)
+	writeJSON(w, http.StatusOK, tokenResponse(token, refresh, expires))
+}
+
+func (s *Server) handleGetUser(w http.ResponseWriter, r *http.Request) {
+	authenticatedUserID := s.authenticatedUser(r)
+	if authenticatedUserID == "" {
+		writeError(w, http.StatusUnauthorized, "missing or invalid access token")
+		return
+	}
+
+	userID := r.PathValue("userId")
+	if userID == "self" {
+		userID = authenticatedUserID
+	}
+
+	if userID != authenticatedUserID {
+		writeError(w, http.StatusForbidden, "permission denied")
+		return
+	}
+
+	s.lock.Lock()
+	user, ok := s.users[userID]
+	s.lock.Unlock()
+
+	if !ok {
+		writeError(w, http.StatusNotFound, "user not found")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"userId": user.ID,
+		"email":  user.Email,
+		"person": map[string]any{
+			"firstName": user.FirstName,
+			"lastName":  user.LastName,
+		},
+	})
+}
+
+func (s *Server) handleGetPublicKey(w http.ResponseWriter, r *http.Request) {
+	serial := r.PathValue("serial")
+
+	s.lock.Lock()
+	key, ok := s.publicKeys[serial]
+	s.lock.Unlock()
+
+	if !ok {
+		writeError(w, http.StatusNotFound, "public key not found")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"algorithm": "Ed25519",
+		"key":       base64.StdEncoding.EncodeToString(key),
+		"serial":    serial,
+	})
+}
+
+func (s *Server) handleListExtensionInstances(w http.ResponseWriter, r *http.Request) {
+	if s.authenticatedUser(r) == "" {
+		writeError(w, http.StatusUnauthorized, "missing or invalid access token")
+		return
+	}
+
+	query := r.URL.Query()
+	extensionID := query.Get("extensionId")
+	skip, _ := strconv.Atoi(query.Get("skip"))
+	limit, err := strconv.Atoi(query.Get("limit"))
+	if err != nil || limit <= 0 {
+		limit = 1000
+	}
+
+	s.lock.Lock()
+	out := make([]map[string]any, 0)
+	for _, inst := range s.instances {
+		if extensionID != "" && inst.ExtensionID != extensionID {
+			continue
+		}
+
+		out = append(out, map[string]any{
+			"id":                 inst.ID,
+			"extensionId":        inst.ExtensionID,
+			"aggregateReference": map[string]any{"aggregate": inst.ContextKind, "id": inst.ContextID},
+			"consentedScopes":    inst.Scopes,
+			"disabled":           inst.Disabled,
+		})
+	}
+	s.lock.Unlock()
+
+	out = out[min(skip, len(out)):]
+	out = out[:min(limit, len(out))]
+
+	writeJSON(w, http.StatusOK, out)
+}
+
+func tokenResponse(token, refresh string, expires time.Time) map[string]any {
+	return map[string]any{
+		"token":        token,
+		"refreshToken": refresh,
+		"expiresAt":    expires,
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]any{
+		"type":    http.StatusText(status),
+		"message": message,
+	})
+}
@@ -0,0 +1,98 @@
+package persistence
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"sync"
+
+	"github.com/mittwald/mstudio-ext-proxy/pkg/domain/model"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/domain/repository"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+var _ repository.APIKeyRepository = &memoryAPIKeyRepository{}
+
+// memoryAPIKeyRepository is an in-memory implementation of
+// repository.APIKeyRepository, intended for tests and local development.
+type memoryAPIKeyRepository struct {
+	lock sync.RWMutex
+	keys map[string]model.APIKey
+}
+
+func NewMemoryAPIKeyRepository() repository.APIKeyRepository {
+	return &memoryAPIKeyRepository{
+		keys: make(map[string]model.APIKey),
+	}
+}
+
+func (m *memoryAPIKeyRepository) FindAPIKeyByIDAndSecret(_ context.Context, id string, secret []byte) (*model.APIKey, error) {
+	m.lock.RLock()
+	key, ok := m.keys[id]
+	m.lock.RUnlock()
+
+	if !ok {
+		return nil, mongo.ErrNoDocuments
+	}
+
+	hashed := sha256.Sum256(secret)
+	if subtle.ConstantTimeCompare(key.Secret, hashed[:]) != 1 {
+		return nil, ErrInvalidAPIKeySecret
+	}
+
+	return &key, nil
+}
+
+func (m *memoryAPIKeyRepository) FindAPIKeysByInstanceID(_ context.Context, instanceID string) ([]model.APIKey, error) {
+	return m.findAPIKeys(func(k model.APIKey) bool { return k.InstanceID == instanceID }), nil
+}
+
+func (m *memoryAPIKeyRepository) FindAPIKeysByUserIDAndInstanceID(_ context.Context, userID, instanceID string) ([]model.APIKey, error) {
+	return m.findAPIKeys(func(k model.APIKey) bool { return k.UserID == userID && k.InstanceID == instanceID }), nil
+}
+
+func (m *memoryAPIKeyRepository) findAPIKeys(filter func(model.APIKey) bool) []model.APIKey {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	out := make([]model.APIKey, 0)
+	for _, key := range m.keys {
+		if filter(key) {
+			out = append(out, key)
+		}
+	}
+
+	return out
+}
+
+func (m *memoryAPIKeyRepository) CreateAPIKeyWithUnhashedSecret(_ context.Context, key model.APIKey) error {
+	hashed := sha256.Sum256(key.Secret)
+	key.Secret = hashed[:]
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.keys[key.ID] = key
+	return nil
+}
+
+func (m *memoryAPIKeyRepository) RemoveAPIKeyByID(_ context.Context, id string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	delete(m.keys, id)
+	return nil
+}
+
+func (m *memoryAPIKeyRepository) RemoveAPIKeyByIDUserIDAndInstanceID(_ context.Context, id, userID, instanceID string) (bool, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	key, ok := m.keys[id]
+	if !ok || key.UserID != userID || key.InstanceID != instanceID {
+		return false, nil
+	}
+
+	delete(m.keys, id)
+	return true, nil
+}
@@ -0,0 +1,89 @@
+package persistence
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+
+	"github.com/mittwald/mstudio-ext-proxy/pkg/domain/model"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/domain/repository"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+var _ repository.APIKeyRepository = &mongoAPIKeyRepository{}
+
+var ErrInvalidAPIKeySecret = errors.New("invalid API key secret")
+
+// mongoAPIKeyRepository stores API keys with SHA-256 hashed secrets. In
+// contrast to user passwords, API key secrets are long random values, so that a
+// (slow) password hash is not required.
+type mongoAPIKeyRepository struct {
+	collection *mongo.Collection
+}
+
+func NewMongoAPIKeyRepository(collection *mongo.Collection) repository.APIKeyRepository {
+	return &mongoAPIKeyRepository{
+		collection: collection,
+	}
+}
+
+func (m *mongoAPIKeyRepository) FindAPIKeyByIDAndSecret(ctx context.Context, id string, secret []byte) (*model.APIKey, error) {
+	key := model.APIKey{}
+
+	if err := m.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&key); err != nil {
+		return nil, err
+	}
+
+	hashed := sha256.Sum256(secret)
+	if subtle.ConstantTimeCompare(key.Secret, hashed[:]) != 1 {
+		return nil, ErrInvalidAPIKeySecret
+	}
+
+	return &key, nil
+}
+
+func (m *mongoAPIKeyRepository) FindAPIKeysByInstanceID(ctx context.Context, instanceID string) ([]model.APIKey, error) {
+	return m.findAPIKeys(ctx, bson.M{"instanceid": instanceID})
+}
+
+func (m *mongoAPIKeyRepository) FindAPIKeysByUserIDAndInstanceID(ctx context.Context, userID, instanceID string) ([]model.APIKey, error) {
+	return m.findAPIKeys(ctx, bson.M{"userid": userID, "instanceid": instanceID})
+}
+
+func (m *mongoAPIKeyRepository) findAPIKeys(ctx context.Context, filter bson.M) ([]model.APIKey, error) {
+	cursor, err := m.collection.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]model.APIKey, 0)
+	if err := cursor.All(ctx, &out); err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+func (m *mongoAPIKeyRepository) CreateAPIKeyWithUnhashedSecret(ctx context.Context, key model.APIKey) error {
+	hashed := sha256.Sum256(key.Secret)
+	key.Secret = hashed[:]
+
+	_, err := m.collection.InsertOne(ctx, key)
+	return err
+}
+
+func (m *mongoAPIKeyRepository) RemoveAPIKeyByID(ctx context.Context, id string) error {
+	_, err := m.collection.DeleteOne(ctx, bson.M{"_id": id})
+	return err
+}
+
+func (m *mongoAPIKeyRepository) RemoveAPIKeyByIDUserIDAndInstanceID(ctx context.Context, id, userID, instanceID string) (bool, error) {
+	res, err := m.collection.DeleteOne(ctx, bson.M{"_id": id, "userid": userID, "instanceid": instanceID})
+	if err != nil {
+		return false, err
+	}
+
+	return res.DeletedCount > 0, nil
+}
@@ -0,0 +1,146 @@
+package persistence
+
+import (
+	"context"
+	"sync"
+
+	"github.com/mittwald/mstudio-ext-proxy/pkg/domain/model"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/domain/repository"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+var _ repository.ExtensionInstanceRepository = &memoryExtensionInstanceRepository{}
+
+// memoryExtensionInstanceRepository is an in-memory implementation of
+// repository.ExtensionInstanceRepository, intended for tests and local
+// development.
+type memoryExtensionInstanceRepository struct {
+	lock      sync.RWMutex
+	instances map[string]model.ExtensionInstance
+}
+
+func NewMemoryExtensionInstanceRepository(instances ...model.ExtensionInstance) repository.ExtensionInstanceRepository {
+	repo := &memoryExtensionInstanceRepository{
+		instances: make(map[string]model.ExtensionInstance),
+	}
+
+	for _, instance := range instances {
+		repo.instances[instance.ID] = instance
+	}
+
+	return repo
+}
+
+func (m *memoryExtensionInstanceRepository) FindExtensionInstanceByID(_ context.Context, instanceID string) (model.ExtensionInstance, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	instance, ok := m.instances[instanceID]
+	if !ok {
+		return instance, mongo.ErrNoDocuments
+	}
+
+	return instance, nil
+}
+
+func (m *memoryExtensionInstanceRepository) FindExtensionInstancesByIDs(_ context.Context, instanceIDs []string) ([]model.ExtensionInstance, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	out := make([]model.ExtensionInstance, 0)
+	for _, id := range instanceIDs {
+		if instance, ok := m.instances[id]; ok {
+			out = append(out, instance)
+		}
+	}
+
+	return out, nil
+}
+
+func (m *memoryExtensionInstanceRepository) FindExtensionInstancesByExtensionID(_ context.Context, extensionID string) ([]model.ExtensionInstance, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	out := make([]model.ExtensionInstance, 0)
+	for _, instance := range m.instances {
+		if instance.ExtensionID == extensionID {
+			out = append(out, instance)
+		}
+	}
+
+	return out, nil
+}
+
+func (m *memoryExtensionInstanceRepository) AddExtensionInstance(_ context.Context, instance model.ExtensionInstance) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.instances[instance.ID] = instance
+	return nil
+}
+
+func (m *memoryExtensionInstanceRepository) UpdateExtensionInstance(_ context.Context, instance model.ExtensionInstance) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if _, ok := m.instances[instance.ID]; ok {
+		m.instances[instance.ID] = instance
+	}
+
+	return nil
+}
+
+func (m *memoryExtensionInstanceRepository) SyncExtensionInstance(_ context.Context, instance model.ExtensionInstance) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	instance.Secret = nil
+	if existing, ok := m.instances[instance.ID]; ok {
+		instance.Secret = existing.Secret
+	}
+
+	m.instances[instance.ID] = instance
+	return nil
+}
+
+func (m *memoryExtensionInstanceRepository) SyncExistingExtensionInstance(_ context.Context, instance model.ExtensionInstance) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	existing, ok := m.instances[instance.ID]
+	if !ok {
+		return nil
+	}
+
+	instance.Secret = existing.Secret
+	m.instances[instance.ID] = instance
+	return nil
+}
+
+func (m *memoryExtensionInstanceRepository) AssignExtensionIDToLegacyInstances(_ context.Context, extensionID string) (int, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	updated := 0
+	for id, instance := range m.instances {
+		if instance.ExtensionID == "" {
+			instance.ExtensionID = extensionID
+			m.instances[id] = instance
+			updated++
+		}
+	}
+
+	return updated, nil
+}
+
+func (m *memoryExtensionInstanceRepository) RemoveExtensionInstance(ctx context.Context, instance model.ExtensionInstance) error {
+	return m.RemoveExtensionInstanceByID(ctx, instance.ID)
+}
+
+func (m *memoryExtensionInstanceRepository) RemoveExtensionInstanceByID(_ context.Context, instanceID string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	delete(m.instances, instanceID)
+	return nil
+}
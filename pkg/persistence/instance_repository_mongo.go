@@ -6,6 +6,7 @@ import (
 	"github.com/mittwald/mstudio-ext-proxy/pkg/domain/repository"
 	"go.mongodb.org/mongo-driver/v2/bson"
 	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
 )
 
 var _ repository.ExtensionInstanceRepository = &mongoExtensionInstanceRepository{}
@@ -27,8 +28,33 @@ func (m *mongoExtensionInstanceRepository) FindExtensionInstanceByID(ctx context
 	return out, err
 }
 
+func (m *mongoExtensionInstanceRepository) FindExtensionInstancesByIDs(ctx context.Context, instanceIDs []string) ([]model.ExtensionInstance, error) {
+	return m.find(ctx, bson.M{"_id": bson.M{"$in": instanceIDs}})
+}
+
+func (m *mongoExtensionInstanceRepository) FindExtensionInstancesByExtensionID(ctx context.Context, extensionID string) ([]model.ExtensionInstance, error) {
+	return m.find(ctx, bson.M{"extensionid": extensionID})
+}
+
+func (m *mongoExtensionInstanceRepository) find(ctx context.Context, filter bson.M) ([]model.ExtensionInstance, error) {
+	cursor, err := m.collection.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]model.ExtensionInstance, 0)
+	if err := cursor.All(ctx, &out); err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+// AddExtensionInstance adds an extension instance, or replaces it if it already
+// exists (for example, when a webhook is delivered more than once).
 func (m *mongoExtensionInstanceRepository) AddExtensionInstance(ctx context.Context, instance model.ExtensionInstance) error {
-	_, err := m.collection.InsertOne(ctx, instance)
+	opts := options.Replace().SetUpsert(true)
+	_, err := m.collection.ReplaceOne(ctx, bson.M{"_id": instance.ID}, instance, opts)
 	return err
 }
 
@@ -37,6 +63,50 @@ func (m *mongoExtensionInstanceRepository) UpdateExtensionInstance(ctx context.C
 	return err
 }
 
+func (m *mongoExtensionInstanceRepository) SyncExtensionInstance(ctx context.Context, instance model.ExtensionInstance) error {
+	update := bson.M{
+		"$set": bson.M{
+			"extensionid": instance.ExtensionID,
+			"enabled":     instance.Enabled,
+			"context":     instance.Context,
+			"scopes":      instance.Scopes,
+		},
+		"$setOnInsert": bson.M{
+			"secret": nil,
+		},
+	}
+
+	opts := options.UpdateOne().SetUpsert(true)
+	_, err := m.collection.UpdateOne(ctx, bson.M{"_id": instance.ID}, update, opts)
+	return err
+}
+
+func (m *mongoExtensionInstanceRepository) SyncExistingExtensionInstance(ctx context.Context, instance model.ExtensionInstance) error {
+	update := bson.M{
+		"$set": bson.M{
+			"extensionid": instance.ExtensionID,
+			"enabled":     instance.Enabled,
+			"context":     instance.Context,
+			"scopes":      instance.Scopes,
+		},
+	}
+
+	_, err := m.collection.UpdateOne(ctx, bson.M{"_id": instance.ID}, update)
+	return err
+}
+
+func (m *mongoExtensionInstanceRepository) AssignExtensionIDToLegacyInstances(ctx context.Context, extensionID string) (int, error) {
+	filter := bson.M{"extensionid": bson.M{"$in": bson.A{"", nil}}}
+	update := bson.M{"$set": bson.M{"extensionid": extensionID}}
+
+	result, err := m.collection.UpdateMany(ctx, filter, update)
+	if err != nil {
+		return 0, err
+	}
+
+	return int(result.ModifiedCount), nil
+}
+
 func (m *mongoExtensionInstanceRepository) RemoveExtensionInstance(ctx context.Context, instance model.ExtensionInstance) error {
 	return m.RemoveExtensionInstanceByID(ctx, instance.ID)
 }
@@ -0,0 +1,84 @@
+package persistence
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/mittwald/mstudio-ext-proxy/pkg/domain/model"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/domain/repository"
+)
+
+var _ repository.LoginAttemptRepository = &memoryLoginAttemptRepository{}
+
+// memoryLoginAttemptRepository is an in-memory implementation of
+// repository.LoginAttemptRepository, intended for tests and local development.
+type memoryLoginAttemptRepository struct {
+	lock     sync.Mutex
+	attempts map[string]model.LoginAttempts
+}
+
+func NewMemoryLoginAttemptRepository() repository.LoginAttemptRepository {
+	return &memoryLoginAttemptRepository{
+		attempts: make(map[string]model.LoginAttempts),
+	}
+}
+
+func (m *memoryLoginAttemptRepository) FindLoginAttempts(_ context.Context, key string) (model.LoginAttempts, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	out, ok := m.attempts[key]
+	if !ok || out.Expires.Before(time.Now()) {
+		return model.LoginAttempts{Key: key}, nil
+	}
+
+	return out, nil
+}
+
+func (m *memoryLoginAttemptRepository) RegisterLoginAttempt(_ context.Context, key string, at time.Time, expires time.Time) (model.LoginAttempts, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	previous, ok := m.attempts[key]
+	if !ok || previous.Expires.Before(at) {
+		previous = model.LoginAttempts{Key: key}
+	}
+
+	updated := previous
+	updated.Failures++
+	updated.LastFailure = at
+	updated.Expires = expires
+	m.attempts[key] = updated
+
+	return previous, nil
+}
+
+func (m *memoryLoginAttemptRepository) RegisterLoginAttemptIfUnchanged(_ context.Context, key string, failures int, at time.Time, expires time.Time) (bool, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	current, ok := m.attempts[key]
+	if !ok || current.Expires.Before(at) {
+		current = model.LoginAttempts{Key: key}
+	}
+
+	if current.Failures != failures {
+		return false, nil
+	}
+
+	current.Failures++
+	current.LastFailure = at
+	current.Expires = expires
+	m.attempts[key] = current
+
+	return true, nil
+}
+
+func (m *memoryLoginAttemptRepository) ResetLoginAttempts(_ context.Context, key string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	delete(m.attempts, key)
+	return nil
+}
@@ -0,0 +1,137 @@
+package persistence
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/mittwald/mstudio-ext-proxy/pkg/domain/model"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/domain/repository"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+var _ repository.LoginAttemptRepository = &mongoLoginAttemptRepository{}
+
+type mongoLoginAttemptRepository struct {
+	collection *mongo.Collection
+}
+
+func MustNewMongoLoginAttemptRepository(collection *mongo.Collection) repository.LoginAttemptRepository {
+	repo, err := NewMongoLoginAttemptRepository(collection)
+	if err != nil {
+		panic(err)
+	}
+
+	return repo
+}
+
+func NewMongoLoginAttemptRepository(collection *mongo.Collection) (repository.LoginAttemptRepository, error) {
+	repo := &mongoLoginAttemptRepository{
+		collection: collection,
+	}
+
+	if err := repo.Setup(context.Background()); err != nil {
+		return nil, err
+	}
+
+	return repo, nil
+}
+
+func (m *mongoLoginAttemptRepository) Setup(ctx context.Context) error {
+	_, err := m.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	return err
+}
+
+func (m *mongoLoginAttemptRepository) FindLoginAttempts(ctx context.Context, key string) (model.LoginAttempts, error) {
+	out := model.LoginAttempts{}
+
+	err := m.collection.FindOne(ctx, bson.M{"_id": key}).Decode(&out)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return model.LoginAttempts{Key: key}, nil
+	}
+
+	// The TTL monitor only runs periodically, so expired records might still
+	// be around for a while.
+	if err == nil && out.Expires.Before(time.Now()) {
+		return model.LoginAttempts{Key: key}, nil
+	}
+
+	return out, err
+}
+
+func (m *mongoLoginAttemptRepository) RegisterLoginAttempt(ctx context.Context, key string, at time.Time, expires time.Time) (model.LoginAttempts, error) {
+	// The counter is reset within the same update if the existing record has
+	// already expired, but was not yet removed by the TTL monitor.
+	update := bson.A{
+		bson.M{"$set": bson.M{
+			"failures": bson.M{"$cond": bson.A{
+				bson.M{"$lt": bson.A{"$expires", at}},
+				1,
+				bson.M{"$add": bson.A{"$failures", 1}},
+			}},
+			"lastfailure": at,
+			"expires":     expires,
+		}},
+	}
+
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.Before)
+	previous := model.LoginAttempts{}
+
+	err := m.collection.FindOneAndUpdate(ctx, bson.M{"_id": key}, update, opts).Decode(&previous)
+
+	// Concurrent upserts of a missing record may conflict; the retry will find
+	// the record that was inserted by the other one.
+	if mongo.IsDuplicateKeyError(err) {
+		err = m.collection.FindOneAndUpdate(ctx, bson.M{"_id": key}, update, opts).Decode(&previous)
+	}
+
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return model.LoginAttempts{Key: key}, nil
+	}
+
+	if err == nil && previous.Expires.Before(at) {
+		return model.LoginAttempts{Key: key}, nil
+	}
+
+	return previous, err
+}
+
+func (m *mongoLoginAttemptRepository) RegisterLoginAttemptIfUnchanged(ctx context.Context, key string, failures int, at time.Time, expires time.Time) (bool, error) {
+	if failures == 0 {
+		// There is either no record, or an expired one that is replaced. If a
+		// current record was inserted concurrently, the filter does not match
+		// it, and the upsert fails with a duplicate key error.
+		filter := bson.M{"_id": key, "$or": bson.A{bson.M{"failures": 0}, bson.M{"expires": bson.M{"$lt": at}}}}
+		update := bson.M{"$set": bson.M{"failures": 1, "lastfailure": at, "expires": expires}}
+
+		_, err := m.collection.UpdateOne(ctx, filter, update, options.UpdateOne().SetUpsert(true))
+		if mongo.IsDuplicateKeyError(err) {
+			return false, nil
+		}
+
+		return err == nil, err
+	}
+
+	filter := bson.M{"_id": key, "failures": failures, "expires": bson.M{"$gte": at}}
+	update := bson.M{
+		"$inc": bson.M{"failures": 1},
+		"$set": bson.M{"lastfailure": at, "expires": expires},
+	}
+
+	result, err := m.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, err
+	}
+
+	return result.MatchedCount == 1, nil
+}
+
+func (m *mongoLoginAttemptRepository) ResetLoginAttempts(ctx context.Context, key string) error {
+	_, err := m.collection.DeleteOne(ctx, bson.M{"_id": key})
+	return err
+}
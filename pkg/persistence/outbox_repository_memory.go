@@ -0,0 +1,102 @@
+package persistence
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/mittwald/mstudio-ext-proxy/pkg/domain/model"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/domain/repository"
+)
+
+var _ repository.OutboxRepository = &memoryOutboxRepository{}
+
+// memoryOutboxRepository is an in-memory implementation of
+// repository.OutboxRepository, intended for tests and local development.
+type memoryOutboxRepository struct {
+	lock     sync.Mutex
+	messages map[string]model.OutboxMessage
+}
+
+func NewMemoryOutboxRepository() repository.OutboxRepository {
+	return &memoryOutboxRepository{
+		messages: make(map[string]model.OutboxMessage),
+	}
+}
+
+func (m *memoryOutboxRepository) AddOutboxMessage(_ context.Context, msg model.OutboxMessage) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if _, ok := m.messages[msg.ID]; !ok {
+		m.messages[msg.ID] = msg
+	}
+
+	return nil
+}
+
+func (m *memoryOutboxRepository) ClaimDueOutboxMessage(_ context.Context, now time.Time, lease time.Duration) (*model.OutboxMessage, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	var due *model.OutboxMessage
+	for _, msg := range m.messages {
+		if msg.Status != model.OutboxMessageStatusPending || msg.NextAttempt.After(now) {
+			continue
+		}
+
+		if due == nil || msg.NextAttempt.Before(due.NextAttempt) {
+			due = &msg
+		}
+	}
+
+	if due == nil {
+		return nil, nil
+	}
+
+	claimed := *due
+	claimed.NextAttempt = now.Add(lease)
+	m.messages[claimed.ID] = claimed
+
+	return &claimed, nil
+}
+
+func (m *memoryOutboxRepository) HasEarlierOutboxMessage(_ context.Context, msg model.OutboxMessage) (bool, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if msg.InstanceID == "" {
+		return false, nil
+	}
+
+	for _, other := range m.messages {
+		if other.ID != msg.ID &&
+			other.Status == model.OutboxMessageStatusPending &&
+			other.InstanceID == msg.InstanceID &&
+			other.TargetURL == msg.TargetURL &&
+			other.Created.Before(msg.Created) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func (m *memoryOutboxRepository) UpdateOutboxMessage(_ context.Context, msg model.OutboxMessage) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if _, ok := m.messages[msg.ID]; ok {
+		m.messages[msg.ID] = msg
+	}
+
+	return nil
+}
+
+func (m *memoryOutboxRepository) RemoveOutboxMessageByID(_ context.Context, id string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	delete(m.messages, id)
+	return nil
+}
@@ -0,0 +1,107 @@
+package persistence
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/mittwald/mstudio-ext-proxy/pkg/domain/model"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/domain/repository"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+var _ repository.OutboxRepository = &mongoOutboxRepository{}
+
+type mongoOutboxRepository struct {
+	collection *mongo.Collection
+}
+
+func MustNewMongoOutboxRepository(collection *mongo.Collection) repository.OutboxRepository {
+	repo, err := NewMongoOutboxRepository(collection)
+	if err != nil {
+		panic(err)
+	}
+
+	return repo
+}
+
+func NewMongoOutboxRepository(collection *mongo.Collection) (repository.OutboxRepository, error) {
+	repo := &mongoOutboxRepository{
+		collection: collection,
+	}
+
+	if err := repo.Setup(context.Background()); err != nil {
+		return nil, err
+	}
+
+	return repo, nil
+}
+
+func (m *mongoOutboxRepository) Setup(ctx context.Context) error {
+	_, err := m.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "status", Value: 1}, {Key: "nextattempt", Value: 1}},
+		},
+		{
+			Keys: bson.D{{Key: "instanceid", Value: 1}, {Key: "targeturl", Value: 1}, {Key: "created", Value: 1}},
+		},
+	})
+	return err
+}
+
+func (m *mongoOutboxRepository) AddOutboxMessage(ctx context.Context, msg model.OutboxMessage) error {
+	opts := options.UpdateOne().SetUpsert(true)
+	_, err := m.collection.UpdateOne(ctx, bson.M{"_id": msg.ID}, bson.M{"$setOnInsert": msg}, opts)
+	return err
+}
+
+func (m *mongoOutboxRepository) ClaimDueOutboxMessage(ctx context.Context, now time.Time, lease time.Duration) (*model.OutboxMessage, error) {
+	filter := bson.M{
+		"status":      model.OutboxMessageStatusPending,
+		"nextattempt": bson.M{"$lte": now},
+	}
+
+	update := bson.M{"$set": bson.M{"nextattempt": now.Add(lease)}}
+	opts := options.FindOneAndUpdate().SetSort(bson.D{{Key: "nextattempt", Value: 1}})
+
+	out := model.OutboxMessage{}
+
+	err := m.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&out)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &out, nil
+}
+
+func (m *mongoOutboxRepository) HasEarlierOutboxMessage(ctx context.Context, msg model.OutboxMessage) (bool, error) {
+	if msg.InstanceID == "" {
+		return false, nil
+	}
+
+	count, err := m.collection.CountDocuments(ctx, bson.M{
+		"_id":        bson.M{"$ne": msg.ID},
+		"status":     model.OutboxMessageStatusPending,
+		"instanceid": msg.InstanceID,
+		"targeturl":  msg.TargetURL,
+		"created":    bson.M{"$lt": msg.Created},
+	})
+
+	return count > 0, err
+}
+
+func (m *mongoOutboxRepository) UpdateOutboxMessage(ctx context.Context, msg model.OutboxMessage) error {
+	_, err := m.collection.ReplaceOne(ctx, bson.M{"_id": msg.ID}, msg)
+	return err
+}
+
+func (m *mongoOutboxRepository) RemoveOutboxMessageByID(ctx context.Context, id string) error {
+	_, err := m.collection.DeleteOne(ctx, bson.M{"_id": id})
+	return err
+}
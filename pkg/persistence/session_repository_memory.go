@@ -0,0 +1,94 @@
+package persistence
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/mittwald/mstudio-ext-proxy/pkg/domain/model"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/domain/repository"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var _ repository.SessionRepository = &memorySessionRepository{}
+
+// memorySessionRepository is an in-memory implementation of
+// repository.SessionRepository, intended for tests and local development.
+type memorySessionRepository struct {
+	lock     sync.RWMutex
+	sessions map[string]model.Session
+}
+
+func NewMemorySessionRepository() repository.SessionRepository {
+	return &memorySessionRepository{
+		sessions: make(map[string]model.Session),
+	}
+}
+
+func (m *memorySessionRepository) FindSessionByIDAndSecret(_ context.Context, id string, secret []byte) (*model.Session, error) {
+	m.lock.RLock()
+	session, ok := m.sessions[id]
+	m.lock.RUnlock()
+
+	if !ok {
+		return nil, mongo.ErrNoDocuments
+	}
+
+	if err := bcrypt.CompareHashAndPassword(session.SessionSecret, secret); err != nil {
+		return nil, err
+	}
+
+	return &session, nil
+}
+
+func (m *memorySessionRepository) CreateSessionWithUnhashedSecret(ctx context.Context, session model.Session) error {
+	enc, err := bcrypt.GenerateFromPassword(session.SessionSecret, bcrypt.MinCost)
+	if err != nil {
+		return err
+	}
+
+	session.SessionSecret = enc
+	return m.CreateSession(ctx, session)
+}
+
+func (m *memorySessionRepository) CreateSession(_ context.Context, session model.Session) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.sessions[session.ID] = session
+	return nil
+}
+
+func (m *memorySessionRepository) RefreshSession(_ context.Context, session model.Session) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	existing, ok := m.sessions[session.ID]
+	if !ok {
+		return nil
+	}
+
+	existing.AccessToken = session.AccessToken
+	existing.RefreshToken = session.RefreshToken
+	existing.Expires = session.Expires
+	m.sessions[session.ID] = existing
+
+	return nil
+}
+
+func (m *memorySessionRepository) CountActiveSessionsByInstance(_ context.Context) (map[string]int, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	counts := make(map[string]int)
+	now := time.Now()
+
+	for _, session := range m.sessions {
+		if session.Expires.After(now) {
+			counts[session.Instance.ID]++
+		}
+	}
+
+	return counts, nil
+}
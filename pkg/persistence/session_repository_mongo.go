@@ -4,10 +4,12 @@ import (
 	"context"
 	"github.com/mittwald/mstudio-ext-proxy/pkg/domain/model"
 	"github.com/mittwald/mstudio-ext-proxy/pkg/domain/repository"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/tracing"
 	"go.mongodb.org/mongo-driver/v2/bson"
 	"go.mongodb.org/mongo-driver/v2/mongo"
 	"go.mongodb.org/mongo-driver/v2/mongo/options"
 	"golang.org/x/crypto/bcrypt"
+	"time"
 )
 
 var _ repository.SessionRepository = &mongoSessionRepository{}
@@ -48,12 +50,22 @@ func (m *mongoSessionRepository) Setup(ctx context.Context) error {
 func (m *mongoSessionRepository) FindSessionByIDAndSecret(ctx context.Context, id string, secret []byte) (*model.Session, error) {
 	session := model.Session{}
 
-	if err := m.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&session); err != nil {
+	findCtx, findSpan := tracing.Start(ctx, "mongodb.FindSession")
+	err := m.collection.FindOne(findCtx, bson.M{"_id": id}).Decode(&session)
+	tracing.End(findSpan, err)
+
+	if err != nil {
+		_, hashSpan := tracing.Start(ctx, "bcrypt.GenerateFromPassword")
 		_, _ = bcrypt.GenerateFromPassword([]byte("dummy password"), bcrypt.DefaultCost)
+		hashSpan.End()
 		return nil, err
 	}
 
-	if err := bcrypt.CompareHashAndPassword(session.SessionSecret, secret); err != nil {
+	_, compareSpan := tracing.Start(ctx, "bcrypt.CompareHashAndPassword")
+	err = bcrypt.CompareHashAndPassword(session.SessionSecret, secret)
+	compareSpan.End()
+
+	if err != nil {
 		return nil, err
 	}
 
@@ -61,7 +73,9 @@ func (m *mongoSessionRepository) FindSessionByIDAndSecret(ctx context.Context, i
 }
 
 func (m *mongoSessionRepository) CreateSessionWithUnhashedSecret(ctx context.Context, session model.Session) error {
+	_, span := tracing.Start(ctx, "bcrypt.GenerateFromPassword")
 	enc, err := bcrypt.GenerateFromPassword(session.SessionSecret, bcrypt.DefaultCost)
+	tracing.End(span, err)
 	if err != nil {
 		return err
 	}
@@ -85,3 +99,29 @@ func (m *mongoSessionRepository) RefreshSession(ctx context.Context, session mod
 	_, err := m.collection.UpdateOne(ctx, bson.M{"_id": session.ID}, bson.M{"$set": update})
 	return err
 }
+
+func (m *mongoSessionRepository) CountActiveSessionsByInstance(ctx context.Context) (map[string]int, error) {
+	cursor, err := m.collection.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"expires": bson.M{"$gt": time.Now()}}}},
+		{{Key: "$group", Value: bson.M{"_id": "$instance._id", "count": bson.M{"$sum": 1}}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	results := []struct {
+		InstanceID string `bson:"_id"`
+		Count      int    `bson:"count"`
+	}{}
+
+	if err := cursor.All(ctx, &results); err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int, len(results))
+	for _, r := range results {
+		counts[r.InstanceID] = r.Count
+	}
+
+	return counts, nil
+}
@@ -0,0 +1,45 @@
+package persistence
+
+import (
+	"context"
+	"sync"
+
+	"github.com/mittwald/mstudio-ext-proxy/pkg/domain/model"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/domain/repository"
+)
+
+var _ repository.WebhookDeliveryRepository = &memoryWebhookDeliveryRepository{}
+
+// memoryWebhookDeliveryRepository is an in-memory implementation of
+// repository.WebhookDeliveryRepository, intended for tests and local
+// development.
+type memoryWebhookDeliveryRepository struct {
+	lock       sync.RWMutex
+	deliveries map[string]model.WebhookDelivery
+}
+
+func NewMemoryWebhookDeliveryRepository() repository.WebhookDeliveryRepository {
+	return &memoryWebhookDeliveryRepository{
+		deliveries: make(map[string]model.WebhookDelivery),
+	}
+}
+
+func (m *memoryWebhookDeliveryRepository) FindWebhookDeliveryByID(_ context.Context, id string) (*model.WebhookDelivery, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	delivery, ok := m.deliveries[id]
+	if !ok {
+		return nil, nil
+	}
+
+	return &delivery, nil
+}
+
+func (m *memoryWebhookDeliveryRepository) SaveWebhookDelivery(_ context.Context, delivery model.WebhookDelivery) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.deliveries[delivery.ID] = delivery
+	return nil
+}
@@ -0,0 +1,70 @@
+package persistence
+
+import (
+	"context"
+	"errors"
+
+	"github.com/mittwald/mstudio-ext-proxy/pkg/domain/model"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/domain/repository"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+var _ repository.WebhookDeliveryRepository = &mongoWebhookDeliveryRepository{}
+
+type mongoWebhookDeliveryRepository struct {
+	collection *mongo.Collection
+}
+
+func MustNewMongoWebhookDeliveryRepository(collection *mongo.Collection) repository.WebhookDeliveryRepository {
+	repo, err := NewMongoWebhookDeliveryRepository(collection)
+	if err != nil {
+		panic(err)
+	}
+
+	return repo
+}
+
+func NewMongoWebhookDeliveryRepository(collection *mongo.Collection) (repository.WebhookDeliveryRepository, error) {
+	repo := &mongoWebhookDeliveryRepository{
+		collection: collection,
+	}
+
+	if err := repo.Setup(context.Background()); err != nil {
+		return nil, err
+	}
+
+	return repo, nil
+}
+
+func (m *mongoWebhookDeliveryRepository) Setup(ctx context.Context) error {
+	_, err := m.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "expires", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+	})
+	return err
+}
+
+func (m *mongoWebhookDeliveryRepository) FindWebhookDeliveryByID(ctx context.Context, id string) (*model.WebhookDelivery, error) {
+	out := model.WebhookDelivery{}
+
+	err := m.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&out)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &out, nil
+}
+
+func (m *mongoWebhookDeliveryRepository) SaveWebhookDelivery(ctx context.Context, delivery model.WebhookDelivery) error {
+	opts := options.Replace().SetUpsert(true)
+	_, err := m.collection.ReplaceOne(ctx, bson.M{"_id": delivery.ID}, delivery, opts)
+	return err
+}
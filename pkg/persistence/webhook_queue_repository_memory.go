@@ -0,0 +1,162 @@
+package persistence
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/mittwald/mstudio-ext-proxy/pkg/domain/model"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/domain/repository"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+var _ repository.WebhookQueueRepository = &memoryWebhookQueueRepository{}
+
+// memoryWebhookQueueRepository is an in-memory implementation of
+// repository.WebhookQueueRepository, intended for tests and local development.
+type memoryWebhookQueueRepository struct {
+	lock        sync.Mutex
+	queue       map[string]model.QueuedWebhook
+	deadLetters map[string]model.QueuedWebhook
+}
+
+func NewMemoryWebhookQueueRepository() repository.WebhookQueueRepository {
+	return &memoryWebhookQueueRepository{
+		queue:       make(map[string]model.QueuedWebhook),
+		deadLetters: make(map[string]model.QueuedWebhook),
+	}
+}
+
+func (m *memoryWebhookQueueRepository) EnqueueWebhook(_ context.Context, wh model.QueuedWebhook) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if _, ok := m.queue[wh.ID]; !ok {
+		m.queue[wh.ID] = wh
+	}
+
+	return nil
+}
+
+func (m *memoryWebhookQueueRepository) ClaimDueWebhook(_ context.Context, now time.Time, lease time.Duration) (*model.QueuedWebhook, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	var due *model.QueuedWebhook
+	for _, wh := range m.queue {
+		if wh.NextAttempt.After(now) {
+			continue
+		}
+
+		if due == nil || wh.Enqueued.Before(due.Enqueued) {
+			due = &wh
+		}
+	}
+
+	if due == nil {
+		return nil, nil
+	}
+
+	claimed := *due
+	claimed.NextAttempt = now.Add(lease)
+	m.queue[claimed.ID] = claimed
+
+	return &claimed, nil
+}
+
+func (m *memoryWebhookQueueRepository) HasEarlierQueuedWebhook(_ context.Context, wh model.QueuedWebhook) (bool, error) {
+	if wh.InstanceID == "" {
+		return false, nil
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	for _, other := range m.queue {
+		if other.ID != wh.ID && other.InstanceID == wh.InstanceID && other.Enqueued.Before(wh.Enqueued) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func (m *memoryWebhookQueueRepository) UpdateQueuedWebhook(_ context.Context, wh model.QueuedWebhook) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if _, ok := m.queue[wh.ID]; ok {
+		m.queue[wh.ID] = wh
+	}
+
+	return nil
+}
+
+func (m *memoryWebhookQueueRepository) RemoveQueuedWebhookByID(_ context.Context, id string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	delete(m.queue, id)
+	return nil
+}
+
+func (m *memoryWebhookQueueRepository) MoveWebhookToDeadLetters(_ context.Context, wh model.QueuedWebhook) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.deadLetters[wh.ID] = wh
+	delete(m.queue, wh.ID)
+	return nil
+}
+
+func (m *memoryWebhookQueueRepository) FindDeadLetters(_ context.Context) ([]model.QueuedWebhook, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	out := make([]model.QueuedWebhook, 0, len(m.deadLetters))
+	for _, wh := range m.deadLetters {
+		out = append(out, wh)
+	}
+
+	slices.SortFunc(out, func(a, b model.QueuedWebhook) int {
+		return a.DeadLettered.Compare(b.DeadLettered)
+	})
+
+	return out, nil
+}
+
+func (m *memoryWebhookQueueRepository) FindDeadLetterByID(_ context.Context, id string) (*model.QueuedWebhook, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	wh, ok := m.deadLetters[id]
+	if !ok {
+		return nil, mongo.ErrNoDocuments
+	}
+
+	return &wh, nil
+}
+
+func (m *memoryWebhookQueueRepository) ReplayDeadLetter(ctx context.Context, id string) error {
+	wh, err := m.FindDeadLetterByID(ctx, id)
+	if err != nil {
+		return fmt.Errorf("error retrieving dead letter %s: %w", id, err)
+	}
+
+	now := time.Now()
+
+	wh.Attempts = 0
+	wh.LastError = ""
+	wh.Enqueued = now
+	wh.NextAttempt = now
+	wh.DeadLettered = time.Time{}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.queue[wh.ID] = *wh
+	delete(m.deadLetters, id)
+	return nil
+}
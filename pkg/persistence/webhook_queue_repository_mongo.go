@@ -0,0 +1,155 @@
+package persistence
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/mittwald/mstudio-ext-proxy/pkg/domain/model"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/domain/repository"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+var _ repository.WebhookQueueRepository = &mongoWebhookQueueRepository{}
+
+type mongoWebhookQueueRepository struct {
+	queue       *mongo.Collection
+	deadLetters *mongo.Collection
+}
+
+func MustNewMongoWebhookQueueRepository(queue, deadLetters *mongo.Collection) repository.WebhookQueueRepository {
+	repo, err := NewMongoWebhookQueueRepository(queue, deadLetters)
+	if err != nil {
+		panic(err)
+	}
+
+	return repo
+}
+
+func NewMongoWebhookQueueRepository(queue, deadLetters *mongo.Collection) (repository.WebhookQueueRepository, error) {
+	repo := &mongoWebhookQueueRepository{
+		queue:       queue,
+		deadLetters: deadLetters,
+	}
+
+	if err := repo.Setup(context.Background()); err != nil {
+		return nil, err
+	}
+
+	return repo, nil
+}
+
+func (m *mongoWebhookQueueRepository) Setup(ctx context.Context) error {
+	_, err := m.queue.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "nextattempt", Value: 1}, {Key: "enqueued", Value: 1}}},
+		{Keys: bson.D{{Key: "instanceid", Value: 1}, {Key: "enqueued", Value: 1}}},
+	})
+	return err
+}
+
+func (m *mongoWebhookQueueRepository) EnqueueWebhook(ctx context.Context, wh model.QueuedWebhook) error {
+	opts := options.UpdateOne().SetUpsert(true)
+	_, err := m.queue.UpdateOne(ctx, bson.M{"_id": wh.ID}, bson.M{"$setOnInsert": wh}, opts)
+	return err
+}
+
+func (m *mongoWebhookQueueRepository) ClaimDueWebhook(ctx context.Context, now time.Time, lease time.Duration) (*model.QueuedWebhook, error) {
+	filter := bson.M{"nextattempt": bson.M{"$lte": now}}
+	update := bson.M{"$set": bson.M{"nextattempt": now.Add(lease)}}
+	opts := options.FindOneAndUpdate().SetSort(bson.D{{Key: "enqueued", Value: 1}})
+
+	out := model.QueuedWebhook{}
+
+	err := m.queue.FindOneAndUpdate(ctx, filter, update, opts).Decode(&out)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &out, nil
+}
+
+func (m *mongoWebhookQueueRepository) HasEarlierQueuedWebhook(ctx context.Context, wh model.QueuedWebhook) (bool, error) {
+	if wh.InstanceID == "" {
+		return false, nil
+	}
+
+	count, err := m.queue.CountDocuments(ctx, bson.M{
+		"_id":        bson.M{"$ne": wh.ID},
+		"instanceid": wh.InstanceID,
+		"enqueued":   bson.M{"$lt": wh.Enqueued},
+	})
+
+	return count > 0, err
+}
+
+func (m *mongoWebhookQueueRepository) UpdateQueuedWebhook(ctx context.Context, wh model.QueuedWebhook) error {
+	_, err := m.queue.ReplaceOne(ctx, bson.M{"_id": wh.ID}, wh)
+	return err
+}
+
+func (m *mongoWebhookQueueRepository) RemoveQueuedWebhookByID(ctx context.Context, id string) error {
+	_, err := m.queue.DeleteOne(ctx, bson.M{"_id": id})
+	return err
+}
+
+func (m *mongoWebhookQueueRepository) MoveWebhookToDeadLetters(ctx context.Context, wh model.QueuedWebhook) error {
+	opts := options.Replace().SetUpsert(true)
+	if _, err := m.deadLetters.ReplaceOne(ctx, bson.M{"_id": wh.ID}, wh, opts); err != nil {
+		return err
+	}
+
+	return m.RemoveQueuedWebhookByID(ctx, wh.ID)
+}
+
+func (m *mongoWebhookQueueRepository) FindDeadLetters(ctx context.Context) ([]model.QueuedWebhook, error) {
+	cursor, err := m.deadLetters.Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "deadlettered", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]model.QueuedWebhook, 0)
+	if err := cursor.All(ctx, &out); err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+func (m *mongoWebhookQueueRepository) FindDeadLetterByID(ctx context.Context, id string) (*model.QueuedWebhook, error) {
+	out := model.QueuedWebhook{}
+	if err := m.deadLetters.FindOne(ctx, bson.M{"_id": id}).Decode(&out); err != nil {
+		return nil, err
+	}
+
+	return &out, nil
+}
+
+func (m *mongoWebhookQueueRepository) ReplayDeadLetter(ctx context.Context, id string) error {
+	wh, err := m.FindDeadLetterByID(ctx, id)
+	if err != nil {
+		return fmt.Errorf("error retrieving dead letter %s: %w", id, err)
+	}
+
+	now := time.Now()
+
+	wh.Attempts = 0
+	wh.LastError = ""
+	wh.Enqueued = now
+	wh.NextAttempt = now
+	wh.DeadLettered = time.Time{}
+
+	opts := options.Replace().SetUpsert(true)
+	if _, err := m.queue.ReplaceOne(ctx, bson.M{"_id": wh.ID}, wh, opts); err != nil {
+		return err
+	}
+
+	_, err = m.deadLetters.DeleteOne(ctx, bson.M{"_id": id})
+	return err
+}
@@ -1,8 +1,17 @@
 package proxy
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
 	"net/url"
+	"strings"
+	"text/template"
+
+	"github.com/mittwald/mstudio-ext-proxy/pkg/domain/model"
 )
 
 type jsonURL url.URL
@@ -22,9 +31,183 @@ func (j *jsonURL) UnmarshalJSON(bytes []byte) error {
 	return nil
 }
 
+// urlTemplate is an upstream URL that may contain template actions, which are
+// evaluated against the current session (for example,
+// "http://tenant-{{.Instance.Context.ID}}:3000").
+type urlTemplate struct {
+	tmpl *template.Template
+}
+
+func (u *urlTemplate) UnmarshalJSON(bytes []byte) error {
+	tmplStr := ""
+	if err := json.Unmarshal(bytes, &tmplStr); err != nil {
+		return err
+	}
+
+	if tmplStr == "" {
+		return errors.New("upstream URL must not be empty")
+	}
+
+	tmpl, err := template.New("upstreamURL").Option("missingkey=error").Parse(tmplStr)
+	if err != nil {
+		return fmt.Errorf("invalid upstream URL template: %w", err)
+	}
+
+	u.tmpl = tmpl
+	return nil
+}
+
+func (u *urlTemplate) Execute(session *model.Session) (*url.URL, error) {
+	if u.tmpl == nil {
+		return nil, fmt.Errorf("no upstream URL configured")
+	}
+
+	out := strings.Builder{}
+	if err := u.tmpl.Execute(&out, session); err != nil {
+		return nil, fmt.Errorf("error rendering upstream URL: %w", err)
+	}
+
+	parsed, err := url.Parse(out.String())
+	if err != nil {
+		return nil, fmt.Errorf("invalid upstream URL '%s': %w", out.String(), err)
+	}
+
+	if (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return nil, fmt.Errorf("invalid upstream URL '%s': expected an absolute HTTP(S) URL", out.String())
+	}
+
+	return parsed, nil
+}
+
+// RouteRule selects an upstream for sessions of specific extension instances
+// or contexts. All non-empty criteria need to match.
+type RouteRule struct {
+	InstanceID  string      `json:"instanceId"`
+	ContextID   string      `json:"contextId"`
+	ContextKind string      `json:"contextKind"`
+	UpstreamURL urlTemplate `json:"upstreamURL"`
+}
+
+// UnmarshalJSON decodes a rule, and rejects rules without an upstream URL.
+func (r *RouteRule) UnmarshalJSON(bytes []byte) error {
+	type plainRouteRule RouteRule
+	if err := json.Unmarshal(bytes, (*plainRouteRule)(r)); err != nil {
+		return err
+	}
+
+	if r.UpstreamURL.tmpl == nil {
+		return errors.New("route has no upstreamURL")
+	}
+
+	return nil
+}
+
+func (r *RouteRule) Matches(session *model.Session) bool {
+	if r.InstanceID != "" && r.InstanceID != session.Instance.ID {
+		return false
+	}
+
+	if r.ContextID != "" && r.ContextID != session.Instance.Context.ID {
+		return false
+	}
+
+	if r.ContextKind != "" && r.ContextKind != session.Instance.Context.Kind {
+		return false
+	}
+
+	return true
+}
+
 type Configuration struct {
 	UpstreamURL jsonURL
 	StripPrefix string
+
+	// Routes are evaluated in order; the first matching rule determines the
+	// upstream. If no rule matches, UpstreamURL is used.
+	Routes []RouteRule
+
+	// HealthCheckPath optionally enables a readiness check for this upstream;
+	// GET requests to this path of UpstreamURL (and of the upstreams selected
+	// by Routes) need to succeed.
+	HealthCheckPath string
+
+	// HealthCheckCritical makes the proxy unready if the health check fails;
+	// otherwise, a failing upstream is only reported as degraded.
+	HealthCheckCritical bool
+}
+
+// CheckHealth sends a GET request to the health check path of UpstreamURL, and
+// returns an error if the upstream is unreachable or responds with an error
+// status.
+func (c *Configuration) CheckHealth(ctx context.Context, client *http.Client) error {
+	return c.checkHealthAt(ctx, client, url.URL(c.UpstreamURL))
+}
+
+// CheckRouteHealth checks the upstreams that Routes select for the given
+// instances (excluding UpstreamURL, which is checked by CheckHealth). Since
+// upstream URLs may be templates, they can only be determined for known
+// instances.
+func (c *Configuration) CheckRouteHealth(ctx context.Context, client *http.Client, instances []model.ExtensionInstance) error {
+	defaultURL := url.URL(c.UpstreamURL)
+	checked := map[string]bool{defaultURL.String(): true}
+
+	var errs []error
+
+	for _, instance := range instances {
+		u, err := c.UpstreamURLForSession(&model.Session{Instance: instance})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("instance %s: %w", instance.ID, err))
+			continue
+		}
+
+		if checked[u.String()] {
+			continue
+		}
+
+		checked[u.String()] = true
+
+		if err := c.checkHealthAt(ctx, client, *u); err != nil {
+			errs = append(errs, fmt.Errorf("upstream %s: %w", u.Host, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (c *Configuration) checkHealthAt(ctx context.Context, client *http.Client, u url.URL) error {
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + strings.TrimPrefix(c.HealthCheckPath, "/")
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return err
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer res.Body.Close()
+	_, _ = io.Copy(io.Discard, res.Body)
+
+	if res.StatusCode >= 400 {
+		return fmt.Errorf("upstream responded with status %d", res.StatusCode)
+	}
+
+	return nil
+}
+
+// UpstreamURLForSession returns the upstream URL that requests of the given
+// session should be proxied to.
+func (c *Configuration) UpstreamURLForSession(session *model.Session) (*url.URL, error) {
+	for i := range c.Routes {
+		if c.Routes[i].Matches(session) {
+			return c.Routes[i].UpstreamURL.Execute(session)
+		}
+	}
+
+	u := url.URL(c.UpstreamURL)
+	return &u, nil
 }
 
 type ConfigurationCollection map[string]Configuration
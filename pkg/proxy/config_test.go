@@ -0,0 +1,143 @@
+package proxy_test
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/mittwald/mstudio-ext-proxy/pkg/domain/model"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/proxy"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Configuration", func() {
+	var config proxy.Configuration
+
+	sessionFor := func(instanceID, contextID, contextKind string) *model.Session {
+		return &model.Session{Instance: model.ExtensionInstance{
+			ID:      instanceID,
+			Context: model.ExtensionInstanceContext{ID: contextID, Kind: contextKind},
+		}}
+	}
+
+	BeforeEach(func() {
+		cc := proxy.ConfigurationCollection{}
+		Expect(cc.Decode(`{"/": {
+			"upstreamURL": "http://default:3000",
+			"routes": [
+				{"instanceId": "big-instance", "upstreamURL": "http://big-customer:3000"},
+				{"contextKind": "project", "contextId": "p-1", "upstreamURL": "http://tenant-{{.Instance.Context.ID}}:3000"},
+				{"contextKind": "customer", "upstreamURL": "https://customers.internal"}
+			]
+		}}`)).To(Succeed())
+
+		config = cc["/"]
+	})
+
+	It("should route by instance ID", func() {
+		u, err := config.UpstreamURLForSession(sessionFor("big-instance", "p-1", "project"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(u.String()).To(Equal("http://big-customer:3000"))
+	})
+
+	It("should render URL templates", func() {
+		u, err := config.UpstreamURLForSession(sessionFor("other", "p-1", "project"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(u.String()).To(Equal("http://tenant-p-1:3000"))
+	})
+
+	It("should require all criteria of a rule to match", func() {
+		u, err := config.UpstreamURLForSession(sessionFor("other", "p-2", "project"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(u.String()).To(Equal("http://default:3000"))
+	})
+
+	It("should route by context kind", func() {
+		u, err := config.UpstreamURLForSession(sessionFor("other", "c-1", "customer"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(u.String()).To(Equal("https://customers.internal"))
+	})
+
+	It("should reject templates that do not render to an absolute URL", func() {
+		cc := proxy.ConfigurationCollection{}
+		Expect(cc.Decode(`{"/": {"routes": [{"upstreamURL": "{{.Instance.Context.ID}}"}]}}`)).To(Succeed())
+
+		c := cc["/"]
+		_, err := c.UpstreamURLForSession(sessionFor("other", "p-1", "project"))
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should reject routes without an upstream URL", func() {
+		cc := proxy.ConfigurationCollection{}
+		Expect(cc.Decode(`{"/": {"upstreamURL": "http://default:3000", "routes": [{"instanceId": "big-instance"}]}}`)).To(MatchError(ContainSubstring("upstreamURL")))
+		Expect(cc.Decode(`{"/": {"upstreamURL": "http://default:3000", "routes": [{"instanceId": "big-instance", "upstreamURL": ""}]}}`)).To(MatchError(ContainSubstring("upstream URL")))
+	})
+
+	Describe("CheckHealth", func() {
+		var status int
+		var path string
+
+		BeforeEach(func() {
+			upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				path = r.URL.Path
+				w.WriteHeader(status)
+			}))
+			DeferCleanup(upstream.Close)
+
+			cc := proxy.ConfigurationCollection{}
+			Expect(cc.Decode(fmt.Sprintf(`{"/": {"upstreamURL": "%s/app/", "healthCheckPath": "/healthz"}}`, upstream.URL))).To(Succeed())
+
+			config = cc["/"]
+		})
+
+		It("should succeed if the upstream is healthy", func(ctx context.Context) {
+			status = http.StatusOK
+
+			Expect(config.CheckHealth(ctx, http.DefaultClient)).To(Succeed())
+			Expect(path).To(Equal("/app/healthz"))
+		})
+
+		It("should fail if the upstream responds with an error", func(ctx context.Context) {
+			status = http.StatusServiceUnavailable
+
+			Expect(config.CheckHealth(ctx, http.DefaultClient)).To(MatchError(ContainSubstring("503")))
+		})
+	})
+
+	Describe("CheckRouteHealth", func() {
+		var tenantPort string
+
+		BeforeEach(func() {
+			tenant := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}))
+			DeferCleanup(tenant.Close)
+
+			_, tenantPort, _ = net.SplitHostPort(tenant.Listener.Addr().String())
+
+			cc := proxy.ConfigurationCollection{}
+			Expect(cc.Decode(`{"/": {
+				"upstreamURL": "http://default.invalid",
+				"healthCheckPath": "/healthz",
+				"routes": [{"contextKind": "project", "upstreamURL": "http://127.0.0.1:{{.Instance.Context.ID}}"}]
+			}}`)).To(Succeed())
+
+			config = cc["/"]
+		})
+
+		It("should check the upstreams of templated routes", func(ctx context.Context) {
+			instances := []model.ExtensionInstance{sessionFor("instance", tenantPort, "project").Instance}
+
+			Expect(config.CheckRouteHealth(ctx, http.DefaultClient, instances)).To(MatchError(ContainSubstring("503")))
+		})
+
+		It("should not check the default upstream", func(ctx context.Context) {
+			instances := []model.ExtensionInstance{sessionFor("instance", "c-1", "customer").Instance}
+
+			Expect(config.CheckRouteHealth(ctx, http.DefaultClient, instances)).To(Succeed())
+		})
+	})
+})
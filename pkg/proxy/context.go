@@ -0,0 +1,22 @@
+package proxy
+
+import (
+	"context"
+
+	"github.com/mittwald/mstudio-ext-proxy/pkg/domain/model"
+)
+
+type sessionContextKey struct{}
+
+// ContextWithSession returns a copy of the context that carries the session of
+// an authenticated request.
+func ContextWithSession(ctx context.Context, session *model.Session) context.Context {
+	return context.WithValue(ctx, sessionContextKey{}, session)
+}
+
+// SessionFromContext returns the session of an authenticated request. This is
+// only available in handlers that are wrapped by a Handler with Next set.
+func SessionFromContext(ctx context.Context) (*model.Session, bool) {
+	session, ok := ctx.Value(sessionContextKey{}).(*model.Session)
+	return session, ok
+}
@@ -3,10 +3,13 @@ package proxy
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
+	"net/url"
 	"strings"
+	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/mittwald/mstudio-ext-proxy/pkg/authentication"
@@ -15,23 +18,46 @@ import (
 	"github.com/mittwald/mstudio-ext-proxy/pkg/domain/repository"
 	"github.com/mittwald/mstudio-ext-proxy/pkg/domain/service"
 	"github.com/mittwald/mstudio-ext-proxy/pkg/httperr"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/middleware"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/tracing"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type Handler struct {
 	Configuration             Configuration
 	SessionRepository         repository.SessionRepository
 	SessionService            service.SessionService
+	APIKeyService             service.APIKeyService
 	AuthenticationOptions     authentication.Options
 	Logger                    *slog.Logger
 	HTTPClient                *http.Client
 	RedirectOnUnauthenticated string
+
+	// Timeout, if set, limits the time for proxying a request, including
+	// reading the request body and writing the response. The server's read
+	// and write timeouts do not apply to proxied requests, so that streaming
+	// responses, long polling and slow uploads are not cut off.
+	Timeout time.Duration
+
+	// Next optionally turns the handler into a middleware: authenticated
+	// requests are passed to Next (with the session in the request context and
+	// the X-Mstudio-User header set) instead of being proxied to the upstream.
+	Next http.Handler
 }
 
 func (h *Handler) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	// Only proxy-issued API keys are consumed here; other bearer tokens are
+	// meant for the upstream application, so they are passed through and the
+	// request is authenticated with the session cookie instead.
+	if bearerToken, ok := bearerTokenFromRequest(request); ok && h.APIKeyService != nil && model.IsAPIKeyTokenString(bearerToken) {
+		h.serveWithBearerToken(writer, request, bearerToken)
+		return
+	}
+
 	authCookie, err := request.Cookie(h.AuthenticationOptions.CookieName)
 	if err != nil {
 		if errors.Is(err, http.ErrNoCookie) {
-			h.respondUnauthorized(writer)
+			h.respondUnauthorized(writer, request)
 			return
 		}
 	}
@@ -39,24 +65,94 @@ func (h *Handler) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
 	sessionID, sessionSecret := model.SessionIDAndSecretFromCookieString(authCookie.Value)
 	session, err := h.SessionService.RetrieveSession(request.Context(), sessionID, sessionSecret)
 	if err != nil {
-		h.responseError(writer, httperr.StatusForError(err), "error retrieving session", err)
+		h.responseError(writer, request, httperr.StatusForError(err), "error retrieving session", err)
+		return
+	}
+
+	h.serveWithSession(writer, request, session)
+}
+
+// serveWithBearerToken handles requests from non-browser clients, which
+// authenticate using an API key in an "Authorization: Bearer" header instead of
+// a session cookie. The authorization header is consumed by the proxy and not
+// passed to the upstream.
+func (h *Handler) serveWithBearerToken(writer http.ResponseWriter, request *http.Request, token string) {
+	ctx, span := tracing.Start(request.Context(), "proxy.AuthenticateAPIKey")
+	session, err := h.APIKeyService.AuthenticateAPIKey(ctx, token)
+	tracing.End(span, err)
+	if err != nil {
+		h.responseError(writer, request, httperr.StatusForError(err), "error authenticating API key", err)
 		return
 	}
 
+	request.Header.Del("Authorization")
+
+	h.serveWithSession(writer, request, session)
+}
+
+func (h *Handler) serveWithSession(writer http.ResponseWriter, request *http.Request, session *model.Session) {
+	// Sessions (and API keys) are bound to an instance of one extension, and
+	// must never authorize requests to upstreams of another extension.
+	if !h.AuthenticationOptions.AllowsExtension(session.Instance.ExtensionID) {
+		h.responseError(writer, request, http.StatusForbidden, "forbidden", fmt.Errorf("session belongs to another extension"))
+		return
+	}
+
+	trace.SpanFromContext(request.Context()).SetAttributes(
+		tracing.AttrUserID.String(session.UserID),
+		tracing.AttrInstanceID.String(session.Instance.ID),
+	)
+	middleware.AccessLogEntryFromContext(request.Context()).SetUser(session.UserID, session.Instance.ID)
+
+	_, jwtSpan := tracing.Start(request.Context(), "proxy.SignJWT")
 	token, err := h.buildUserJWT(session)
+	tracing.End(jwtSpan, err)
 	if err != nil {
-		h.responseError(writer, http.StatusInternalServerError, "internal server error", err)
+		h.responseError(writer, request, http.StatusInternalServerError, "internal server error", err)
 		return
 	}
 
-	proxyRequest := h.buildProxyRequest(request, token)
+	if h.Next != nil {
+		request = request.WithContext(ContextWithSession(request.Context(), session))
+		request.Header.Set("X-Mstudio-User", token)
+		h.Next.ServeHTTP(writer, request)
+		return
+	}
+
+	upstreamURL, err := h.Configuration.UpstreamURLForSession(session)
+	if err != nil {
+		h.responseError(writer, request, http.StatusBadGateway, "bad gateway", err)
+		return
+	}
+
+	h.resetDeadlines(writer)
+
+	proxyRequest := h.buildProxyRequest(request, upstreamURL, token)
+
+	span := tracing.StartClientSpan(proxyRequest)
 	proxyResponse, err := h.HTTPClient.Do(proxyRequest)
+	tracing.EndClientSpan(span, proxyResponse, err)
 	if err != nil {
-		h.responseError(writer, http.StatusBadGateway, "bad gateway", err)
+		h.responseError(writer, request, http.StatusBadGateway, "bad gateway", err)
 		return
 	}
 
-	h.copyProxyResponse(writer, proxyResponse)
+	h.copyProxyResponse(writer, request, proxyResponse)
+}
+
+// resetDeadlines replaces the server's read and write deadlines (which are
+// meant for short requests) with the proxy timeout, or removes them.
+func (h *Handler) resetDeadlines(writer http.ResponseWriter) {
+	deadline := time.Time{}
+	if h.Timeout > 0 {
+		deadline = time.Now().Add(h.Timeout)
+	}
+
+	// Not all response writers support deadlines; in that case, the server's
+	// timeouts (if any) still apply.
+	rc := http.NewResponseController(writer)
+	_ = rc.SetReadDeadline(deadline)
+	_ = rc.SetWriteDeadline(deadline)
 }
 
 func (h *Handler) buildUserJWT(session *model.Session) (string, error) {
@@ -69,23 +165,35 @@ func (h *Handler) buildUserJWT(session *model.Session) (string, error) {
 	return tokenStr, nil
 }
 
-func (h *Handler) buildProxyRequest(request *http.Request, tokenStr string) *http.Request {
-	proxyRequestURL := h.buildProxyRequestURL(request)
-
-	l := h.Logger.With("req.url", request.URL.String(), "upstream.url", proxyRequestURL)
-	l.Debug("proxying request")
+func (h *Handler) buildProxyRequest(request *http.Request, upstreamURL *url.URL, tokenStr string) *http.Request {
+	proxyRequestURL := h.buildProxyRequestURL(request, upstreamURL)
 
-	proxyRequest, _ := http.NewRequest(request.Method, proxyRequestURL, request.Body)
-	proxyRequest.Header.Set("X-Mstudio-User", tokenStr)
+	proxyRequest, _ := http.NewRequestWithContext(request.Context(), request.Method, proxyRequestURL, request.Body)
 	copyHeaders(request.Header, proxyRequest.Header)
+	h.removeSessionCookie(proxyRequest)
+	proxyRequest.Header.Set("X-Mstudio-User", tokenStr)
 	return proxyRequest
 }
 
-func (h *Handler) buildProxyRequestURL(request *http.Request) string {
+// removeSessionCookie removes the proxy's session cookie from a request, so
+// that the upstream cannot use (or leak) the session; all other cookies are
+// passed on.
+func (h *Handler) removeSessionCookie(request *http.Request) {
+	cookies := request.Cookies()
+	request.Header.Del("Cookie")
+
+	for _, cookie := range cookies {
+		if cookie.Name != h.AuthenticationOptions.CookieName {
+			request.AddCookie(cookie)
+		}
+	}
+}
+
+func (h *Handler) buildProxyRequestURL(request *http.Request, upstreamURL *url.URL) string {
 	proxyRequestURL := *request.URL
-	proxyRequestURL.Host = h.Configuration.UpstreamURL.Host
-	proxyRequestURL.Scheme = h.Configuration.UpstreamURL.Scheme
-	proxyRequestURL.User = h.Configuration.UpstreamURL.User
+	proxyRequestURL.Host = upstreamURL.Host
+	proxyRequestURL.Scheme = upstreamURL.Scheme
+	proxyRequestURL.User = upstreamURL.User
 
 	if h.Configuration.StripPrefix != "" {
 		proxyRequestURL.Path = strings.TrimPrefix(proxyRequestURL.Path, h.Configuration.StripPrefix)
@@ -94,31 +202,34 @@ func (h *Handler) buildProxyRequestURL(request *http.Request) string {
 	return proxyRequestURL.String()
 }
 
-func (h *Handler) copyProxyResponse(writer http.ResponseWriter, proxyResponse *http.Response) {
-	l := h.Logger.With("res.status", proxyResponse.StatusCode)
-	l.Debug("proxy response")
-
+func (h *Handler) copyProxyResponse(writer http.ResponseWriter, request *http.Request, proxyResponse *http.Response) {
+	// The request ID was already set by the middleware, and must not be
+	// duplicated if the upstream echoes it.
+	proxyResponse.Header.Del(middleware.RequestIDHeader)
 	copyHeaders(proxyResponse.Header, writer.Header())
 
 	writer.WriteHeader(proxyResponse.StatusCode)
 	if err := h.copyProxyResponseBody(proxyResponse.Body, writer); err != nil {
-		h.Logger.Warn("error while copying proxy response", "err", err)
+		h.Logger.WarnContext(request.Context(), "error while copying proxy response", "err", err)
 	}
 }
 
-func (h *Handler) copyProxyResponseBody(proxyResponse io.Reader, writer io.Writer) error {
+func (h *Handler) copyProxyResponseBody(proxyResponse io.Reader, writer http.ResponseWriter) error {
 	return h.copyBodyWithFlush(proxyResponse, writer)
 }
 
-func (h *Handler) responseError(writer http.ResponseWriter, code int, msg string, err error) {
+func (h *Handler) responseError(writer http.ResponseWriter, request *http.Request, code int, msg string, err error) {
+	resp := controller.ErrorResponseFromErr(msg, err)
+	resp.RequestID = middleware.RequestIDFromContext(request.Context())
+
 	writer.Header().Set("Content-Type", "application/json")
 	writer.WriteHeader(code)
-	_ = json.NewEncoder(writer).Encode(controller.ErrorResponseFromErr(msg, err))
+	_ = json.NewEncoder(writer).Encode(resp)
 }
 
-func (h *Handler) respondUnauthorized(writer http.ResponseWriter) {
-	if h.AuthenticationOptions.StaticPassword != "" {
-		writer.Header().Set("Location", "/mstudio/auth/password")
+func (h *Handler) respondUnauthorized(writer http.ResponseWriter, request *http.Request) {
+	if h.AuthenticationOptions.PasswordAuthenticationEnabled() {
+		writer.Header().Set("Location", h.AuthenticationOptions.BasePath+"/auth/password")
 		writer.WriteHeader(http.StatusSeeOther)
 		return
 	}
@@ -131,7 +242,19 @@ func (h *Handler) respondUnauthorized(writer http.ResponseWriter) {
 
 	writer.Header().Set("Content-Type", "application/json")
 	writer.WriteHeader(http.StatusUnauthorized)
-	_ = json.NewEncoder(writer).Encode(controller.ErrorResponse{Message: "unauthorized"})
+	_ = json.NewEncoder(writer).Encode(controller.ErrorResponse{
+		Message:   "unauthorized",
+		RequestID: middleware.RequestIDFromContext(request.Context()),
+	})
+}
+
+func bearerTokenFromRequest(request *http.Request) (string, bool) {
+	header := request.Header.Get("Authorization")
+	if len(header) < 7 || !strings.EqualFold(header[:7], "bearer ") {
+		return "", false
+	}
+
+	return strings.TrimSpace(header[7:]), true
 }
 
 func copyHeaders(source, target http.Header) {
@@ -142,7 +265,7 @@ func copyHeaders(source, target http.Header) {
 	}
 }
 
-func (h *Handler) copyBodyWithFlush(source io.Reader, target io.Writer) error {
+func (h *Handler) copyBodyWithFlush(source io.Reader, target http.ResponseWriter) error {
 	flusher, ok := target.(http.Flusher)
 	if !ok {
 		h.Logger.Warn("response writer does not support flushing")
@@ -0,0 +1,82 @@
+package server
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+
+	"github.com/mittwald/mstudio-ext-proxy/pkg/bootstrap"
+)
+
+// Hook is a function that is run when the server is started or stopped.
+type Hook func(ctx context.Context) error
+
+type options struct {
+	config       *bootstrap.Config
+	repositories *bootstrap.Repositories
+	logger       *slog.Logger
+	httpClient   *http.Client
+	accessLog    io.Writer
+	onStart      []Hook
+	onStop       []Hook
+}
+
+// Option configures a Server.
+type Option func(*options)
+
+// WithConfig sets the configuration of the server. This option is required;
+// use bootstrap.ConfigFromEnv to read the configuration from the environment.
+func WithConfig(c *bootstrap.Config) Option {
+	return func(o *options) {
+		o.config = c
+	}
+}
+
+// WithRepositories sets the persistence backends. This option is required;
+// see bootstrap.BuildMongoRepositories and bootstrap.BuildMemoryRepositories.
+func WithRepositories(r bootstrap.Repositories) Option {
+	return func(o *options) {
+		o.repositories = &r
+	}
+}
+
+// WithLogger sets the logger; by default, slog.Default() is used.
+func WithLogger(l *slog.Logger) Option {
+	return func(o *options) {
+		o.logger = l
+	}
+}
+
+// WithHTTPClient sets the HTTP client used for requests to the upstreams; by
+// default, http.DefaultClient is used.
+func WithHTTPClient(c *http.Client) Option {
+	return func(o *options) {
+		o.httpClient = c
+	}
+}
+
+// WithAccessLogOutput sets the writer for the access log; by default, it is
+// written to os.Stdout. The format is configured using
+// MITTWALD_EXT_PROXY_ACCESS_LOG_FORMAT.
+func WithAccessLogOutput(w io.Writer) Option {
+	return func(o *options) {
+		o.accessLog = w
+	}
+}
+
+// WithOnStart registers a hook that is run by Server.Start, before the
+// background workers are started. Hooks are run in the order of registration.
+func WithOnStart(h Hook) Option {
+	return func(o *options) {
+		o.onStart = append(o.onStart, h)
+	}
+}
+
+// WithOnStop registers a hook that is run by Server.Stop, after the background
+// workers have stopped. Hooks are run in reverse order of registration.
+func WithOnStop(h Hook) Option {
+	return func(o *options) {
+		o.onStop = append(o.onStop, h)
+	}
+}
@@ -0,0 +1,162 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+)
+
+// Ready reports whether the server has been started and is not shutting down.
+func (s *Server) Ready() bool {
+	return s.ready.Load() && !s.draining.Load()
+}
+
+// Drain marks the server as unready, and asks clients to close their
+// keep-alive connections after the current request. It is called by Serve
+// before shutting down; when embedding the server into an own http.Server,
+// call it before http.Server.Shutdown.
+func (s *Server) Drain() {
+	s.draining.Store(true)
+}
+
+func (s *Server) checkReady(context.Context) error {
+	if s.draining.Load() {
+		return errors.New("server is shutting down")
+	}
+
+	if !s.ready.Load() {
+		return errors.New("server is not started")
+	}
+
+	return nil
+}
+
+func (s *Server) closeWhenDraining(w http.ResponseWriter) {
+	if s.draining.Load() {
+		w.Header().Set("Connection", "close")
+	}
+}
+
+// ListenAndServe listens on the given TCP address and then calls Serve.
+func (s *Server) ListenAndServe(ctx context.Context, addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	return s.Serve(ctx, l)
+}
+
+// Serve starts the server (see Start) and serves HTTP requests on the given
+// listener (and the admin listener, if configured) until ctx is cancelled. It
+// then shuts down gracefully: the server is marked as unready, and after the
+// configured shutdown delay, the listeners are closed and in-flight requests
+// are given the configured shutdown timeout to complete. Finally, the server is
+// stopped (see Stop).
+func (s *Server) Serve(ctx context.Context, l net.Listener) error {
+	listeners := []net.Listener{l}
+	servers := []*http.Server{s.newHTTPServer(s)}
+
+	if addr := s.options.config.Admin.Addr; addr != "" {
+		adminListener, err := net.Listen("tcp", addr)
+		if err != nil {
+			_ = l.Close()
+			return fmt.Errorf("error listening on admin address: %w", err)
+		}
+
+		listeners = append(listeners, adminListener)
+		servers = append(servers, s.newHTTPServer(s.adminHandler))
+	}
+
+	if err := s.Start(ctx); err != nil {
+		for _, l := range listeners {
+			_ = l.Close()
+		}
+		return err
+	}
+
+	serveErr := make(chan error, len(servers))
+
+	for i, hs := range servers {
+		go func() {
+			serveErr <- hs.Serve(listeners[i])
+		}()
+
+		s.options.logger.Info("listening", "server.addr", listeners[i].Addr().String())
+	}
+
+	var errs []error
+
+	select {
+	case err := <-serveErr:
+		errs = append(errs, fmt.Errorf("error serving HTTP: %w", err))
+	case <-ctx.Done():
+	}
+
+	if err := s.shutdown(ctx, servers); err != nil {
+		errs = append(errs, err)
+	}
+
+	stopCtx, cancel := s.shutdownContext(ctx)
+	defer cancel()
+
+	if err := s.Stop(stopCtx); err != nil {
+		errs = append(errs, err)
+	}
+
+	return errors.Join(errs...)
+}
+
+func (s *Server) newHTTPServer(handler http.Handler) *http.Server {
+	c := s.options.config.Server
+
+	return &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: c.ReadHeaderTimeout,
+		ReadTimeout:       c.ReadTimeout,
+		WriteTimeout:      c.WriteTimeout,
+		IdleTimeout:       c.IdleTimeout,
+		ErrorLog:          slog.NewLogLogger(s.options.logger.Handler(), slog.LevelWarn),
+	}
+}
+
+func (s *Server) shutdown(ctx context.Context, servers []*http.Server) error {
+	c := s.options.config.Server
+
+	s.Drain()
+	s.options.logger.Info("shutting down", "shutdown.delay", c.ShutdownDelay, "shutdown.timeout", c.ShutdownTimeout)
+
+	// Give load balancers the chance to notice that we are unready before the
+	// listeners are closed.
+	time.Sleep(c.ShutdownDelay)
+
+	shutdownCtx, cancel := s.shutdownContext(ctx)
+	defer cancel()
+
+	var errs []error
+
+	for _, hs := range servers {
+		if err := hs.Shutdown(shutdownCtx); err != nil {
+			_ = hs.Close()
+			errs = append(errs, fmt.Errorf("error draining connections: %w", err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// shutdownContext derives a context for shutting down from the (already
+// cancelled) ctx, which is limited to the configured shutdown timeout.
+func (s *Server) shutdownContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx = context.WithoutCancel(ctx)
+
+	if t := s.options.config.Server.ShutdownTimeout; t > 0 {
+		return context.WithTimeout(ctx, t)
+	}
+
+	return context.WithCancel(ctx)
+}
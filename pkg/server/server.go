@@ -0,0 +1,469 @@
+// Package server wires up the mStudio extension proxy. Besides running it as a
+// standalone proxy, a Server can be embedded into other Go services, either as
+// a complete http.Handler or as a middleware that authenticates requests to
+// the service's own handlers.
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/bootstrap"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/controller"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/domain/model"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/domain/service"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/health"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/metrics"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/middleware"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/proxy"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/tracing"
+	"github.com/mittwald/mstudio-ext-proxy/templates"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var ErrUnknownExtension = errors.New("unknown extension")
+
+// Server serves the mStudio endpoints (below "/mstudio/") and the configured
+// upstreams, and runs the background workers.
+type Server struct {
+	options options
+
+	handler       http.Handler
+	accessLogger  *middleware.AccessLogger
+	mstudioRouter http.Handler
+	adminHandler  http.Handler
+	extensions    map[string]bootstrap.Extension
+
+	sessionService  service.SessionService
+	apiKeyService   service.APIKeyService
+	webhookWorker   *service.WebhookWorker
+	reconciler      *service.InstanceReconciler
+	eventDispatcher *service.EventDispatcher
+
+	lock          sync.Mutex
+	cancelWorkers context.CancelFunc
+	workers       sync.WaitGroup
+	ready         atomic.Bool
+	draining      atomic.Bool
+}
+
+// New builds a new Server. The WithConfig and WithRepositories options are
+// required.
+func New(opts ...Option) (*Server, error) {
+	o := options{
+		logger:     slog.Default(),
+		httpClient: http.DefaultClient,
+		accessLog:  os.Stdout,
+	}
+
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	if o.config == nil {
+		return nil, errors.New("no configuration given")
+	}
+
+	if o.repositories == nil {
+		return nil, errors.New("no repositories given")
+	}
+
+	o.logger = slog.New(middleware.NewRequestIDLogHandler(o.logger.Handler()))
+
+	s := Server{
+		options:    o,
+		extensions: make(map[string]bootstrap.Extension),
+	}
+
+	if err := s.build(); err != nil {
+		return nil, err
+	}
+
+	return &s, nil
+}
+
+func (s *Server) build() error {
+	c, repos, logger := s.options.config, s.options.repositories, s.options.logger
+
+	mittwaldClient, err := bootstrap.BuildMittwaldAPIClientFromConfig(c, logger)
+	if err != nil {
+		return fmt.Errorf("error building mittwald API client: %w", err)
+	}
+
+	authOptions, err := bootstrap.BuildAuthenticationOptions(c)
+	if err != nil {
+		return err
+	}
+
+	extensions, err := bootstrap.BuildExtensions(c, authOptions)
+	if err != nil {
+		return err
+	}
+
+	s.sessionService = service.NewSessionService(mittwaldClient, repos.Sessions, repos.Instances, bootstrap.BuildMittwaldAPIClientOptions(c, logger)...)
+	s.apiKeyService = service.NewAPIKeyService(repos.APIKeys, repos.Instances)
+
+	loginThrottleService := bootstrap.BuildLoginThrottleService(c, repos.LoginAttempts)
+	eventPublisher := service.NewEventPublisher(repos.Outbox, c.Events.Targets)
+	webhookService := service.NewWebhookService(repos.Instances, repos.WebhookDeliveries, eventPublisher)
+	webhookQueueService := service.NewWebhookQueueService(repos.WebhookQueue, repos.WebhookDeliveries, c.Webhooks.RedeliveryWindow)
+
+	webhookVerifier, err := bootstrap.BuildWebhookVerifier(c, mittwaldClient, logger)
+	if err != nil {
+		return fmt.Errorf("error building webhook verifier: %w", err)
+	}
+
+	s.accessLogger, err = bootstrap.BuildAccessLogger(c, s.options.accessLog)
+	if err != nil {
+		return fmt.Errorf("error building access logger: %w", err)
+	}
+
+	tmpl, err := templates.Parse()
+	if err != nil {
+		return fmt.Errorf("error parsing templates: %w", err)
+	}
+
+	checker := health.Checker{}
+	checker.Add(health.Check{Name: "server", Critical: true, Func: s.checkReady})
+	checker.Add(bootstrap.BuildHealthChecks(c, *repos, extensions, webhookVerifier.KeyProvider, s.options.httpClient)...)
+
+	healthCtrl := controller.HealthController{
+		Checker: &checker,
+		Logger:  logger,
+	}
+	adminHealthCtrl := controller.HealthController{
+		Checker:  &checker,
+		Logger:   logger,
+		Detailed: true,
+	}
+
+	r := gin.New()
+	r.SetHTMLTemplate(tmpl)
+
+	// Without trusted proxies, gin would take the client IP from any
+	// X-Forwarded-For header, which would allow clients to bypass the login
+	// throttling.
+	if err := r.SetTrustedProxies(c.Server.TrustedProxies); err != nil {
+		return fmt.Errorf("error configuring trusted proxies: %w", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/mstudio/", r)
+
+	rm := r.Group("/mstudio")
+	rm.GET("/healthz", healthCtrl.HandleLiveness)
+	rm.GET("/readyz", healthCtrl.HandleReadiness)
+
+	// The active sessions are collected per server, since they depend on the
+	// server's repositories; all other metrics are registered globally.
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(metrics.NewActiveSessionsCollector(repos.Sessions))
+	gatherers := prometheus.Gatherers{prometheus.DefaultGatherer, registry}
+
+	admin := gin.New()
+	admin.GET("/healthz", adminHealthCtrl.HandleLiveness)
+	admin.GET("/readyz", adminHealthCtrl.HandleReadiness)
+	admin.GET("/metrics", gin.WrapH(promhttp.HandlerFor(gatherers, promhttp.HandlerOpts{})))
+
+	for _, extension := range extensions {
+		extAuthOptions := extension.AuthenticationOptions
+
+		webhookCtrl := controller.WebhookController{
+			WebhookQueueService: webhookQueueService,
+			WebhookVerifier:     webhookVerifier,
+			Allowlist:           extension.Allowlist,
+			Logger:              logger,
+		}
+		authCtrl := controller.UserAuthenticationController{
+			Client:                mittwaldClient,
+			SessionRepository:     repos.Sessions,
+			SessionService:        s.sessionService,
+			InstanceRepository:    repos.Instances,
+			LoginThrottleService:  loginThrottleService,
+			Development:           c.Context == "dev",
+			AuthenticationOptions: extAuthOptions,
+			Logger:                logger,
+		}
+		apiKeyCtrl := controller.APIKeyController{
+			SessionService:        s.sessionService,
+			APIKeyService:         s.apiKeyService,
+			AuthenticationOptions: extAuthOptions,
+			Logger:                logger,
+		}
+
+		re := rm
+		if extension.Name != "" {
+			re = rm.Group("/" + extension.Name)
+		}
+
+		re.POST("/webhooks", webhookCtrl.HandleWebhookRequest)
+		re.GET("/auth/oneclick", authCtrl.HandleAuthenticationRequest)
+		re.GET("/auth/fake", authCtrl.HandleFakeAuthentication)
+		re.GET("/auth/current", authCtrl.HandleUserInfo)
+		re.GET("/auth/keys", apiKeyCtrl.HandleList)
+		re.POST("/auth/keys", apiKeyCtrl.HandleCreate)
+		re.DELETE("/auth/keys/:id", apiKeyCtrl.HandleRevoke)
+
+		if extAuthOptions.PasswordAuthenticationEnabled() {
+			re.Any("/auth/password", authCtrl.HandlePasswordAuthentication)
+		}
+
+		// Additional authentication providers are only available for a single
+		// extension; BuildExtensions rejects them otherwise.
+		if extension.Name == "" {
+			authProviders, err := bootstrap.BuildAuthenticationProviders(c, repos.Sessions, repos.Instances, extAuthOptions, logger)
+			if err != nil {
+				return err
+			}
+
+			controller.RegisterAuthenticationProviders(re, authProviders...)
+		}
+
+		for prefix, proxyConfig := range extension.Upstreams {
+			if !strings.HasSuffix(prefix, "/") {
+				prefix += "/"
+			}
+
+			proxyHandler := s.buildProxyHandler(extension)
+			proxyHandler.Configuration = proxyConfig
+
+			mux.Handle(prefix, withUpstream(prefix, metrics.InstrumentUpstream(prefix, proxyHandler)))
+		}
+
+		s.extensions[extension.Name] = extension
+	}
+
+	if len(c.Extensions) > 0 {
+		// In addition to the per-extension endpoints, webhooks for all
+		// extensions are accepted at the global webhook endpoint.
+		webhookCtrl := controller.WebhookController{
+			WebhookQueueService: webhookQueueService,
+			WebhookVerifier:     webhookVerifier,
+			Allowlist:           bootstrap.BuildWebhookAllowlist(extensions),
+			Logger:              logger,
+		}
+
+		rm.POST("/webhooks", webhookCtrl.HandleWebhookRequest)
+	} else if len(c.ExtensionIDs) == 0 {
+		logger.Warn("no extension IDs configured; accepting webhooks for any extension")
+	}
+
+	s.handler = s.wrap(mux)
+	s.mstudioRouter = r
+	s.adminHandler = admin
+	s.webhookWorker = bootstrap.BuildWebhookWorker(c, repos.WebhookQueue, webhookService, logger)
+	s.reconciler, err = bootstrap.BuildInstanceReconciler(c, repos.Instances, logger)
+	if err != nil {
+		return fmt.Errorf("error building instance reconciler: %w", err)
+	}
+
+	if len(c.Events.Targets) > 0 {
+		s.eventDispatcher, err = bootstrap.BuildEventDispatcher(c, repos.Outbox, logger)
+		if err != nil {
+			return fmt.Errorf("error building event dispatcher: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (s *Server) buildProxyHandler(extension bootstrap.Extension) *proxy.Handler {
+	return &proxy.Handler{
+		HTTPClient:                s.options.httpClient,
+		SessionRepository:         s.options.repositories.Sessions,
+		SessionService:            s.sessionService,
+		APIKeyService:             s.apiKeyService,
+		Logger:                    s.options.logger,
+		AuthenticationOptions:     extension.AuthenticationOptions,
+		RedirectOnUnauthenticated: s.options.config.RedirectOnUnauthenticated,
+		Timeout:                   s.options.config.Server.ProxyTimeout,
+	}
+}
+
+// wrap adds the request ID, access log and tracing to a handler.
+func (s *Server) wrap(h http.Handler) http.Handler {
+	h = tracing.Middleware(h)
+
+	if s.accessLogger != nil {
+		h = s.accessLogger.Middleware(h)
+	}
+
+	return middleware.RequestID(h)
+}
+
+// withUpstream records the upstream of a request in the access log.
+func withUpstream(prefix string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		middleware.AccessLogEntryFromContext(r.Context()).SetUpstream(prefix)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ServeHTTP serves the mStudio endpoints and proxies all other requests to the
+// configured upstreams.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.closeWhenDraining(w)
+	s.handler.ServeHTTP(w, r)
+}
+
+// AdminHandler returns a handler that serves the health endpoints (at
+// "/healthz" and "/readyz") and the Prometheus metrics (at "/metrics"). It is
+// served on the admin listener if MITTWALD_EXT_PROXY_ADMIN_ADDR is set.
+func (s *Server) AdminHandler() http.Handler {
+	return s.adminHandler
+}
+
+// Middleware returns a handler that serves the mStudio endpoints, and passes
+// all other requests to next, if they are authenticated. The configured
+// upstreams are not used. Handlers can retrieve the session using
+// SessionFromContext.
+//
+// If multiple extensions are configured, use ExtensionMiddleware instead;
+// Middleware returns ErrUnknownExtension in that case.
+func (s *Server) Middleware(next http.Handler) (http.Handler, error) {
+	return s.ExtensionMiddleware("", next)
+}
+
+// ExtensionMiddleware is like Middleware, but only accepts sessions of the
+// extension with the given name.
+func (s *Server) ExtensionMiddleware(name string, next http.Handler) (http.Handler, error) {
+	extension, ok := s.extensions[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: '%s'", ErrUnknownExtension, name)
+	}
+
+	authHandler := s.buildProxyHandler(extension)
+	authHandler.Next = next
+
+	mux := http.NewServeMux()
+	mux.Handle("/mstudio/", s.mstudioRouter)
+	mux.Handle("/", authHandler)
+
+	wrapped := s.wrap(mux)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.closeWhenDraining(w)
+		wrapped.ServeHTTP(w, r)
+	}), nil
+}
+
+// SessionFromContext returns the session of a request that was authenticated
+// by the middleware.
+func SessionFromContext(ctx context.Context) (*model.Session, bool) {
+	return proxy.SessionFromContext(ctx)
+}
+
+// Start runs the start hooks and then starts the background workers (webhook
+// processing, instance reconciliation and event delivery). It returns
+// immediately; the workers run until Stop is called.
+func (s *Server) Start(ctx context.Context) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.cancelWorkers != nil {
+		return errors.New("server was already started")
+	}
+
+	for _, hook := range s.options.onStart {
+		if err := hook(ctx); err != nil {
+			return fmt.Errorf("error running start hook: %w", err)
+		}
+	}
+
+	if err := s.migrateLegacyInstances(ctx); err != nil {
+		return fmt.Errorf("error migrating extension instances: %w", err)
+	}
+
+	workerCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	s.cancelWorkers = cancel
+
+	s.runWorker(func() { s.webhookWorker.Run(workerCtx) })
+
+	if s.reconciler != nil {
+		s.runWorker(func() { s.reconciler.Run(workerCtx, s.options.config.Reconciliation.Interval) })
+	}
+
+	if s.eventDispatcher != nil {
+		s.runWorker(func() { s.eventDispatcher.Run(workerCtx) })
+	}
+
+	s.ready.Store(true)
+
+	return nil
+}
+
+// migrateLegacyInstances assigns the configured extension ID to instances that
+// were created before the extension ID was recorded. This is only possible if
+// exactly one extension ID is configured; otherwise, these instances are
+// migrated by the instance reconciler.
+func (s *Server) migrateLegacyInstances(ctx context.Context) error {
+	ids := slices.Compact(slices.Sorted(slices.Values(s.options.config.AllExtensionIDs())))
+	if len(ids) != 1 {
+		return nil
+	}
+
+	updated, err := s.options.repositories.Instances.AssignExtensionIDToLegacyInstances(ctx, ids[0])
+	if err != nil {
+		return err
+	}
+
+	if updated > 0 {
+		s.options.logger.Info("assigned extension ID to legacy extension instances", "extensionID", ids[0], "count", updated)
+	}
+
+	return nil
+}
+
+func (s *Server) runWorker(run func()) {
+	s.workers.Add(1)
+	go func() {
+		defer s.workers.Done()
+		run()
+	}()
+}
+
+// Stop marks the server as unready, stops the background workers, waits for
+// them to finish (or for the context to be cancelled), and then runs the stop
+// hooks.
+func (s *Server) Stop(ctx context.Context) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.Drain()
+
+	var errs []error
+
+	if s.cancelWorkers != nil {
+		s.cancelWorkers()
+
+		done := make(chan struct{})
+		go func() {
+			s.workers.Wait()
+			close(done)
+		}()
+
+		select {
+		case <-done:
+		case <-ctx.Done():
+			errs = append(errs, fmt.Errorf("error waiting for background workers: %w", ctx.Err()))
+		}
+	}
+
+	for _, hook := range slices.Backward(s.options.onStop) {
+		if err := hook(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("error running stop hook: %w", err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
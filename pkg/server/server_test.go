@@ -0,0 +1,523 @@
+package server_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/mittwald/mstudio-ext-proxy/pkg/bootstrap"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/domain/model"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/domain/service"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/proxy"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/server"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Server", func() {
+	var config *bootstrap.Config
+	var repos bootstrap.Repositories
+	var logger *slog.Logger
+
+	BeforeEach(func() {
+		config = &bootstrap.Config{
+			Secret:       "secret",
+			ExtensionIDs: []string{"extension"},
+			WebhookQueue: bootstrap.WebhookQueueConfig{Workers: 1},
+			Webhooks:     bootstrap.WebhooksConfig{Offline: true, PublicKeys: "serial=qGY32YuBV4GMC8eOoBLjr52YWo3QP3xEfSh1JqvAiO0="},
+		}
+		repos = bootstrap.BuildMemoryRepositories()
+		logger = slog.New(slog.NewTextHandler(GinkgoWriter, nil))
+	})
+
+	Describe("New", func() {
+		It("should require a configuration", func() {
+			_, err := server.New(server.WithRepositories(repos))
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("should require repositories", func() {
+			_, err := server.New(server.WithConfig(config))
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("should return configuration errors instead of panicking", func() {
+			config.Secret = ""
+
+			_, err := server.New(server.WithConfig(config), server.WithRepositories(repos))
+			Expect(err).To(MatchError(ContainSubstring("MITTWALD_EXT_PROXY_SECRET")))
+		})
+	})
+
+	Describe("Middleware", func() {
+		var handler http.Handler
+		var token string
+
+		next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			session, ok := server.SessionFromContext(r.Context())
+			if !ok {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+
+			w.Header().Set("X-Instance-Id", session.Instance.ID)
+			w.Header().Set("X-Has-User-JWT", boolString(r.Header.Get("X-Mstudio-User") != ""))
+			w.WriteHeader(http.StatusTeapot)
+		})
+
+		BeforeEach(func(ctx context.Context) {
+			instance := model.ExtensionInstance{ID: "instance", ExtensionID: "extension", Enabled: true}
+			Expect(repos.Instances.AddExtensionInstance(ctx, instance)).To(Succeed())
+
+			var err error
+			_, token, err = service.NewAPIKeyService(repos.APIKeys, repos.Instances).CreateAPIKey(ctx, "test", "instance", time.Time{})
+			Expect(err).NotTo(HaveOccurred())
+
+			srv, err := server.New(server.WithConfig(config), server.WithRepositories(repos), server.WithLogger(logger))
+			Expect(err).NotTo(HaveOccurred())
+
+			handler, err = srv.Middleware(next)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("should pass authenticated requests to the next handler", func() {
+			req := httptest.NewRequest(http.MethodGet, "/app", nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			Expect(rec.Code).To(Equal(http.StatusTeapot))
+			Expect(rec.Header().Get("X-Instance-Id")).To(Equal("instance"))
+			Expect(rec.Header().Get("X-Has-User-JWT")).To(Equal("true"))
+		})
+
+		It("should not pass unauthenticated requests to the next handler", func() {
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/app", nil))
+
+			Expect(rec.Code).To(Equal(http.StatusUnauthorized))
+		})
+
+		It("should serve the mStudio endpoints", func() {
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/mstudio/webhooks", nil))
+
+			body, _ := io.ReadAll(rec.Body)
+			Expect(rec.Code).To(Equal(http.StatusForbidden), string(body))
+		})
+
+		It("should write an access log without credentials", func() {
+			config.AccessLog = bootstrap.AccessLogConfig{Format: "json", Headers: []string{"Authorization"}}
+			out := &bytes.Buffer{}
+
+			srv, err := server.New(server.WithConfig(config), server.WithRepositories(repos), server.WithLogger(logger), server.WithAccessLogOutput(out))
+			Expect(err).NotTo(HaveOccurred())
+
+			handler, err := srv.Middleware(next)
+			Expect(err).NotTo(HaveOccurred())
+
+			req := httptest.NewRequest(http.MethodGet, "/app", nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			entry := map[string]any{}
+			Expect(json.Unmarshal(out.Bytes(), &entry)).To(Succeed())
+			Expect(entry).To(HaveKeyWithValue("path", "/app"))
+			Expect(entry).To(HaveKeyWithValue("status", BeNumerically("==", http.StatusTeapot)))
+			Expect(entry).To(HaveKeyWithValue("instance_id", "instance"))
+			Expect(out.String()).NotTo(ContainSubstring(token))
+		})
+	})
+
+	Describe("health endpoints", func() {
+		var srv *server.Server
+
+		BeforeEach(func() {
+			var err error
+			srv, err = server.New(server.WithConfig(config), server.WithRepositories(repos), server.WithLogger(logger))
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		get := func(handler http.Handler, path string) (int, map[string]any) {
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+
+			body := map[string]any{}
+			Expect(json.Unmarshal(rec.Body.Bytes(), &body)).To(Succeed())
+
+			return rec.Code, body
+		}
+
+		It("should report liveness", func() {
+			code, body := get(srv, "/mstudio/healthz")
+			Expect(code).To(Equal(http.StatusOK))
+			Expect(body).To(HaveKeyWithValue("status", "ok"))
+		})
+
+		It("should only report readiness while started", func(ctx context.Context) {
+			code, body := get(srv, "/mstudio/readyz")
+			Expect(code).To(Equal(http.StatusServiceUnavailable))
+			Expect(body).To(HaveKeyWithValue("status", "failing"))
+
+			Expect(srv.Start(ctx)).To(Succeed())
+
+			code, body = get(srv, "/mstudio/readyz")
+			Expect(code).To(Equal(http.StatusOK))
+			Expect(body).To(HaveKeyWithValue("status", "ok"))
+
+			srv.Drain()
+
+			code, _ = get(srv, "/mstudio/readyz")
+			Expect(code).To(Equal(http.StatusServiceUnavailable))
+
+			Expect(srv.Stop(ctx)).To(Succeed())
+		})
+
+		It("should serve the health endpoints on the admin handler", func(ctx context.Context) {
+			Expect(srv.Start(ctx)).To(Succeed())
+			DeferCleanup(srv.Stop)
+
+			code, _ := get(srv.AdminHandler(), "/readyz")
+			Expect(code).To(Equal(http.StatusOK))
+
+			code, _ = get(srv.AdminHandler(), "/healthz")
+			Expect(code).To(Equal(http.StatusOK))
+		})
+
+		It("should only report the individual checks on the admin handler", func(ctx context.Context) {
+			Expect(srv.Start(ctx)).To(Succeed())
+			DeferCleanup(srv.Stop)
+
+			_, body := get(srv, "/mstudio/readyz")
+			Expect(body).To(HaveKeyWithValue("status", "ok"))
+			Expect(body).NotTo(HaveKey("checks"))
+
+			_, body = get(srv.AdminHandler(), "/readyz")
+			Expect(body).To(HaveKeyWithValue("checks", ContainElement(HaveKeyWithValue("name", "server"))))
+		})
+
+		It("should serve the metrics on the admin handler", func(ctx context.Context) {
+			session := model.Session{ID: "session", Expires: time.Now().Add(time.Hour), Instance: model.ExtensionInstance{ID: "instance"}}
+			Expect(repos.Sessions.CreateSession(ctx, session)).To(Succeed())
+
+			rec := httptest.NewRecorder()
+			srv.AdminHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+			Expect(rec.Code).To(Equal(http.StatusOK))
+			Expect(rec.Body.String()).To(ContainSubstring(`mstudio_ext_proxy_active_sessions{instance="instance"} 1`))
+			Expect(rec.Body.String()).To(ContainSubstring("go_goroutines"))
+		})
+	})
+
+	It("should reject middlewares for unknown extensions", func() {
+		srv, err := server.New(server.WithConfig(config), server.WithRepositories(repos), server.WithLogger(logger))
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = srv.ExtensionMiddleware("unknown", http.NotFoundHandler())
+		Expect(err).To(MatchError(server.ErrUnknownExtension))
+	})
+
+	Describe("password login", func() {
+		It("should set a secure session cookie with the configured TTL", func() {
+			config.StaticPassword = "password"
+
+			srv, err := server.New(server.WithConfig(config), server.WithRepositories(repos), server.WithLogger(logger))
+			Expect(err).NotTo(HaveOccurred())
+
+			form := url.Values{"password": {"password"}, "csrf_token": {"token"}}
+			req := httptest.NewRequest(http.MethodPost, "/mstudio/auth/password", strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			req.AddCookie(&http.Cookie{Name: "mstudio_ext_csrf", Value: "token"})
+
+			rec := httptest.NewRecorder()
+			srv.ServeHTTP(rec, req)
+			Expect(rec.Code).To(Equal(http.StatusSeeOther))
+
+			cookies := rec.Result().Cookies()
+			Expect(cookies).NotTo(BeEmpty())
+
+			for _, cookie := range cookies {
+				Expect(cookie.Name).To(Equal("mstudio_ext_session"))
+				Expect(cookie.MaxAge).To(Equal(3600))
+				Expect(cookie.Secure).To(BeTrue())
+				Expect(cookie.HttpOnly).To(BeTrue())
+			}
+		})
+	})
+
+	Describe("multiple extensions", func() {
+		BeforeEach(func() {
+			config.ExtensionIDs = nil
+			Expect(config.Extensions.Decode(`{
+				"billing": {"extensionId": "billing-extension", "homeUrl": "/billing/", "upstreams": {"/billing/": {"upstreamURL": "http://billing.example"}}},
+				"backup": {"extensionId": "backup-extension", "homeUrl": "/backup/", "upstreams": {"/backup": {"upstreamURL": "http://backup.example"}}}
+			}`)).To(Succeed())
+		})
+
+		It("should reject OIDC providers", func() {
+			config.OIDC.IssuerURL = "https://issuer.example"
+
+			_, err := server.New(server.WithConfig(config), server.WithRepositories(repos), server.WithLogger(logger))
+			Expect(err).To(MatchError(ContainSubstring("MITTWALD_EXT_PROXY_OIDC_")))
+		})
+
+		It("should reject upstream prefixes that are used by multiple extensions", func() {
+			Expect(config.Extensions.Decode(`{
+				"billing": {"extensionId": "billing-extension", "upstreams": {"/shared/": {"upstreamURL": "http://billing.example"}}},
+				"backup": {"extensionId": "backup-extension", "upstreams": {"/shared": {"upstreamURL": "http://backup.example"}}}
+			}`)).To(Succeed())
+
+			_, err := server.New(server.WithConfig(config), server.WithRepositories(repos), server.WithLogger(logger))
+			Expect(err).To(MatchError(ContainSubstring("upstream prefix '/shared/' of extension 'billing' is already used by extension 'backup'")))
+		})
+
+		It("should reject overlapping upstream prefixes of different extensions", func() {
+			Expect(config.Extensions.Decode(`{
+				"billing": {"extensionId": "billing-extension", "upstreams": {"/billing/": {"upstreamURL": "http://billing.example"}}},
+				"backup": {"extensionId": "backup-extension", "upstreams": {"/billing/backup/": {"upstreamURL": "http://backup.example"}}}
+			}`)).To(Succeed())
+
+			_, err := server.New(server.WithConfig(config), server.WithRepositories(repos), server.WithLogger(logger))
+			Expect(err).To(MatchError(ContainSubstring("overlaps with prefix '/billing/backup/' of extension 'backup'")))
+		})
+
+		It("should only set the session cookie for the extension's paths", func() {
+			config.Context = "dev"
+
+			srv, err := server.New(server.WithConfig(config), server.WithRepositories(repos), server.WithLogger(logger))
+			Expect(err).NotTo(HaveOccurred())
+
+			rec := httptest.NewRecorder()
+			srv.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/mstudio/billing/auth/fake", nil))
+			Expect(rec.Code).To(Equal(http.StatusSeeOther))
+
+			paths := make([]string, 0)
+			for _, cookie := range rec.Result().Cookies() {
+				Expect(cookie.Name).To(Equal("mstudio_ext_session_billing"))
+				paths = append(paths, cookie.Path)
+			}
+
+			Expect(paths).To(Equal([]string{"/mstudio/billing", "/billing"}))
+		})
+
+		It("should not return a middleware for all extensions", func() {
+			srv, err := server.New(server.WithConfig(config), server.WithRepositories(repos), server.WithLogger(logger))
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = srv.Middleware(http.NotFoundHandler())
+			Expect(err).To(MatchError(server.ErrUnknownExtension))
+		})
+	})
+
+	Describe("lifecycle", func() {
+		var calls []string
+
+		hook := func(name string, err error) server.Hook {
+			return func(context.Context) error {
+				calls = append(calls, name)
+				return err
+			}
+		}
+
+		BeforeEach(func() {
+			calls = nil
+		})
+
+		It("should run the hooks in order", func(ctx context.Context) {
+			srv, err := server.New(
+				server.WithConfig(config),
+				server.WithRepositories(repos),
+				server.WithLogger(logger),
+				server.WithOnStart(hook("start 1", nil)),
+				server.WithOnStart(hook("start 2", nil)),
+				server.WithOnStop(hook("stop 1", nil)),
+				server.WithOnStop(hook("stop 2", nil)),
+			)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(srv.Start(ctx)).To(Succeed())
+			Expect(srv.Start(ctx)).NotTo(Succeed())
+			Expect(srv.Stop(ctx)).To(Succeed())
+
+			Expect(calls).To(Equal([]string{"start 1", "start 2", "stop 2", "stop 1"}))
+		})
+
+		It("should assign the extension ID to legacy instances", func(ctx context.Context) {
+			Expect(repos.Instances.AddExtensionInstance(ctx, model.ExtensionInstance{ID: "legacy", Enabled: true})).To(Succeed())
+
+			srv, err := server.New(server.WithConfig(config), server.WithRepositories(repos), server.WithLogger(logger))
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(srv.Start(ctx)).To(Succeed())
+			DeferCleanup(srv.Stop)
+
+			Expect(repos.Instances.FindExtensionInstanceByID(ctx, "legacy")).To(HaveField("ExtensionID", "extension"))
+		})
+
+		It("should not assign an extension ID to legacy instances if multiple are configured", func(ctx context.Context) {
+			config.ExtensionIDs = []string{"extension", "other-extension"}
+			Expect(repos.Instances.AddExtensionInstance(ctx, model.ExtensionInstance{ID: "legacy", Enabled: true})).To(Succeed())
+
+			srv, err := server.New(server.WithConfig(config), server.WithRepositories(repos), server.WithLogger(logger))
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(srv.Start(ctx)).To(Succeed())
+			DeferCleanup(srv.Stop)
+
+			Expect(repos.Instances.FindExtensionInstanceByID(ctx, "legacy")).To(HaveField("ExtensionID", ""))
+		})
+
+		It("should not start when a start hook fails", func(ctx context.Context) {
+			srv, err := server.New(
+				server.WithConfig(config),
+				server.WithRepositories(repos),
+				server.WithLogger(logger),
+				server.WithOnStart(hook("start 1", errors.New("failed"))),
+				server.WithOnStart(hook("start 2", nil)),
+			)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(srv.Start(ctx)).To(MatchError(ContainSubstring("failed")))
+			Expect(calls).To(Equal([]string{"start 1"}))
+		})
+	})
+})
+
+var _ = Describe("Serve", func() {
+	var srv *server.Server
+	var config *bootstrap.Config
+	var token string
+	var release chan struct{}
+
+	BeforeEach(func(ctx context.Context) {
+		release = make(chan struct{})
+
+		upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte("hello "))
+			w.(http.Flusher).Flush()
+
+			select {
+			case <-release:
+				_, _ = w.Write([]byte("world"))
+			case <-r.Context().Done():
+			}
+		}))
+		DeferCleanup(upstream.Close)
+		DeferCleanup(func() {
+			select {
+			case <-release:
+			default:
+				close(release)
+			}
+		})
+
+		upstreams := proxy.ConfigurationCollection{}
+		Expect(upstreams.Decode(fmt.Sprintf(`{"/": {"upstreamURL": %q}}`, upstream.URL))).To(Succeed())
+
+		config = &bootstrap.Config{
+			Secret:       "secret",
+			ExtensionIDs: []string{"extension"},
+			Upstreams:    upstreams,
+			WebhookQueue: bootstrap.WebhookQueueConfig{Workers: 1},
+			Server:       bootstrap.ServerConfig{ShutdownTimeout: 5 * time.Second},
+		}
+		repos := bootstrap.BuildMemoryRepositories()
+
+		instance := model.ExtensionInstance{ID: "instance", ExtensionID: "extension", Enabled: true}
+		Expect(repos.Instances.AddExtensionInstance(ctx, instance)).To(Succeed())
+
+		var err error
+		_, token, err = service.NewAPIKeyService(repos.APIKeys, repos.Instances).CreateAPIKey(ctx, "test", "instance", time.Time{})
+		Expect(err).NotTo(HaveOccurred())
+
+		srv, err = server.New(server.WithConfig(config), server.WithRepositories(repos), server.WithLogger(slog.New(slog.NewTextHandler(GinkgoWriter, nil))))
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	// serve runs the server until the returned cancel function is called, and
+	// starts a streaming request; the response is returned once the first
+	// chunk of the body was received.
+	serve := func() (context.CancelFunc, <-chan error, *bufio.Reader) {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).NotTo(HaveOccurred())
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error, 1)
+		go func() {
+			done <- srv.Serve(ctx, l)
+		}()
+
+		Eventually(srv.Ready).Should(BeTrue())
+
+		req, err := http.NewRequest(http.MethodGet, "http://"+l.Addr().String()+"/stream", nil)
+		Expect(err).NotTo(HaveOccurred())
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		res, err := http.DefaultClient.Do(req)
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(res.Body.Close)
+
+		body := bufio.NewReader(res.Body)
+		Expect(body.ReadString(' ')).To(Equal("hello "))
+
+		return cancel, done, body
+	}
+
+	It("should drain in-flight requests before shutting down", func() {
+		cancel, done, body := serve()
+
+		cancel()
+
+		Eventually(srv.Ready).Should(BeFalse())
+		Consistently(done, 200*time.Millisecond).ShouldNot(Receive())
+
+		close(release)
+
+		Expect(io.ReadAll(body)).To(Equal([]byte("world")))
+		Eventually(done).Should(Receive(BeNil()))
+	})
+
+	It("should not apply the write timeout to proxied requests", func() {
+		config.Server.WriteTimeout = 100 * time.Millisecond
+
+		cancel, _, body := serve()
+		defer cancel()
+
+		time.Sleep(300 * time.Millisecond)
+		close(release)
+
+		Expect(io.ReadAll(body)).To(Equal([]byte("world")))
+	})
+
+	It("should close connections when the shutdown timeout is exceeded", func() {
+		config.Server.ShutdownTimeout = 200 * time.Millisecond
+
+		cancel, done, body := serve()
+
+		cancel()
+
+		Eventually(done).Should(Receive(MatchError(context.DeadlineExceeded)))
+
+		_, err := io.ReadAll(body)
+		Expect(err).To(HaveOccurred())
+	})
+})
+
+func boolString(b bool) string {
+	if b {
+		return "true"
+	}
+	return "false"
+}
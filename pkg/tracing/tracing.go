@@ -0,0 +1,107 @@
+// Package tracing contains helpers for OpenTelemetry tracing. Spans are
+// created using the global tracer provider and propagator, which are no-ops
+// unless tracing is configured (see bootstrap.InitTracing).
+package tracing
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/mittwald/mstudio-ext-proxy/pkg/middleware"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "github.com/mittwald/mstudio-ext-proxy"
+
+// Attribute keys for the proxy's domain objects.
+const (
+	AttrUserID      = attribute.Key("mstudio.user.id")
+	AttrInstanceID  = attribute.Key("mstudio.instance.id")
+	AttrWebhookKind = attribute.Key("mstudio.webhook.kind")
+	AttrRequestID   = attribute.Key("mstudio.request.id")
+)
+
+// Start starts a new span as child of the span in ctx.
+func Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return otel.Tracer(instrumentationName).Start(ctx, name, opts...)
+}
+
+// End records err (if not nil) in the span, and ends it.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	span.End()
+}
+
+// Middleware starts a server span for each request; if the request carries a
+// trace context (like a "traceparent" header), the span continues that trace.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := Start(ctx, r.Method,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(r.Method),
+				semconv.URLPath(r.URL.Path),
+				semconv.ServerAddress(r.Host),
+				semconv.UserAgentOriginal(r.UserAgent()),
+			),
+		)
+		defer span.End()
+
+		if id := middleware.RequestIDFromContext(ctx); id != "" {
+			span.SetAttributes(AttrRequestID.String(id))
+		}
+
+		rec := middleware.NewResponseRecorder(w)
+		next.ServeHTTP(rec, r.WithContext(ctx))
+
+		span.SetAttributes(semconv.HTTPResponseStatusCode(rec.Status()))
+		if rec.Status() >= 500 {
+			span.SetStatus(codes.Error, http.StatusText(rec.Status()))
+		}
+	})
+}
+
+// StartClientSpan starts a client span for an outgoing request, and injects
+// the span's trace context into the request headers.
+func StartClientSpan(req *http.Request) trace.Span {
+	// The query string and user info might contain credentials.
+	u := *req.URL
+	u.User = nil
+	u.RawQuery = ""
+
+	ctx, span := Start(req.Context(), req.Method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.HTTPRequestMethodKey.String(req.Method),
+			semconv.URLFull(u.String()),
+			semconv.ServerAddress(req.URL.Hostname()),
+		),
+	)
+
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	return span
+}
+
+// EndClientSpan records the result of an outgoing request in the span started
+// by StartClientSpan, and ends it.
+func EndClientSpan(span trace.Span, res *http.Response, err error) {
+	if res != nil {
+		span.SetAttributes(semconv.HTTPResponseStatusCode(res.StatusCode))
+		if res.StatusCode >= 500 {
+			span.SetStatus(codes.Error, http.StatusText(res.StatusCode))
+		}
+	}
+
+	End(span, err)
+}
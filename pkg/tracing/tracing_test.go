@@ -0,0 +1,82 @@
+package tracing_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/mittwald/mstudio-ext-proxy/pkg/tracing"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var _ = Describe("Tracing", func() {
+	var recorder *tracetest.SpanRecorder
+
+	BeforeEach(func() {
+		recorder = tracetest.NewSpanRecorder()
+		tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+		prevProvider, prevPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+		otel.SetTracerProvider(tp)
+		otel.SetTextMapPropagator(propagation.TraceContext{})
+
+		DeferCleanup(func() {
+			otel.SetTracerProvider(prevProvider)
+			otel.SetTextMapPropagator(prevPropagator)
+		})
+	})
+
+	Describe("Middleware", func() {
+		It("should continue the trace of the incoming request", func() {
+			var innerSpan trace.SpanContext
+
+			h := tracing.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				innerSpan = trace.SpanContextFromContext(r.Context())
+				w.WriteHeader(http.StatusBadGateway)
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/foo", nil)
+			req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+			h.ServeHTTP(httptest.NewRecorder(), req)
+
+			spans := recorder.Ended()
+			Expect(spans).To(HaveLen(1))
+			Expect(spans[0].SpanKind()).To(Equal(trace.SpanKindServer))
+			Expect(spans[0].SpanContext().TraceID().String()).To(Equal("4bf92f3577b34da6a3ce929d0e0e4736"))
+			Expect(spans[0].Parent().SpanID().String()).To(Equal("00f067aa0ba902b7"))
+			Expect(spans[0].Status().Code).To(Equal(codes.Error))
+			Expect(innerSpan.SpanID()).To(Equal(spans[0].SpanContext().SpanID()))
+		})
+	})
+
+	Describe("StartClientSpan", func() {
+		It("should inject the trace context into the outgoing request", func() {
+			ctx, parent := tracing.Start(GinkgoT().Context(), "parent")
+
+			req := httptest.NewRequest(http.MethodGet, "http://upstream.example/foo?token=secret", nil).WithContext(ctx)
+			span := tracing.StartClientSpan(req)
+			tracing.EndClientSpan(span, nil, errors.New("connection refused"))
+			parent.End()
+
+			spans := recorder.Ended()
+			Expect(spans).To(HaveLen(2))
+
+			client := spans[0]
+			Expect(client.SpanKind()).To(Equal(trace.SpanKindClient))
+			Expect(client.Parent().SpanID()).To(Equal(parent.SpanContext().SpanID()))
+			Expect(client.Status().Code).To(Equal(codes.Error))
+			Expect(req.Header.Get("traceparent")).To(ContainSubstring(client.SpanContext().SpanID().String()))
+
+			for _, attr := range client.Attributes() {
+				Expect(attr.Value.Emit()).NotTo(ContainSubstring("secret"))
+			}
+		})
+	})
+})
@@ -0,0 +1,68 @@
+package webhooks
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/mittwald/mstudio-ext-proxy/pkg/webhooks/webhooksv1"
+)
+
+var ErrForeignExtension = errors.New("webhook was sent for a foreign extension")
+
+// OriginVerifier checks whether a webhook was sent for an accepted extension.
+type OriginVerifier interface {
+	VerifyWebhookOrigin(wh any) error
+}
+
+// Allowlist restricts the webhooks that are accepted to those sent for
+// specific extensions and contributors. An empty list allows any ID.
+type Allowlist struct {
+	ExtensionIDs   []string
+	ContributorIDs []string
+}
+
+// VerifyWebhookOrigin checks the meta data of a webhook against the allowlist.
+func (a *Allowlist) VerifyWebhookOrigin(wh any) error {
+	withMeta, ok := wh.(webhooksv1.WithMeta)
+	if !ok {
+		return fmt.Errorf("%w: webhook of type %T does not carry meta data", ErrForeignExtension, wh)
+	}
+
+	meta := withMeta.WebhookMeta()
+
+	if len(a.ExtensionIDs) > 0 && !slices.Contains(a.ExtensionIDs, meta.ExtensionID) {
+		return fmt.Errorf("%w: unexpected extension ID '%s'", ErrForeignExtension, meta.ExtensionID)
+	}
+
+	if len(a.ContributorIDs) > 0 && !slices.Contains(a.ContributorIDs, meta.ContributorID) {
+		return fmt.Errorf("%w: unexpected contributor ID '%s'", ErrForeignExtension, meta.ContributorID)
+	}
+
+	return nil
+}
+
+// AllowlistSet accepts the webhooks that are accepted by any of its
+// allowlists. Unlike a single allowlist with the union of all IDs, each
+// contributor ID is only accepted together with the extension IDs of the same
+// allowlist.
+type AllowlistSet []*Allowlist
+
+func (s AllowlistSet) VerifyWebhookOrigin(wh any) error {
+	errs := make([]error, 0, len(s))
+
+	for _, allowlist := range s {
+		err := allowlist.VerifyWebhookOrigin(wh)
+		if err == nil {
+			return nil
+		}
+
+		errs = append(errs, err)
+	}
+
+	if len(errs) == 0 {
+		return fmt.Errorf("%w: no extensions configured", ErrForeignExtension)
+	}
+
+	return errors.Join(errs...)
+}
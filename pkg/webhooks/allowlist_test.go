@@ -0,0 +1,63 @@
+package webhooks_test
+
+import (
+	"github.com/mittwald/mstudio-ext-proxy/pkg/webhooks"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/webhooks/webhooksv1"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Allowlist", func() {
+	allowlist := &webhooks.Allowlist{ExtensionIDs: []string{"extension"}, ContributorIDs: []string{"contributor"}}
+
+	webhook := func(extensionID, contributorID string) any {
+		return &webhooksv1.ExtensionAddedToContext{Meta: webhooksv1.Meta{ExtensionID: extensionID, ContributorID: contributorID}}
+	}
+
+	It("should accept webhooks for the configured extension and contributor", func() {
+		Expect(allowlist.VerifyWebhookOrigin(webhook("extension", "contributor"))).To(Succeed())
+	})
+
+	It("should reject webhooks for a foreign extension", func() {
+		Expect(allowlist.VerifyWebhookOrigin(webhook("foreign", "contributor"))).To(MatchError(webhooks.ErrForeignExtension))
+	})
+
+	It("should reject webhooks of a foreign contributor", func() {
+		Expect(allowlist.VerifyWebhookOrigin(webhook("extension", "foreign"))).To(MatchError(webhooks.ErrForeignExtension))
+	})
+
+	It("should reject webhooks without meta data", func() {
+		Expect(allowlist.VerifyWebhookOrigin(struct{}{})).To(MatchError(webhooks.ErrForeignExtension))
+	})
+
+	It("should accept any extension and contributor if it is empty", func() {
+		empty := &webhooks.Allowlist{}
+		Expect(empty.VerifyWebhookOrigin(webhook("foreign", "foreign"))).To(Succeed())
+		Expect(empty.VerifyWebhookOrigin(struct{}{})).To(MatchError(webhooks.ErrForeignExtension))
+	})
+})
+
+var _ = Describe("AllowlistSet", func() {
+	set := webhooks.AllowlistSet{
+		{ExtensionIDs: []string{"billing"}, ContributorIDs: []string{"contributor-a"}},
+		{ExtensionIDs: []string{"backup"}, ContributorIDs: []string{"contributor-b"}},
+	}
+
+	webhook := func(extensionID, contributorID string) any {
+		return &webhooksv1.ExtensionInstanceUpdated{Meta: webhooksv1.Meta{ExtensionID: extensionID, ContributorID: contributorID}}
+	}
+
+	It("should accept webhooks that are accepted by any allowlist", func() {
+		Expect(set.VerifyWebhookOrigin(webhook("billing", "contributor-a"))).To(Succeed())
+		Expect(set.VerifyWebhookOrigin(webhook("backup", "contributor-b"))).To(Succeed())
+	})
+
+	It("should reject contributor IDs of another extension", func() {
+		Expect(set.VerifyWebhookOrigin(webhook("billing", "contributor-b"))).To(MatchError(webhooks.ErrForeignExtension))
+		Expect(set.VerifyWebhookOrigin(webhook("backup", "contributor-a"))).To(MatchError(webhooks.ErrForeignExtension))
+	})
+
+	It("should reject all webhooks if it is empty", func() {
+		Expect(webhooks.AllowlistSet{}.VerifyWebhookOrigin(webhook("billing", "contributor-a"))).To(MatchError(webhooks.ErrForeignExtension))
+	})
+})
@@ -3,27 +3,224 @@ package webhookscommon
 import (
 	"context"
 	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/mittwald/mstudio-ext-proxy/pkg/metrics"
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	DefaultKeyCacheTTL           = 24 * time.Hour
+	DefaultKeyCacheNegativeTTL   = 1 * time.Minute
+	DefaultKeyCacheMaxEntries    = 10000
+	DefaultKeyCacheLookupRate    = 1.0
+	DefaultKeyCacheLookupBurst   = 10
+	DefaultKeyCacheLookupTimeout = 10 * time.Second
 )
 
+// ErrKeyLookupRateLimited is returned by KeyProviderCache when a serial is not
+// cached, and the lookup limit is exhausted.
+var ErrKeyLookupRateLimited = errors.New("too many key lookups")
+
+// keySerialPattern matches well-formed key serials; other serials are rejected
+// without being looked up, so that arbitrary header values do not cause API
+// requests.
+var keySerialPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+type keyCacheEntry struct {
+	key     ed25519.PublicKey
+	err     error
+	expires time.Time
+}
+
+// KeyProviderCache caches the public keys returned by another KeyProvider.
+// It is safe for concurrent use. Unknown serials (ErrUnknownKeySerial) are
+// cached for a shorter duration, so that repeated requests with the same
+// invalid serial do not cause an API request each; other errors (like an
+// unavailable API) are not cached, so that they do not outlast the outage.
+// Serials that are malformed are rejected without a lookup, and concurrent
+// lookups of the same serial are coalesced into one. The lookups of all
+// serials that are not cached are limited by a token bucket; when it is
+// empty, ErrKeyLookupRateLimited is returned without a lookup.
 type KeyProviderCache struct {
 	Inner KeyProvider
-	cache map[string]ed25519.PublicKey
+
+	// TTL and NegativeTTL are the durations for which keys and unknown serials
+	// are cached; if zero, DefaultKeyCacheTTL and DefaultKeyCacheNegativeTTL
+	// are used.
+	TTL         time.Duration
+	NegativeTTL time.Duration
+
+	// MaxEntries limits the number of cached entries; if the limit is reached,
+	// expired entries are evicted and further unknown serials are not cached.
+	MaxEntries int
+
+	// LookupRate is the number of lookups per second that are passed to the
+	// inner KeyProvider, with bursts of up to LookupBurst lookups; if zero,
+	// DefaultKeyCacheLookupRate and DefaultKeyCacheLookupBurst are used.
+	LookupRate  float64
+	LookupBurst int
+
+	// LookupTimeout limits the duration of a lookup. Since a lookup is shared
+	// by all concurrent callers, it is not cancelled when the first caller
+	// goes away; if zero, DefaultKeyCacheLookupTimeout is used.
+	LookupTimeout time.Duration
+
+	lock         sync.Mutex
+	entries      map[string]keyCacheEntry
+	group        singleflight.Group
+	tokens       float64
+	tokensFilled time.Time
 }
 
 func (k *KeyProviderCache) PublicKeyForSerial(ctx context.Context, s string) (ed25519.PublicKey, error) {
-	if k.cache == nil {
-		k.cache = make(map[string]ed25519.PublicKey)
+	if !keySerialPattern.MatchString(s) {
+		return nil, fmt.Errorf("%w: malformed serial", ErrUnknownKeySerial)
 	}
 
-	if existing, ok := k.cache[s]; ok {
-		return existing, nil
+	if entry, ok := k.lookup(s); ok {
+		metrics.WebhookKeyCacheLookups.WithLabelValues("hit").Inc()
+		return entry.key, entry.err
+	}
+
+	metrics.WebhookKeyCacheLookups.WithLabelValues("miss").Inc()
+
+	result, err, _ := k.group.Do(s, func() (any, error) {
+		// The entry might have been added while waiting for the lock.
+		if entry, ok := k.lookup(s); ok {
+			return entry.key, entry.err
+		}
+
+		if !k.takeLookupToken() {
+			return nil, fmt.Errorf("%w: not looking up serial '%s'", ErrKeyLookupRateLimited, s)
+		}
+
+		timeout := k.LookupTimeout
+		if timeout == 0 {
+			timeout = DefaultKeyCacheLookupTimeout
+		}
+
+		lookupCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+		defer cancel()
+
+		key, err := k.Inner.PublicKeyForSerial(lookupCtx, s)
+
+		// Only cache results that will not change soon; transient errors
+		// (including timeouts) are retried with the next lookup.
+		if err == nil || errors.Is(err, ErrUnknownKeySerial) {
+			k.store(s, key, err)
+		}
+
+		return key, err
+	})
+
+	key, _ := result.(ed25519.PublicKey)
+	return key, err
+}
+
+// Preload fetches the keys for the given serials, so that the first webhook
+// requests do not need to wait for the API.
+func (k *KeyProviderCache) Preload(ctx context.Context, serials ...string) error {
+	errs := make([]error, 0)
+
+	for _, serial := range serials {
+		if _, err := k.PublicKeyForSerial(ctx, serial); err != nil {
+			errs = append(errs, fmt.Errorf("error preloading key '%s': %w", serial, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// takeLookupToken takes a token from the lookup token bucket, and reports
+// whether there was one.
+func (k *KeyProviderCache) takeLookupToken() bool {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+
+	rate, burst := k.LookupRate, float64(k.LookupBurst)
+	if rate == 0 {
+		rate = DefaultKeyCacheLookupRate
+	}
+
+	if burst == 0 {
+		burst = DefaultKeyCacheLookupBurst
+	}
+
+	now := time.Now()
+	if k.tokensFilled.IsZero() {
+		k.tokens = burst
+	} else {
+		k.tokens = min(burst, k.tokens+now.Sub(k.tokensFilled).Seconds()*rate)
+	}
+
+	k.tokensFilled = now
+
+	if k.tokens < 1 {
+		return false
+	}
+
+	k.tokens--
+	return true
+}
+
+func (k *KeyProviderCache) lookup(s string) (keyCacheEntry, bool) {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+
+	entry, ok := k.entries[s]
+	if !ok || entry.expires.Before(time.Now()) {
+		return keyCacheEntry{}, false
+	}
+
+	return entry, true
+}
+
+func (k *KeyProviderCache) store(s string, key ed25519.PublicKey, err error) {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+
+	if k.entries == nil {
+		k.entries = make(map[string]keyCacheEntry)
+	}
+
+	maxEntries := k.MaxEntries
+	if maxEntries == 0 {
+		maxEntries = DefaultKeyCacheMaxEntries
+	}
+
+	if len(k.entries) >= maxEntries {
+		k.evictExpired()
+
+		if len(k.entries) >= maxEntries && err != nil {
+			return
+		}
+	}
+
+	ttl := k.TTL
+	if ttl == 0 {
+		ttl = DefaultKeyCacheTTL
 	}
 
-	key, err := k.Inner.PublicKeyForSerial(ctx, s)
 	if err != nil {
-		return nil, err
+		ttl = k.NegativeTTL
+		if ttl == 0 {
+			ttl = DefaultKeyCacheNegativeTTL
+		}
 	}
 
-	k.cache[s] = key
-	return key, nil
+	k.entries[s] = keyCacheEntry{key: key, err: err, expires: time.Now().Add(ttl)}
+}
+
+func (k *KeyProviderCache) evictExpired() {
+	now := time.Now()
+	for s, entry := range k.entries {
+		if entry.expires.Before(now) {
+			delete(k.entries, s)
+		}
+	}
 }
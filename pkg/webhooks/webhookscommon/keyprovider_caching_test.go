@@ -0,0 +1,176 @@
+package webhookscommon_test
+
+import (
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mittwald/mstudio-ext-proxy/pkg/webhooks/webhookscommon"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+type countingKeyProvider struct {
+	calls     atomic.Int32
+	cancelled atomic.Int32
+	keys      map[string]ed25519.PublicKey
+	delay     time.Duration
+	err       error
+}
+
+func (c *countingKeyProvider) PublicKeyForSerial(ctx context.Context, s string) (ed25519.PublicKey, error) {
+	c.calls.Add(1)
+	time.Sleep(c.delay)
+
+	if ctx.Err() != nil {
+		c.cancelled.Add(1)
+		return nil, ctx.Err()
+	}
+
+	if c.err != nil {
+		return nil, c.err
+	}
+
+	if key, ok := c.keys[s]; ok {
+		return key, nil
+	}
+
+	return nil, fmt.Errorf("%w '%s'", webhookscommon.ErrUnknownKeySerial, s)
+}
+
+var _ = Describe("KeyProviderCache", func() {
+	var inner *countingKeyProvider
+	var cache *webhookscommon.KeyProviderCache
+
+	BeforeEach(func() {
+		inner = &countingKeyProvider{keys: map[string]ed25519.PublicKey{"known": make(ed25519.PublicKey, ed25519.PublicKeySize)}}
+		cache = &webhookscommon.KeyProviderCache{Inner: inner}
+	})
+
+	It("should cache keys", func() {
+		for range 3 {
+			key, err := cache.PublicKeyForSerial(context.Background(), "known")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(key).To(HaveLen(ed25519.PublicKeySize))
+		}
+
+		Expect(inner.calls.Load()).To(BeEquivalentTo(1))
+	})
+
+	It("should cache unknown serials", func() {
+		for range 3 {
+			_, err := cache.PublicKeyForSerial(context.Background(), "unknown")
+			Expect(err).To(MatchError(webhookscommon.ErrUnknownKeySerial))
+		}
+
+		Expect(inner.calls.Load()).To(BeEquivalentTo(1))
+	})
+
+	It("should not cache other errors", func() {
+		inner.err = errors.New("API unavailable")
+
+		_, err := cache.PublicKeyForSerial(context.Background(), "known")
+		Expect(err).To(HaveOccurred())
+
+		inner.err = nil
+
+		_, err = cache.PublicKeyForSerial(context.Background(), "known")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(inner.calls.Load()).To(BeEquivalentTo(2))
+	})
+
+	It("should reject malformed serials without a lookup", func() {
+		for _, serial := range []string{"", "../../v2/users/self", strings.Repeat("a", 129), "serial\n"} {
+			_, err := cache.PublicKeyForSerial(context.Background(), serial)
+			Expect(err).To(MatchError(webhookscommon.ErrUnknownKeySerial))
+		}
+
+		Expect(inner.calls.Load()).To(BeZero())
+	})
+
+	It("should expire cached entries", func() {
+		cache.TTL = time.Millisecond
+
+		_, _ = cache.PublicKeyForSerial(context.Background(), "known")
+		time.Sleep(5 * time.Millisecond)
+		_, _ = cache.PublicKeyForSerial(context.Background(), "known")
+
+		Expect(inner.calls.Load()).To(BeEquivalentTo(2))
+	})
+
+	It("should coalesce concurrent lookups", func() {
+		inner.delay = 50 * time.Millisecond
+
+		wg := sync.WaitGroup{}
+		for range 10 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer GinkgoRecover()
+
+				_, err := cache.PublicKeyForSerial(context.Background(), "known")
+				Expect(err).NotTo(HaveOccurred())
+			}()
+		}
+
+		wg.Wait()
+		Expect(inner.calls.Load()).To(BeEquivalentTo(1))
+	})
+
+	It("should limit lookups of uncached serials", func() {
+		cache.LookupRate = 0.001
+		cache.LookupBurst = 2
+
+		for _, serial := range []string{"known", "unknown-1"} {
+			_, err := cache.PublicKeyForSerial(context.Background(), serial)
+			Expect(errors.Is(err, webhookscommon.ErrKeyLookupRateLimited)).To(BeFalse())
+		}
+
+		_, err := cache.PublicKeyForSerial(context.Background(), "unknown-2")
+		Expect(err).To(MatchError(webhookscommon.ErrKeyLookupRateLimited))
+		Expect(inner.calls.Load()).To(BeEquivalentTo(2))
+
+		By("still returning cached keys")
+		_, err = cache.PublicKeyForSerial(context.Background(), "known")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(inner.calls.Load()).To(BeEquivalentTo(2))
+	})
+
+	It("should not cancel a shared lookup when the first caller goes away", func() {
+		inner.delay = 50 * time.Millisecond
+
+		ctx, cancel := context.WithCancel(context.Background())
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			cancel()
+		}()
+
+		key, err := cache.PublicKeyForSerial(ctx, "known")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(key).To(HaveLen(ed25519.PublicKeySize))
+		Expect(inner.cancelled.Load()).To(BeZero())
+	})
+
+	It("should time out lookups", func() {
+		cache.LookupTimeout = 10 * time.Millisecond
+		inner.delay = 50 * time.Millisecond
+
+		_, err := cache.PublicKeyForSerial(context.Background(), "known")
+		Expect(err).To(MatchError(context.DeadlineExceeded))
+		Expect(inner.cancelled.Load()).To(BeEquivalentTo(1))
+	})
+
+	It("should preload keys", func() {
+		Expect(cache.Preload(context.Background(), "known")).To(Succeed())
+		Expect(cache.Preload(context.Background(), "unknown")).NotTo(Succeed())
+
+		_, err := cache.PublicKeyForSerial(context.Background(), "known")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(inner.calls.Load()).To(BeEquivalentTo(2))
+	})
+})
@@ -0,0 +1,34 @@
+package webhookscommon
+
+import (
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+)
+
+// KeyProviderChain consults several key providers in order, and returns the
+// first key that is found. The serial is only reported as unknown if all
+// providers report it as unknown; otherwise, the other errors are returned.
+type KeyProviderChain []KeyProvider
+
+func (c KeyProviderChain) PublicKeyForSerial(ctx context.Context, s string) (ed25519.PublicKey, error) {
+	errs := make([]error, 0, len(c))
+
+	for _, provider := range c {
+		key, err := provider.PublicKeyForSerial(ctx, s)
+		if err == nil {
+			return key, nil
+		}
+
+		if !errors.Is(err, ErrUnknownKeySerial) {
+			errs = append(errs, err)
+		}
+	}
+
+	if len(errs) == 0 {
+		return nil, fmt.Errorf("%w '%s'", ErrUnknownKeySerial, s)
+	}
+
+	return nil, errors.Join(errs...)
+}
@@ -4,6 +4,9 @@ import (
 	"context"
 	"crypto/ed25519"
 	"encoding/base64"
+	"fmt"
+	"net/http"
+
 	mittwaldv2 "github.com/mittwald/api-client-go/mittwaldv2/generated/clients"
 	"github.com/mittwald/api-client-go/mittwaldv2/generated/clients/marketplaceclientv2"
 )
@@ -14,7 +17,11 @@ type KeyProviderMStudio struct {
 
 func (k *KeyProviderMStudio) PublicKeyForSerial(ctx context.Context, serial string) (ed25519.PublicKey, error) {
 	req := marketplaceclientv2.GetPublicKeyRequest{Serial: serial}
-	resp, _, err := k.Client.Marketplace().GetPublicKey(ctx, req)
+	resp, httpResp, err := k.Client.Marketplace().GetPublicKey(ctx, req)
+	if httpResp != nil && httpResp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("%w '%s'", ErrUnknownKeySerial, serial)
+	}
+
 	if err != nil {
 		return nil, err
 	}
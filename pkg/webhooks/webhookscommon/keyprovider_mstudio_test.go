@@ -0,0 +1,80 @@
+package webhookscommon_test
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/mittwald/api-client-go/mittwaldv2"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/mstudiotest"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/webhooks/webhookscommon"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("KeyProviderMStudio", func() {
+	var api *mstudiotest.Server
+	var signer *webhookscommon.Signer
+	var verifier *webhookscommon.Verifier
+
+	body := []byte(`{"apiVersion":"v1","kind":"ExtensionInstanceRemovedFromContext","id":"foo"}`)
+
+	buildRequest := func(s *webhookscommon.Signer) *http.Request {
+		req := httptest.NewRequest(http.MethodPost, "/mstudio/webhooks", strings.NewReader(string(body)))
+		s.SignRequest(req, body)
+		return req
+	}
+
+	BeforeEach(func(ctx context.Context) {
+		api = mstudiotest.NewServer()
+		DeferCleanup(api.Close)
+
+		var err error
+		signer, err = api.GenerateSigner("serial")
+		Expect(err).NotTo(HaveOccurred())
+
+		client, err := mittwaldv2.New(ctx, api.ClientOptions()...)
+		Expect(err).NotTo(HaveOccurred())
+
+		verifier = &webhookscommon.Verifier{
+			KeyProvider: &webhookscommon.KeyProviderCache{
+				Inner: &webhookscommon.KeyProviderMStudio{Client: client},
+			},
+		}
+	})
+
+	It("should verify webhooks signed with a key known to the API", func(ctx context.Context) {
+		Expect(verifier.VerifyWebhookRequest(ctx, buildRequest(signer), body)).To(Succeed())
+		Expect(verifier.VerifyWebhookRequest(ctx, buildRequest(signer), body)).To(Succeed())
+
+		Expect(api.RequestCount(mstudiotest.EndpointGetPublicKey)).To(Equal(1))
+	})
+
+	It("should reject webhooks signed with a different key for the same serial", func(ctx context.Context) {
+		_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+		Expect(err).NotTo(HaveOccurred())
+
+		other := webhookscommon.Signer{Serial: "serial", PrivateKey: privateKey}
+		Expect(verifier.VerifyWebhookRequest(ctx, buildRequest(&other), body)).NotTo(Succeed())
+	})
+
+	It("should reject webhooks signed with an unknown serial", func(ctx context.Context) {
+		unknown := *signer
+		unknown.Serial = "unknown"
+
+		Expect(verifier.VerifyWebhookRequest(ctx, buildRequest(&unknown), body)).NotTo(Succeed())
+		Expect(verifier.VerifyWebhookRequest(ctx, buildRequest(&unknown), body)).NotTo(Succeed())
+
+		Expect(api.RequestCount(mstudiotest.EndpointGetPublicKey)).To(Equal(1))
+	})
+
+	It("should fail when the API is unavailable, but retry with the next request", func(ctx context.Context) {
+		api.FailNext(mstudiotest.EndpointGetPublicKey, http.StatusServiceUnavailable, 1)
+
+		Expect(verifier.VerifyWebhookRequest(ctx, buildRequest(signer), body)).NotTo(Succeed())
+		Expect(verifier.VerifyWebhookRequest(ctx, buildRequest(signer), body)).To(Succeed())
+	})
+})
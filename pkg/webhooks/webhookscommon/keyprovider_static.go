@@ -0,0 +1,175 @@
+package webhookscommon
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+var ErrUnknownKeySerial = errors.New("unknown key serial")
+
+// KeyProviderStatic provides a fixed set of public keys, for example for
+// environments without access to the marketplace API.
+type KeyProviderStatic struct {
+	Keys map[string]ed25519.PublicKey
+}
+
+func (k *KeyProviderStatic) PublicKeyForSerial(_ context.Context, s string) (ed25519.PublicKey, error) {
+	key, ok := k.Keys[s]
+	if !ok {
+		return nil, fmt.Errorf("%w '%s'", ErrUnknownKeySerial, s)
+	}
+
+	return key, nil
+}
+
+// ParseStaticKeys parses a comma-separated list of "serial=key" pairs, where
+// each key is a base64-encoded raw Ed25519 public key (the same encoding that
+// is used by the marketplace API).
+func ParseStaticKeys(value string) (map[string]ed25519.PublicKey, error) {
+	keys := make(map[string]ed25519.PublicKey)
+
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		// Only the first "=" separates serial and key; the others are part
+		// of the key's base64 padding.
+		serial, encoded, ok := strings.Cut(pair, "=")
+		if !ok || serial == "" {
+			return nil, fmt.Errorf("invalid key definition '%s'; expected 'serial=key'", pair)
+		}
+
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("invalid key for serial '%s': %w", serial, err)
+		}
+
+		if len(key) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid key for serial '%s': expected %d bytes, got %d", serial, ed25519.PublicKeySize, len(key))
+		}
+
+		keys[serial] = key
+	}
+
+	return keys, nil
+}
+
+// LoadKeysFromFile reads public keys from a file, which may either be a JWK
+// set (or a single JWK) in JSON format, or contain one or more PEM-encoded
+// public keys. In JWKs, the "kid" is used as serial; PEM blocks need a
+// "Serial" header:
+//
+//	-----BEGIN PUBLIC KEY-----
+//	Serial: 1234
+//
+//	MCowBQYDK2VwAyEA...
+//	-----END PUBLIC KEY-----
+func LoadKeysFromFile(path string) (map[string]ed25519.PublicKey, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading key file: %w", err)
+	}
+
+	if trimmed := bytes.TrimSpace(contents); len(trimmed) > 0 && trimmed[0] == '{' {
+		return parseJWKs(trimmed)
+	}
+
+	return parsePEMKeys(contents)
+}
+
+type jwk struct {
+	KeyID string `json:"kid"`
+	Type  string `json:"kty"`
+	Curve string `json:"crv"`
+	X     string `json:"x"`
+}
+
+func parseJWKs(contents []byte) (map[string]ed25519.PublicKey, error) {
+	set := struct {
+		Keys []jwk `json:"keys"`
+	}{}
+
+	if err := json.Unmarshal(contents, &set); err != nil {
+		return nil, fmt.Errorf("error parsing JWK set: %w", err)
+	}
+
+	// A single JWK instead of a set
+	if set.Keys == nil {
+		single := jwk{}
+		if err := json.Unmarshal(contents, &single); err != nil {
+			return nil, fmt.Errorf("error parsing JWK: %w", err)
+		}
+
+		set.Keys = []jwk{single}
+	}
+
+	keys := make(map[string]ed25519.PublicKey)
+	for _, k := range set.Keys {
+		if k.Type != "OKP" || k.Curve != "Ed25519" {
+			return nil, fmt.Errorf("unsupported JWK '%s': expected an Ed25519 key (kty=OKP, crv=Ed25519)", k.KeyID)
+		}
+
+		if k.KeyID == "" {
+			return nil, fmt.Errorf("JWK without 'kid'")
+		}
+
+		x, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(k.X, "="))
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid key in JWK '%s'", k.KeyID)
+		}
+
+		keys[k.KeyID] = x
+	}
+
+	return keys, nil
+}
+
+func parsePEMKeys(contents []byte) (map[string]ed25519.PublicKey, error) {
+	keys := make(map[string]ed25519.PublicKey)
+
+	for {
+		var block *pem.Block
+		block, contents = pem.Decode(contents)
+		if block == nil {
+			break
+		}
+
+		if block.Type != "PUBLIC KEY" {
+			continue
+		}
+
+		serial := block.Headers["Serial"]
+		if serial == "" {
+			return nil, fmt.Errorf("PEM public key without 'Serial' header")
+		}
+
+		parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("invalid public key for serial '%s': %w", serial, err)
+		}
+
+		key, ok := parsed.(ed25519.PublicKey)
+		if !ok {
+			return nil, fmt.Errorf("public key for serial '%s' is a %T; expected an Ed25519 key", serial, parsed)
+		}
+
+		keys[serial] = key
+	}
+
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no public keys found in key file")
+	}
+
+	return keys, nil
+}
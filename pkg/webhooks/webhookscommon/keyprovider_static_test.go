@@ -0,0 +1,77 @@
+package webhookscommon_test
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/mittwald/mstudio-ext-proxy/pkg/webhooks/webhookscommon"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Static key providers", func() {
+	var publicKey ed25519.PublicKey
+
+	BeforeEach(func() {
+		var err error
+		publicKey, _, err = ed25519.GenerateKey(rand.Reader)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	writeFile := func(contents []byte) string {
+		path := filepath.Join(GinkgoT().TempDir(), "keys")
+		Expect(os.WriteFile(path, contents, 0o600)).To(Succeed())
+		return path
+	}
+
+	It("should parse keys from configuration", func() {
+		keys, err := webhookscommon.ParseStaticKeys("serial-1=" + base64.StdEncoding.EncodeToString(publicKey))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(keys).To(HaveKeyWithValue("serial-1", publicKey))
+	})
+
+	It("should reject keys of invalid length", func() {
+		_, err := webhookscommon.ParseStaticKeys("serial-1=" + base64.StdEncoding.EncodeToString([]byte("short")))
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should load PEM-encoded keys with serial header", func() {
+		der, err := x509.MarshalPKIXPublicKey(publicKey)
+		Expect(err).NotTo(HaveOccurred())
+
+		contents := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Headers: map[string]string{"Serial": "serial-1"}, Bytes: der})
+
+		keys, err := webhookscommon.LoadKeysFromFile(writeFile(contents))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(keys).To(HaveKeyWithValue("serial-1", publicKey))
+	})
+
+	It("should load JWK sets", func() {
+		contents := fmt.Sprintf(`{"keys": [{"kty": "OKP", "crv": "Ed25519", "kid": "serial-1", "x": "%s"}]}`, base64.RawURLEncoding.EncodeToString(publicKey))
+
+		keys, err := webhookscommon.LoadKeysFromFile(writeFile([]byte(contents)))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(keys).To(HaveKeyWithValue("serial-1", publicKey))
+	})
+
+	It("should consult chained providers in order", func() {
+		chain := webhookscommon.KeyProviderChain{
+			&webhookscommon.KeyProviderStatic{Keys: map[string]ed25519.PublicKey{}},
+			&webhookscommon.KeyProviderStatic{Keys: map[string]ed25519.PublicKey{"serial-1": publicKey}},
+		}
+
+		key, err := chain.PublicKeyForSerial(context.Background(), "serial-1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(key).To(Equal(publicKey))
+
+		_, err = chain.PublicKeyForSerial(context.Background(), "serial-2")
+		Expect(err).To(MatchError(webhookscommon.ErrUnknownKeySerial))
+	})
+})
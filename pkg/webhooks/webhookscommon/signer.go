@@ -0,0 +1,26 @@
+package webhookscommon
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"net/http"
+)
+
+// Signer signs webhook requests the same way the marketplace does. It is used
+// to simulate webhooks in local and test setups; the corresponding public key
+// needs to be made known to the Verifier (for example, using a
+// KeyProviderStatic).
+type Signer struct {
+	Serial     string
+	PrivateKey ed25519.PrivateKey
+}
+
+// SignRequest sets the signature headers of a webhook request with the given
+// body.
+func (s *Signer) SignRequest(request *http.Request, body []byte) {
+	signature := ed25519.Sign(s.PrivateKey, body)
+
+	request.Header.Set("X-Marketplace-Signature-Serial", s.Serial)
+	request.Header.Set("X-Marketplace-Signature-Algorithm", "Ed25519")
+	request.Header.Set("X-Marketplace-Signature", base64.StdEncoding.EncodeToString(signature))
+}
@@ -8,6 +8,11 @@ import (
 	"net/http"
 )
 
+// Verifier checks the signature of webhook requests. The signature only covers
+// the request body; the marketplace does not sign a timestamp or delivery ID,
+// so redelivered (or replayed) requests cannot be told apart from the original
+// request here. Redeliveries and replays are detected using the webhook
+// delivery log when the webhook is enqueued instead.
 type Verifier struct {
 	KeyProvider KeyProvider
 }
@@ -0,0 +1,79 @@
+package webhookscommon_test
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mittwald/mstudio-ext-proxy/pkg/webhooks/webhookscommon"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+type staticKeyProvider struct {
+	key ed25519.PublicKey
+}
+
+func (s *staticKeyProvider) PublicKeyForSerial(context.Context, string) (ed25519.PublicKey, error) {
+	return s.key, nil
+}
+
+var _ = Describe("Verifier", func() {
+	var publicKey ed25519.PublicKey
+	var privateKey ed25519.PrivateKey
+	var verifier *webhookscommon.Verifier
+
+	body := []byte(`{"apiVersion":"v1","kind":"ExtensionInstanceRemovedFromContext","id":"foo"}`)
+
+	buildRequest := func() *http.Request {
+		req := httptest.NewRequest(http.MethodPost, "/mstudio/webhooks", strings.NewReader(string(body)))
+		signer := webhookscommon.Signer{Serial: "serial", PrivateKey: privateKey}
+		signer.SignRequest(req, body)
+		return req
+	}
+
+	BeforeEach(func() {
+		var err error
+		publicKey, privateKey, err = ed25519.GenerateKey(rand.Reader)
+		Expect(err).NotTo(HaveOccurred())
+
+		verifier = &webhookscommon.Verifier{
+			KeyProvider: &staticKeyProvider{key: publicKey},
+		}
+	})
+
+	It("should accept a valid request", func() {
+		Expect(verifier.VerifyWebhookRequest(context.Background(), buildRequest(), body)).To(Succeed())
+	})
+
+	It("should accept a redelivered request", func() {
+		Expect(verifier.VerifyWebhookRequest(context.Background(), buildRequest(), body)).To(Succeed())
+		Expect(verifier.VerifyWebhookRequest(context.Background(), buildRequest(), body)).To(Succeed())
+	})
+
+	It("should not depend on an unsigned timestamp header", func() {
+		forged := buildRequest()
+		forged.Header.Set("X-Marketplace-Signature-Timestamp", strconv.FormatInt(time.Now().Add(-24*time.Hour).Unix(), 10))
+		Expect(verifier.VerifyWebhookRequest(context.Background(), forged, body)).To(Succeed())
+
+		garbage := buildRequest()
+		garbage.Header.Set("X-Marketplace-Signature-Timestamp", "not-a-timestamp")
+		Expect(verifier.VerifyWebhookRequest(context.Background(), garbage, body)).To(Succeed())
+	})
+
+	It("should reject a request with a tampered body", func() {
+		tampered := []byte(`{"apiVersion":"v1","kind":"ExtensionInstanceRemovedFromContext","id":"bar"}`)
+		Expect(verifier.VerifyWebhookRequest(context.Background(), buildRequest(), tampered)).NotTo(Succeed())
+	})
+
+	It("should reject a request with an invalid signature", func() {
+		req := buildRequest()
+		req.Header.Set("X-Marketplace-Signature", "Zm9v")
+		Expect(verifier.VerifyWebhookRequest(context.Background(), req, body)).NotTo(Succeed())
+	})
+})
@@ -4,3 +4,13 @@ type Meta struct {
 	ExtensionID   string `json:"extensionId"`
 	ContributorID string `json:"contributorId"`
 }
+
+// WithMeta is implemented by all webhook types that carry a Meta object.
+type WithMeta interface {
+	WebhookMeta() Meta
+}
+
+func (w *ExtensionAddedToContext) WebhookMeta() Meta             { return w.Meta }
+func (w *ExtensionInstanceUpdated) WebhookMeta() Meta            { return w.Meta }
+func (w *ExtensionInstanceSecretRotated) WebhookMeta() Meta      { return w.Meta }
+func (w *ExtensionInstanceRemovedFromContext) WebhookMeta() Meta { return w.Meta }
@@ -0,0 +1,17 @@
+// Package templates contains the HTML templates rendered by the proxy. They
+// are embedded into the binary, so that the proxy does not depend on its
+// working directory.
+package templates
+
+import (
+	"embed"
+	"html/template"
+)
+
+//go:embed *.html
+var files embed.FS
+
+// Parse parses all embedded templates.
+func Parse() (*template.Template, error) {
+	return template.ParseFS(files, "*.html")
+}
@@ -0,0 +1,153 @@
+package e2e_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/mittwald/mstudio-ext-proxy/pkg/controller"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/domain/model"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/mstudiotest"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Personal API keys", func() {
+	instance := model.ExtensionInstance{
+		ID:          "instance",
+		ExtensionID: extensionID,
+		Enabled:     true,
+		Context:     model.ExtensionInstanceContext{ID: "project", Kind: "project"},
+		Scopes:      []string{"project:read", "project:write"},
+		Secret:      []byte("instance-secret"),
+	}
+
+	request := func(method, path, contentType, body string) *http.Response {
+		req, err := http.NewRequest(method, proxy.URL+path, strings.NewReader(body))
+		Expect(err).NotTo(HaveOccurred())
+
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+
+		resp, err := client.Do(req)
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(resp.Body.Close)
+
+		return resp
+	}
+
+	decode := func(resp *http.Response, out any) {
+		body, err := io.ReadAll(resp.Body)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(json.Unmarshal(body, out)).To(Succeed(), string(body))
+	}
+
+	create := func(body string) controller.CreatedAPIKeyDTO {
+		resp := request(http.MethodPost, "/mstudio/auth/keys", "application/json", body)
+		Expect(resp.StatusCode).To(Equal(http.StatusCreated))
+
+		out := controller.CreatedAPIKeyDTO{}
+		decode(resp, &out)
+		return out
+	}
+
+	list := func() []map[string]any {
+		resp := request(http.MethodGet, "/mstudio/auth/keys", "", "")
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+
+		out := make([]map[string]any, 0)
+		decode(resp, &out)
+		return out
+	}
+
+	getWithToken := func(token string) *http.Response {
+		req, _ := http.NewRequest(http.MethodGet, proxy.URL+"/", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		// The cookie jar would otherwise authenticate the request, too.
+		resp, err := proxy.Client().Do(req)
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(resp.Body.Close)
+
+		return resp
+	}
+
+	BeforeEach(func(ctx context.Context) {
+		Expect(repos.Instances.AddExtensionInstance(ctx, instance)).To(Succeed())
+		api.AddUser(mstudiotest.User{ID: "user", Email: "max@example.com", FirstName: "Max", LastName: "Mustermann"})
+
+		query := url.Values{"userId": {"user"}, "instanceId": {"instance"}, "atrek": {api.IssueRetrievalKey("user")}}
+		Expect(get("/mstudio/auth/oneclick?" + query.Encode()).StatusCode).To(Equal(http.StatusSeeOther))
+	})
+
+	It("should create a key that authenticates as the user", func() {
+		key := create(`{"name": "cli", "scopes": ["project:read"]}`)
+		Expect(key.Name).To(Equal("cli"))
+		Expect(key.InstanceID).To(Equal("instance"))
+		Expect(key.Scopes).To(Equal([]string{"project:read"}))
+		Expect(key.Token).To(HavePrefix("mxp_"))
+
+		Expect(getWithToken(key.Token).StatusCode).To(Equal(http.StatusOK))
+	})
+
+	It("should reject keys with scopes that are not granted to the instance", func() {
+		resp := request(http.MethodPost, "/mstudio/auth/keys", "application/json", `{"name": "cli", "scopes": ["project:delete"]}`)
+		Expect(resp.StatusCode).To(Equal(http.StatusBadRequest))
+		Expect(list()).To(BeEmpty())
+	})
+
+	It("should reject requests without a JSON body", func() {
+		resp := request(http.MethodPost, "/mstudio/auth/keys", "application/x-www-form-urlencoded", "name=cli")
+		Expect(resp.StatusCode).To(Equal(http.StatusUnsupportedMediaType))
+		Expect(list()).To(BeEmpty())
+	})
+
+	It("should list the user's keys without their tokens", func() {
+		key := create(`{"name": "cli"}`)
+
+		keys := list()
+		Expect(keys).To(HaveLen(1))
+		Expect(keys[0]).To(HaveKeyWithValue("id", key.ID))
+		Expect(keys[0]).To(HaveKeyWithValue("name", "cli"))
+		Expect(keys[0]).NotTo(HaveKey("token"))
+	})
+
+	It("should revoke a key", func() {
+		key := create(`{"name": "cli"}`)
+
+		resp := request(http.MethodDelete, "/mstudio/auth/keys/"+key.ID, "", "")
+		Expect(resp.StatusCode).To(Equal(http.StatusNoContent))
+
+		Expect(list()).To(BeEmpty())
+		Expect(getWithToken(key.Token).StatusCode).To(Equal(http.StatusUnauthorized))
+	})
+
+	It("should not revoke the user's keys for other instances", func(ctx context.Context) {
+		other, err := model.NewAPIKey()
+		Expect(err).NotTo(HaveOccurred())
+
+		other.Name = "other"
+		other.InstanceID = "other-instance"
+		other.UserID = "user"
+		Expect(repos.APIKeys.CreateAPIKeyWithUnhashedSecret(ctx, other)).To(Succeed())
+
+		resp := request(http.MethodDelete, "/mstudio/auth/keys/"+other.ID, "", "")
+		Expect(resp.StatusCode).To(Equal(http.StatusNotFound))
+
+		keys, err := repos.APIKeys.FindAPIKeysByUserIDAndInstanceID(ctx, "user", "other-instance")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(keys).To(HaveLen(1))
+	})
+
+	It("should require a session", func() {
+		proxyURL, _ := url.Parse(proxy.URL)
+		client.Jar.SetCookies(proxyURL, []*http.Cookie{{Name: "mstudio_ext_session", MaxAge: -1}})
+
+		resp := request(http.MethodGet, "/mstudio/auth/keys", "", "")
+		Expect(resp.StatusCode).To(Equal(http.StatusUnauthorized))
+	})
+})
@@ -0,0 +1,178 @@
+package e2e_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/bootstrap"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/events"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/mstudiotest"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/server"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/webhooks/webhookscommon"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestE2E(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "E2E Suite")
+}
+
+const (
+	jwtSecret         = "e2e-secret"
+	eventsSecret      = "e2e-events-secret"
+	extensionID       = "c1f4e7a0-0000-4000-8000-000000000001"
+	redirectURL       = "https://mstudio.example/login"
+	eventuallyTimeout = 5 * time.Second
+)
+
+var (
+	api      *mstudiotest.Server
+	upstream *upstreamRecorder
+	proxy    *httptest.Server
+	client   *http.Client
+	repos    bootstrap.Repositories
+	signer   *webhookscommon.Signer
+)
+
+var _ = BeforeSuite(func() {
+	gin.SetMode(gin.TestMode)
+})
+
+// BeforeEach boots the proxy, wired the same way as by the main program, but
+// with in-memory repositories, a fake mStudio API and a recording upstream.
+var _ = BeforeEach(func() {
+	var err error
+
+	api = mstudiotest.NewServer()
+	DeferCleanup(api.Close)
+
+	signer, err = api.GenerateSigner("e2e")
+	Expect(err).NotTo(HaveOccurred())
+
+	upstream = newUpstreamRecorder()
+	DeferCleanup(upstream.Close)
+
+	GinkgoT().Setenv("MITTWALD_EXT_PROXY_SECRET", jwtSecret)
+	GinkgoT().Setenv("MITTWALD_EXT_PROXY_API_BASE_URL", api.URL)
+	GinkgoT().Setenv("MITTWALD_EXT_PROXY_UPSTREAMS", `{"/": {"upstreamURL": "`+upstream.URL+`"}}`)
+	GinkgoT().Setenv("MITTWALD_EXT_PROXY_EXTENSION_IDS", extensionID)
+	GinkgoT().Setenv("MITTWALD_EXT_PROXY_REDIRECT_ON_UNAUTHENTICATED", redirectURL)
+	GinkgoT().Setenv("MITTWALD_EXT_PROXY_EVENTS_TARGETS", upstream.URL+"/events")
+	GinkgoT().Setenv("MITTWALD_EXT_PROXY_EVENTS_SECRET", eventsSecret)
+
+	logger := slog.New(slog.NewTextHandler(GinkgoWriter, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	repos = bootstrap.BuildMemoryRepositories()
+	srv, err := server.New(
+		server.WithConfig(bootstrap.ConfigFromEnv()),
+		server.WithRepositories(repos),
+		server.WithLogger(logger),
+	)
+	Expect(err).NotTo(HaveOccurred())
+
+	Expect(srv.Start(context.Background())).To(Succeed())
+	DeferCleanup(srv.Stop)
+
+	// The session cookies are secure, so the proxy needs to be served via
+	// HTTPS for the cookie jar to send them.
+	proxy = httptest.NewTLSServer(srv)
+	DeferCleanup(proxy.Close)
+
+	jar, err := cookiejar.New(nil)
+	Expect(err).NotTo(HaveOccurred())
+
+	client = proxy.Client()
+	client.Jar = jar
+	client.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+})
+
+// upstreamRecorder is an upstream application that records the requests it
+// receives, and the lifecycle events delivered to its "/events" endpoint.
+type upstreamRecorder struct {
+	*httptest.Server
+
+	lock     sync.Mutex
+	requests []http.Header
+	events   []events.Event
+}
+
+func newUpstreamRecorder() *upstreamRecorder {
+	u := &upstreamRecorder{}
+	u.Server = httptest.NewServer(http.HandlerFunc(u.serveHTTP))
+	return u
+}
+
+func (u *upstreamRecorder) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+
+	if r.URL.Path != "/events" {
+		u.requests = append(u.requests, r.Header.Clone())
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("hello from upstream"))
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if err := events.VerifySignature([]byte(eventsSecret), r.Header.Get(events.HeaderSignature), body, time.Minute); err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	event := events.Event{}
+	if err := json.Unmarshal(body, &event); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	u.events = append(u.events, event)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Requests returns the headers of all requests received by the upstream
+// (excluding event deliveries).
+func (u *upstreamRecorder) Requests() []http.Header {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+
+	return append([]http.Header(nil), u.requests...)
+}
+
+// EventKinds returns the kinds of all events delivered to the upstream, in
+// the order they were received.
+func (u *upstreamRecorder) EventKinds() []events.Kind {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+
+	kinds := make([]events.Kind, 0, len(u.events))
+	for _, e := range u.events {
+		kinds = append(kinds, e.Kind)
+	}
+
+	return kinds
+}
+
+func get(path string) *http.Response {
+	resp, err := client.Get(proxy.URL + path)
+	Expect(err).NotTo(HaveOccurred())
+	DeferCleanup(resp.Body.Close)
+
+	return resp
+}
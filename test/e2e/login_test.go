@@ -0,0 +1,262 @@
+package e2e_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/controller"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/domain/model"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/mstudiotest"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("One-click login", func() {
+	instance := model.ExtensionInstance{
+		ID:          "instance",
+		ExtensionID: extensionID,
+		Enabled:     true,
+		Context:     model.ExtensionInstanceContext{ID: "project", Kind: "project"},
+		Scopes:      []string{"project:read"},
+		Secret:      []byte("instance-secret"),
+	}
+
+	login := func(atrek string) *http.Response {
+		query := url.Values{"userId": {"user"}, "instanceId": {"instance"}, "atrek": {atrek}}
+		return get("/mstudio/auth/oneclick?" + query.Encode())
+	}
+
+	sessionCookie := func() *http.Cookie {
+		proxyURL, _ := url.Parse(proxy.URL)
+		for _, c := range client.Jar.Cookies(proxyURL) {
+			if c.Name == "mstudio_ext_session" {
+				return c
+			}
+		}
+		return nil
+	}
+
+	// userClaims returns the claims of the JWT that the upstream received
+	// with its most recent request.
+	userClaims := func() jwt.MapClaims {
+		requests := upstream.Requests()
+		Expect(requests).NotTo(BeEmpty())
+
+		claims := jwt.MapClaims{}
+		_, err := jwt.ParseWithClaims(requests[len(requests)-1].Get("X-Mstudio-User"), claims, func(*jwt.Token) (any, error) {
+			return []byte(jwtSecret), nil
+		}, jwt.WithValidMethods([]string{"HS512"}))
+		Expect(err).NotTo(HaveOccurred())
+
+		return claims
+	}
+
+	BeforeEach(func(ctx context.Context) {
+		Expect(repos.Instances.AddExtensionInstance(ctx, instance)).To(Succeed())
+		api.AddUser(mstudiotest.User{ID: "user", Email: "max@example.com", FirstName: "Max", LastName: "Mustermann"})
+	})
+
+	It("should log in a user and set a secure session cookie", func() {
+		resp := login(api.IssueRetrievalKey("user"))
+		Expect(resp.StatusCode).To(Equal(http.StatusSeeOther))
+		Expect(resp.Header.Get("Location")).To(Equal("/"))
+
+		cookies := resp.Cookies()
+		Expect(cookies).To(HaveLen(1))
+		Expect(cookies[0].Name).To(Equal("mstudio_ext_session"))
+		Expect(cookies[0].Secure).To(BeTrue())
+		Expect(cookies[0].HttpOnly).To(BeTrue())
+	})
+
+	It("should pass the user's identity to the upstream", func() {
+		login(api.IssueRetrievalKey("user"))
+
+		resp := get("/some/page")
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+
+		claims := userClaims()
+		Expect(claims).To(HaveKeyWithValue("sub", "user"))
+		Expect(claims).To(HaveKeyWithValue("fname", "Max"))
+		Expect(claims).To(HaveKeyWithValue("lname", "Mustermann"))
+		Expect(claims).To(HaveKeyWithValue("email", "max@example.com"))
+		Expect(claims).To(HaveKeyWithValue("tok", Not(BeEmpty())))
+		Expect(claims).To(HaveKeyWithValue("inst", SatisfyAll(
+			HaveKeyWithValue("id", "instance"),
+			HaveKeyWithValue("extensionId", extensionID),
+			HaveKeyWithValue("context", HaveKeyWithValue("id", "project")),
+		)))
+	})
+
+	It("should not pass the session cookie to the upstream", func() {
+		login(api.IssueRetrievalKey("user"))
+
+		proxyURL, _ := url.Parse(proxy.URL)
+		client.Jar.SetCookies(proxyURL, []*http.Cookie{{Name: "app_preferences", Value: "dark"}})
+
+		get("/")
+
+		requests := upstream.Requests()
+		Expect(requests).To(HaveLen(1))
+		Expect(requests[0].Get("X-Mstudio-User")).NotTo(BeEmpty())
+
+		forwarded := &http.Request{Header: requests[0]}
+		_, err := forwarded.Cookie("mstudio_ext_session")
+		Expect(err).To(MatchError(http.ErrNoCookie))
+		Expect(forwarded.Cookie("app_preferences")).To(HaveField("Value", "dark"))
+	})
+
+	It("should pass bearer tokens that are no API keys to the upstream", func() {
+		login(api.IssueRetrievalKey("user"))
+
+		req, _ := http.NewRequest(http.MethodGet, proxy.URL+"/", nil)
+		req.Header.Set("Authorization", "Bearer upstream-token")
+
+		resp, err := client.Do(req)
+		Expect(err).NotTo(HaveOccurred())
+		defer resp.Body.Close()
+
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+
+		requests := upstream.Requests()
+		Expect(requests).To(HaveLen(1))
+		Expect(requests[0].Get("Authorization")).To(Equal("Bearer upstream-token"))
+		Expect(userClaims()).To(HaveKeyWithValue("sub", "user"))
+	})
+
+	It("should reject invalid retrieval keys", func() {
+		resp := login("invalid")
+		Expect(resp.StatusCode).To(Equal(http.StatusUnauthorized))
+		Expect(resp.Cookies()).To(BeEmpty())
+	})
+
+	It("should reject retrieval keys that were already used", func() {
+		atrek := api.IssueRetrievalKey("user")
+		Expect(login(atrek).StatusCode).To(Equal(http.StatusSeeOther))
+		Expect(login(atrek).StatusCode).To(Equal(http.StatusUnauthorized))
+	})
+
+	It("should reject logins for unknown instances", func() {
+		query := url.Values{"userId": {"user"}, "instanceId": {"unknown"}, "atrek": {api.IssueRetrievalKey("user")}}
+		Expect(get("/mstudio/auth/oneclick?" + query.Encode()).StatusCode).To(Equal(http.StatusNotFound))
+	})
+
+	Describe("token refresh", func() {
+		expireSession := func(ctx context.Context) {
+			id, secret := model.SessionIDAndSecretFromCookieString(sessionCookie().Value)
+			session, err := repos.Sessions.FindSessionByIDAndSecret(ctx, id, secret)
+			Expect(err).NotTo(HaveOccurred())
+
+			session.Expires = time.Now().Add(-time.Minute)
+			Expect(repos.Sessions.RefreshSession(ctx, *session)).To(Succeed())
+		}
+
+		BeforeEach(func() {
+			login(api.IssueRetrievalKey("user"))
+			get("/")
+		})
+
+		It("should refresh the access token of an expired session", func(ctx context.Context) {
+			oldToken := userClaims()["tok"]
+			expireSession(ctx)
+
+			Expect(get("/").StatusCode).To(Equal(http.StatusOK))
+
+			Expect(api.RequestCount(mstudiotest.EndpointRefreshSession)).To(Equal(1))
+			Expect(userClaims()["tok"]).NotTo(Equal(oldToken))
+		})
+
+		It("should only refresh once", func(ctx context.Context) {
+			expireSession(ctx)
+
+			get("/")
+			get("/")
+
+			Expect(api.RequestCount(mstudiotest.EndpointRefreshSession)).To(Equal(1))
+		})
+
+		It("should not proxy requests when the refresh fails", func(ctx context.Context) {
+			expireSession(ctx)
+			api.RevokeTokens("user")
+
+			Expect(get("/").StatusCode).To(Equal(http.StatusInternalServerError))
+			Expect(upstream.Requests()).To(HaveLen(1))
+		})
+	})
+
+	Describe("unauthenticated requests", func() {
+		It("should redirect to the configured URL", func() {
+			resp := get("/")
+			Expect(resp.StatusCode).To(Equal(http.StatusSeeOther))
+			Expect(resp.Header.Get("Location")).To(Equal(redirectURL))
+			Expect(upstream.Requests()).To(BeEmpty())
+		})
+
+		It("should reject invalid session cookies", func() {
+			proxyURL, _ := url.Parse(proxy.URL)
+			client.Jar.SetCookies(proxyURL, []*http.Cookie{{Name: "mstudio_ext_session", Value: "foo:ABCDEF"}})
+
+			Expect(get("/").StatusCode).To(Equal(http.StatusUnauthorized))
+			Expect(upstream.Requests()).To(BeEmpty())
+		})
+
+		It("should reject unknown API keys", func() {
+			req, _ := http.NewRequest(http.MethodGet, proxy.URL+"/", nil)
+			req.Header.Set("Authorization", "Bearer mxp_unknown_ABCDEF")
+
+			resp, err := client.Do(req)
+			Expect(err).NotTo(HaveOccurred())
+			defer resp.Body.Close()
+
+			Expect(resp.StatusCode).To(Equal(http.StatusUnauthorized))
+		})
+	})
+
+	Describe("request IDs", func() {
+		It("should pass the client's request ID to the upstream and return it", func() {
+			login(api.IssueRetrievalKey("user"))
+
+			req, _ := http.NewRequest(http.MethodGet, proxy.URL+"/", nil)
+			req.Header.Set("X-Request-Id", "support-123")
+
+			resp, err := client.Do(req)
+			Expect(err).NotTo(HaveOccurred())
+			defer resp.Body.Close()
+
+			Expect(resp.Header.Values("X-Request-Id")).To(Equal([]string{"support-123"}))
+
+			requests := upstream.Requests()
+			Expect(requests).To(HaveLen(1))
+			Expect(requests[0].Get("X-Request-Id")).To(Equal("support-123"))
+		})
+
+		It("should pass the request ID to the mittwald API", func() {
+			query := url.Values{"userId": {"user"}, "instanceId": {"instance"}, "atrek": {api.IssueRetrievalKey("user")}}
+			req, _ := http.NewRequest(http.MethodGet, proxy.URL+"/mstudio/auth/oneclick?"+query.Encode(), nil)
+			req.Header.Set("X-Request-Id", "support-456")
+
+			resp, err := client.Do(req)
+			Expect(err).NotTo(HaveOccurred())
+			defer resp.Body.Close()
+
+			Expect(api.RequestIDs(mstudiotest.EndpointAuthenticateWithRetrievalKey)).To(Equal([]string{"support-456"}))
+			Expect(api.RequestIDs(mstudiotest.EndpointGetUser)).To(Equal([]string{"support-456"}))
+		})
+
+		It("should generate a request ID and include it in error responses", func() {
+			proxyURL, _ := url.Parse(proxy.URL)
+			client.Jar.SetCookies(proxyURL, []*http.Cookie{{Name: "mstudio_ext_session", Value: "foo:ABCDEF"}})
+
+			resp := get("/")
+			Expect(resp.StatusCode).To(Equal(http.StatusUnauthorized))
+
+			body := controller.ErrorResponse{}
+			Expect(json.NewDecoder(resp.Body).Decode(&body)).To(Succeed())
+			Expect(body.RequestID).NotTo(BeEmpty())
+			Expect(body.RequestID).To(Equal(resp.Header.Get("X-Request-Id")))
+		})
+	})
+})
@@ -0,0 +1,217 @@
+package e2e_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/mittwald/mstudio-ext-proxy/pkg/domain/model"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/events"
+	"github.com/mittwald/mstudio-ext-proxy/pkg/mstudiotest"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Webhooks", func() {
+	meta := map[string]any{"extensionId": extensionID, "contributorId": "contributor"}
+	instanceContext := map[string]any{"id": "project", "kind": "project"}
+
+	added := map[string]any{
+		"apiVersion":      "v1",
+		"kind":            "ExtensionAddedToContext",
+		"id":              "instance",
+		"context":         instanceContext,
+		"consentedScopes": []string{"project:read"},
+		"state":           map[string]any{"enabled": true},
+		"meta":            meta,
+		"secret":          "first-secret",
+	}
+
+	rotated := map[string]any{
+		"apiVersion": "v1",
+		"kind":       "ExtensionInstanceSecretRotated",
+		"id":         "instance",
+		"context":    instanceContext,
+		"meta":       meta,
+		"secret":     "second-secret",
+	}
+
+	removed := map[string]any{
+		"apiVersion":      "v1",
+		"kind":            "ExtensionInstanceRemovedFromContext",
+		"id":              "instance",
+		"context":         instanceContext,
+		"consentedScopes": []string{"project:read"},
+		"state":           map[string]any{"enabled": true},
+		"meta":            meta,
+	}
+
+	updated := func(enabled bool) map[string]any {
+		return map[string]any{
+			"apiVersion":      "v1",
+			"kind":            "ExtensionInstanceUpdated",
+			"id":              "instance",
+			"context":         instanceContext,
+			"consentedScopes": []string{"project:read"},
+			"state":           map[string]any{"enabled": enabled},
+			"meta":            meta,
+		}
+	}
+
+	buildRequest := func(body map[string]any) *http.Request {
+		payload, err := json.Marshal(body)
+		Expect(err).NotTo(HaveOccurred())
+
+		req, err := http.NewRequest(http.MethodPost, proxy.URL+"/mstudio/webhooks", bytes.NewReader(payload))
+		Expect(err).NotTo(HaveOccurred())
+
+		signer.SignRequest(req, payload)
+		return req
+	}
+
+	send := func(req *http.Request) int {
+		resp, err := client.Do(req)
+		Expect(err).NotTo(HaveOccurred())
+		defer resp.Body.Close()
+
+		return resp.StatusCode
+	}
+
+	findInstance := func(ctx context.Context) func() (model.ExtensionInstance, error) {
+		return func() (model.ExtensionInstance, error) {
+			return repos.Instances.FindExtensionInstanceByID(ctx, "instance")
+		}
+	}
+
+	oneClickLogin := func() int {
+		api.AddUser(mstudiotest.User{ID: "user"})
+		query := url.Values{"userId": {"user"}, "instanceId": {"instance"}, "atrek": {api.IssueRetrievalKey("user")}}
+		return get("/mstudio/auth/oneclick?" + query.Encode()).StatusCode
+	}
+
+	It("should install, rotate and remove an instance", func(ctx context.Context) {
+		By("installing the instance")
+		Expect(send(buildRequest(added))).To(Equal(http.StatusAccepted))
+		Eventually(findInstance(ctx), eventuallyTimeout).Should(SatisfyAll(
+			HaveField("ExtensionID", extensionID),
+			HaveField("Enabled", true),
+			HaveField("Scopes", ConsistOf("project:read")),
+			HaveField("Secret", BeEquivalentTo("first-secret")),
+		))
+		Eventually(upstream.EventKinds, eventuallyTimeout).Should(Equal([]events.Kind{events.KindInstanceAdded}))
+		Expect(oneClickLogin()).To(Equal(http.StatusSeeOther))
+
+		By("rotating the instance secret")
+		Expect(send(buildRequest(rotated))).To(Equal(http.StatusAccepted))
+		Eventually(findInstance(ctx), eventuallyTimeout).Should(HaveField("Secret", BeEquivalentTo("second-secret")))
+		Eventually(upstream.EventKinds, eventuallyTimeout).Should(Equal([]events.Kind{events.KindInstanceAdded, events.KindInstanceSecretRotated}))
+
+		By("removing the instance")
+		Expect(send(buildRequest(removed))).To(Equal(http.StatusAccepted))
+		Eventually(func() error {
+			_, err := findInstance(ctx)()
+			return err
+		}, eventuallyTimeout).Should(HaveOccurred())
+		Eventually(upstream.EventKinds, eventuallyTimeout).Should(Equal([]events.Kind{events.KindInstanceAdded, events.KindInstanceSecretRotated, events.KindInstanceRemoved}))
+		Expect(oneClickLogin()).To(Equal(http.StatusNotFound))
+	})
+
+	It("should fetch the signing key from the mStudio API only once", func() {
+		Expect(send(buildRequest(added))).To(Equal(http.StatusAccepted))
+		Expect(send(buildRequest(rotated))).To(Equal(http.StatusAccepted))
+
+		Expect(api.RequestCount(mstudiotest.EndpointGetPublicKey)).To(Equal(1))
+	})
+
+	It("should acknowledge redelivered requests without processing them again", func(ctx context.Context) {
+		clone := func(req *http.Request) *http.Request {
+			c := req.Clone(context.Background())
+			c.Body, _ = req.GetBody()
+			return c
+		}
+
+		req := buildRequest(added)
+
+		redelivered := clone(req)
+
+		forged := clone(req)
+		forged.Header.Set("X-Marketplace-Signature-Timestamp", strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10))
+
+		Expect(send(req)).To(Equal(http.StatusAccepted))
+		Eventually(upstream.EventKinds, eventuallyTimeout).Should(Equal([]events.Kind{events.KindInstanceAdded}))
+
+		Expect(send(redelivered)).To(Equal(http.StatusAccepted))
+		Expect(send(forged)).To(Equal(http.StatusAccepted))
+
+		Consistently(upstream.EventKinds, "500ms").Should(Equal([]events.Kind{events.KindInstanceAdded}))
+		Expect(findInstance(ctx)()).To(HaveField("Secret", BeEquivalentTo("first-secret")))
+	})
+
+	It("should reject replayed requests after the redelivery window", func(ctx context.Context) {
+		Expect(send(buildRequest(added))).To(Equal(http.StatusAccepted))
+		Eventually(upstream.EventKinds, eventuallyTimeout).Should(Equal([]events.Kind{events.KindInstanceAdded}))
+
+		By("moving the first delivery out of the redelivery window")
+		payload, err := json.Marshal(added)
+		Expect(err).NotTo(HaveOccurred())
+
+		hash := sha256.Sum256(payload)
+		id := model.WebhookDeliveryID("ExtensionAddedToContext", "instance", hex.EncodeToString(hash[:]))
+
+		delivery, err := repos.WebhookDeliveries.FindWebhookDeliveryByID(ctx, id)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(delivery).NotTo(BeNil())
+
+		delivery.FirstReceived = delivery.FirstReceived.Add(-48 * time.Hour)
+		Expect(repos.WebhookDeliveries.SaveWebhookDelivery(ctx, *delivery)).To(Succeed())
+
+		Expect(send(buildRequest(added))).To(Equal(http.StatusConflict))
+
+		Consistently(upstream.EventKinds, "500ms").Should(Equal([]events.Kind{events.KindInstanceAdded}))
+	})
+
+	It("should not apply a redelivery of an earlier webhook", func(ctx context.Context) {
+		Expect(send(buildRequest(added))).To(Equal(http.StatusAccepted))
+		Eventually(upstream.EventKinds, eventuallyTimeout).Should(HaveLen(1))
+
+		for i, enabled := range []bool{false, true} {
+			Expect(send(buildRequest(updated(enabled)))).To(Equal(http.StatusAccepted))
+			Eventually(upstream.EventKinds, eventuallyTimeout).Should(HaveLen(i + 2))
+		}
+
+		Expect(send(buildRequest(updated(false)))).To(Equal(http.StatusAccepted))
+
+		Consistently(upstream.EventKinds, "500ms").Should(Equal([]events.Kind{events.KindInstanceAdded, events.KindInstanceUpdated, events.KindInstanceUpdated}))
+		Expect(findInstance(ctx)()).To(HaveField("Enabled", true))
+	})
+
+	It("should reject requests with an invalid signature", func() {
+		req := buildRequest(added)
+		req.Header.Set("X-Marketplace-Signature", "aW52YWxpZA==")
+
+		Expect(send(req)).To(Equal(http.StatusForbidden))
+	})
+
+	It("should reject requests signed with an unknown key", func() {
+		req := buildRequest(added)
+		req.Header.Set("X-Marketplace-Signature-Serial", "unknown")
+
+		Expect(send(req)).To(Equal(http.StatusForbidden))
+	})
+
+	It("should reject webhooks for other extensions", func() {
+		foreign := map[string]any{}
+		for k, v := range added {
+			foreign[k] = v
+		}
+		foreign["meta"] = map[string]any{"extensionId": "other", "contributorId": "contributor"}
+
+		Expect(send(buildRequest(foreign))).To(Equal(http.StatusForbidden))
+	})
+})